@@ -1,6 +1,10 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/atoscerebro/bms-analysis/internal/config"
 	"github.com/atoscerebro/bms-analysis/internal/kibana"
 )
@@ -10,9 +14,36 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	kc := kibana.NewKibanaClient(cf)
-	err = kc.AnalyseAlerts()
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "noise":
+		err = noise(cf, os.Args[2:])
+	default:
+		cf.BindFlags(flag.CommandLine)
+		flag.Parse()
+		err = kibana.NewKibanaClient(cf).AnalyseAlerts()
+	}
 	if err != nil {
 		panic(err)
 	}
 }
+
+// noise prints the watches noisiest first.
+func noise(cf *config.Config, args []string) error {
+	fs := flag.NewFlagSet("noise", flag.ExitOnError)
+	cf.BindFlags(fs)
+	fs.Parse(args)
+	result, err := kibana.NewKibanaClient(cf).FindWatcherNoise()
+	if err != nil {
+		return err
+	}
+	for _, w := range result.Watches {
+		fmt.Printf("%8.2f %s: %d fires, %.1f/day, every %.0fs, %.0f%% flapping, %.0f%% linked, %.0f%% in one cluster\n",
+			w.Noise, w.WatchID, w.Fires, w.FiresPerDay, w.MeanTimeBetweenFires, w.FlapRate*100, w.LinkedShare*100, w.ClusterShare*100)
+	}
+	fmt.Printf("%d watches from %s to %s written to %s\n", len(result.Watches), result.From, result.To, kibana.AlertsNoiseOutputPath)
+	return nil
+}
@@ -1,6 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
 	"github.com/atoscerebro/bms-analysis/internal/config"
 	"github.com/atoscerebro/bms-analysis/internal/kibana"
 )
@@ -10,9 +18,129 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	kc := kibana.NewKibanaClient(cf)
-	err = kc.AnalyseErrors()
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "similar":
+		err = similar(cf, os.Args[2:])
+	case "novel":
+		err = novel(cf, os.Args[2:])
+	case "incidents":
+		err = incidents(cf, os.Args[2:])
+	case "coverage":
+		err = coverage(cf, os.Args[2:])
+	default:
+		cf.BindFlags(flag.CommandLine)
+		flag.Parse()
+		err = kibana.NewKibanaClient(cf).AnalyseErrors()
+	}
 	if err != nil {
 		panic(err)
 	}
 }
+
+// similar prints the analysed errors most similar to a log ID or to the
+// error message given as arguments.
+func similar(cf *config.Config, args []string) error {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	cf.BindFlags(fs)
+	k := fs.Int("k", 10, "number of similar errors to find")
+	id := fs.String("id", "", "id of an analysed log to find errors similar to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s similar [flags] [error message]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	message := strings.Join(fs.Args(), " ")
+	if message == "" && *id == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	result, err := kibana.NewKibanaClient(cf).FindSimilarErrors(message, *id, *k)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal similar errors: %s", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// novel compares a batch of logs with a reference dataset and prints the
+// error patterns the reference has never seen, largest first.
+func novel(cf *config.Config, args []string) error {
+	fs := flag.NewFlagSet("novel", flag.ExitOnError)
+	cf.BindFlags(fs)
+	reference := fs.String("reference", kibana.ErrorsCoordinatesOutputPath, "coordinates or logs file of the reference dataset")
+	batch := fs.String("batch", "", "coordinates or logs file of the new logs, or empty to fetch them from kibana")
+	fs.Parse(args)
+	result, err := kibana.NewKibanaClient(cf).FindNovelErrors(*reference, *batch)
+	if err != nil {
+		return err
+	}
+	for _, p := range result.Patterns {
+		fmt.Printf("%d logs, novelty %.3f, %s: %s\n", p.Size, p.Novelty, strings.Join(slices.Sorted(maps.Keys(p.Microservices)), ","), p.Medoid)
+	}
+	fmt.Printf("%d of %d logs are novel, written to %s\n", result.Novel, result.Batch, kibana.ErrorsNoveltyOutputPath)
+	return nil
+}
+
+// incidents prints the incidents of the analysed errors oldest first.
+func incidents(cf *config.Config, args []string) error {
+	fs := flag.NewFlagSet("incidents", flag.ExitOnError)
+	cf.BindFlags(fs)
+	fs.Parse(args)
+	result, err := kibana.NewKibanaClient(cf).FindIncidents()
+	if err != nil {
+		return err
+	}
+	for _, i := range result.Incidents {
+		key := ""
+		if i.Key != "" {
+			key = fmt.Sprintf(" [%s]", i.Key)
+		}
+		fmt.Printf("#%d%s %s to %s, %d logs, peak %d/min, %s: %s\n", i.ID, key, i.Start, i.End, i.Size, i.PeakRate,
+			strings.Join(slices.Sorted(maps.Keys(i.Microservices)), ","), i.Representative)
+		for _, a := range i.Alerts {
+			fmt.Printf("    %s %s\n", a.Time, a.WatchID)
+		}
+	}
+	fmt.Printf("%d incidents written to %s\n", len(result.Incidents), kibana.ErrorsIncidentsOutputPath)
+	return nil
+}
+
+// coverage prints how well the watchers cover the bursts of each message
+// code and how many of their fires had a burst nearby.
+func coverage(cf *config.Config, args []string) error {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	cf.BindFlags(fs)
+	fs.Parse(args)
+	result, err := kibana.NewKibanaClient(cf).FindAlertCoverage()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("from %s to %s, %d of %d bursts alerted on (%.1f%%), %d of %d fires had a burst nearby (%.1f%%)\n",
+		result.From, result.To, result.Covered, result.Bursts, result.Coverage*100, result.Matched, result.Fires, result.Precision*100)
+	fmt.Println("message codes:")
+	for _, c := range result.Codes {
+		watches := strings.Join(c.Watches, ",")
+		if watches == "" {
+			watches = "no watch"
+		}
+		fmt.Printf("  %5.1f%% of %d bursts %s (%s)\n", c.Coverage*100, c.Bursts, c.Message, watches)
+	}
+	fmt.Println("watches:")
+	for _, w := range result.Watches {
+		if w.Unmapped {
+			fmt.Printf("  %d fires %s (no message codes)\n", w.Fires, w.WatchID)
+			continue
+		}
+		fmt.Printf("  %5.1f%% of %d fires %s\n", w.Coverage*100, w.Fires, w.WatchID)
+	}
+	fmt.Printf("%d uncovered bursts and %d unmatched fires written to %s\n", len(result.Uncovered), len(result.Unmatched), kibana.ErrorsCoverageOutputPath)
+	return nil
+}
@@ -8,8 +8,30 @@ func main() {
 	config := &tygo.Config{
 		Packages: []*tygo.PackageConfig{
 			{
-				Path:       "github.com/atoscerebro/bms-analysis/internal/kibana",
-				OutputPath: "internal/client/src/models/kibana.ts",
+				Path:        "github.com/atoscerebro/bms-analysis/internal/kibana",
+				OutputPath:  "internal/client/src/models/kibana.ts",
+				Frontmatter: "import { Coordinate, Projection } from './similarity';\nimport { Clustering, Dendrogram } from './cluster';\n",
+				TypeMappings: map[string]string{
+					"similarity.Coordinate": "Coordinate",
+					"similarity.Projection": "Projection",
+					"cluster.Clustering":    "Clustering",
+					"cluster.Dendrogram":    "Dendrogram",
+				},
+			},
+			{
+				Path:       "github.com/atoscerebro/bms-analysis/internal/similarity",
+				OutputPath: "internal/client/src/models/similarity.ts",
+				IncludeFiles: []string{
+					"projection.go",
+				},
+			},
+			{
+				Path:       "github.com/atoscerebro/bms-analysis/internal/cluster",
+				OutputPath: "internal/client/src/models/cluster.ts",
+				IncludeFiles: []string{
+					"clustering.go",
+					"dendrogram.go",
+				},
 			},
 		},
 	}
@@ -1,23 +1,23 @@
 import { useCallback, useState } from 'react';
-import { KibanaErrorLog } from './models/kibana';
+import { KibanaAnalysis } from './models/kibana';
 import { Graph } from './pages/graph/graph';
 import { Upload } from './pages/upload/upload';
 
 function App() {
-  const [logs, setLogs] = useState<KibanaErrorLog[] | undefined>(undefined);
+  const [analysis, setAnalysis] = useState<KibanaAnalysis | undefined>(undefined);
 
-  const handleLogsAdded = useCallback((logs: KibanaErrorLog[]) => {
-    setLogs(logs);
+  const handleAnalysisAdded = useCallback((analysis: KibanaAnalysis) => {
+    setAnalysis(analysis);
   }, []);
 
-  const handleLogsCleared = useCallback(() => {
-    setLogs(undefined);
+  const handleAnalysisCleared = useCallback(() => {
+    setAnalysis(undefined);
   }, []);
 
   return (
     <>
-      {!logs && <Upload setLogs={handleLogsAdded} />}
-      {logs && <Graph logs={logs} clearLogs={handleLogsCleared} />}
+      {!analysis && <Upload setAnalysis={handleAnalysisAdded} />}
+      {analysis && <Graph analysis={analysis} clearLogs={handleAnalysisCleared} />}
     </>
   );
 }
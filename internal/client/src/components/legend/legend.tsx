@@ -0,0 +1,72 @@
+import { useCallback } from 'react';
+import { KibanaCluster, KibanaErrorLog } from '../../models/kibana';
+
+const clusterColours = [
+  '#1f77b4',
+  '#ff7f0e',
+  '#2ca02c',
+  '#d62728',
+  '#9467bd',
+  '#8c564b',
+  '#e377c2',
+  '#bcbd22',
+  '#17becf',
+];
+
+// Outliers and unclustered logs are grey so the clusters stand out.
+export const clusterColour = (log: KibanaErrorLog) =>
+  log.cluster.id < 0 ? '#bbbbbb' : clusterColours[log.cluster.id % clusterColours.length];
+
+const topKeys = (counts: { [key: string]: number }) =>
+  Object.entries(counts)
+    .sort(([, a], [, b]) => b - a)
+    .slice(0, 3)
+    .map(([key]) => key)
+    .join(', ');
+
+export type LegendProps = {
+  clusters: KibanaCluster[];
+  onClusterSelected(id: number): void;
+};
+
+export const Legend: React.FC<LegendProps> = ({ clusters, onClusterSelected }) => {
+  const renderCluster = useCallback(
+    (cluster: KibanaCluster) => {
+      return (
+        <button
+          key={cluster.id}
+          className="flex gap-2 text-xs text-left cursor-pointer"
+          onClick={() => onClusterSelected(cluster.id)}
+        >
+          <span
+            className="inline-block min-w-3 h-3 mt-0.5"
+            style={{ backgroundColor: clusterColours[cluster.id % clusterColours.length] }}
+          />
+          <span className="break-all">
+            <span className="text-red-500">
+              {cluster.id}: {cluster.tokens.join(' ')}
+            </span>{' '}
+            ({cluster.size} logs, {cluster.unique} unique)
+            <br />
+            {cluster.medoid}
+            <br />
+            {topKeys(cluster.microservices)} / {topKeys(cluster.messages)}
+            <br />
+            {cluster.firstSeen} to {cluster.lastSeen}
+          </span>
+        </button>
+      );
+    },
+    [onClusterSelected]
+  );
+
+  if (clusters.length === 0) {
+    return null;
+  }
+  return (
+    <div className="max-h-48 overflow-y-auto px-5 flex flex-col gap-2">
+      <h2>Clusters</h2>
+      {clusters.map(renderCluster)}
+    </div>
+  );
+};
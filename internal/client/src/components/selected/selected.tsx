@@ -1,14 +1,22 @@
-import { useCallback } from 'react';
+import { useCallback, useMemo } from 'react';
 import { LogFieldSelectorsActive } from '../../models/models';
-import { KibanaErrorLog } from '../../models/kibana';
+import { KibanaCluster, KibanaErrorLog } from '../../models/kibana';
 
 export type SelectedProps = {
   selecting: boolean;
   selectors: LogFieldSelectorsActive;
   logs: KibanaErrorLog[];
+  clusters: KibanaCluster[];
 };
 
-export const Selected: React.FC<SelectedProps> = ({ selecting, selectors, logs }) => {
+const clusterName = (log: KibanaErrorLog) => {
+  if (log.cluster.outlier) {
+    return 'outlier';
+  }
+  return log.cluster.id < 0 ? 'none' : `${log.cluster.id}`;
+};
+
+export const Selected: React.FC<SelectedProps> = ({ selecting, selectors, logs, clusters }) => {
   const renderField = useCallback((property: string, text: string) => {
     return (
       <div className="text-xs break-all text-left">
@@ -18,23 +26,49 @@ export const Selected: React.FC<SelectedProps> = ({ selecting, selectors, logs }
     );
   }, []);
 
+  const clusterLabel = useCallback(
+    (log: KibanaErrorLog) => {
+      const cluster = clusters[log.cluster.id];
+      if (!cluster) {
+        return clusterName(log);
+      }
+      return `${clusterName(log)}: ${cluster.tokens.join(' ')} (${cluster.size} logs)`;
+    },
+    [clusters]
+  );
+
   const renderLog = useCallback(
     (log: KibanaErrorLog) => {
       return (
         <div key={log._id} className="text-sm">
           {selectors.id && renderField('id', log._id)}
+          {(log.cluster.id >= 0 || log.cluster.outlier) && renderField('cluster', clusterLabel(log))}
+          {log.fingerprint && renderField('fingerprint', log.fingerprint)}
           {selectors.microservice && renderField('microservice', log._source.microservice)}
           {selectors.message && renderField('message', log._source.message)}
           {selectors.errorMessage && renderField('errorMessage', log._source.errorMessage)}
         </div>
       );
     },
-    [selectors, renderField]
+    [selectors, renderField, clusterLabel]
   );
 
+  const membership = useMemo(() => {
+    const counts: { [name: string]: number } = {};
+    for (const log of logs) {
+      counts[clusterName(log)] = (counts[clusterName(log)] ?? 0) + 1;
+    }
+    return Object.entries(counts).sort(([, a], [, b]) => b - a);
+  }, [logs]);
+
   return (
     <aside className="w-full h-full overflow-y-auto min-w-[100px] max-w-[250px]">
       <h2>Selected: {logs.length}</h2>
+      {!selecting && membership.length > 1 && (
+        <p className="text-xs text-left">
+          Clusters: {membership.map(([name, count]) => `${name} (${count})`).join(', ')}
+        </p>
+      )}
       {selecting && <p>Selecting...</p>}
       {!selecting && <div className="flex flex-col gap-4">{logs.map(renderLog)}</div>}
     </aside>
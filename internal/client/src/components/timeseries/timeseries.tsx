@@ -0,0 +1,102 @@
+import { useEffect, useMemo, useState } from 'react';
+import { Data } from 'plotly.js';
+import Plot from 'react-plotly.js';
+import { GetErrorTimeSeries } from '../../../wailsjs/go/handler/Handler';
+import { KibanaErrorLog, KibanaTimeSeries, KibanaTimeSeriesLog } from '../../models/kibana';
+
+const dimensions = ['message', 'microservice', 'cluster'];
+
+// Only the busiest series are drawn so the chart stays readable.
+const maxSeries = 8;
+
+// The series are counted from the loaded analysis, whichever file it came
+// from, rather than the last errors run on disk.
+export const TimeSeries: React.FC<{ logs: KibanaErrorLog[] }> = ({ logs }) => {
+  const [interval, setBucketInterval] = useState('');
+  const [dimension, setDimension] = useState(dimensions[0]);
+  const [timeSeries, setTimeSeries] = useState<KibanaTimeSeries | undefined>(undefined);
+  const [error, setError] = useState('');
+
+  const seriesLogs: KibanaTimeSeriesLog[] = useMemo(
+    () =>
+      logs.map((log) => ({
+        id: log._id,
+        timestamp: log._source['@timestamp'],
+        message: log._source.message,
+        microservice: log._source.microservice,
+        cluster: log.cluster.id,
+      })),
+    [logs]
+  );
+
+  useEffect(() => {
+    GetErrorTimeSeries(seriesLogs, interval)
+      .then((ts) => {
+        setTimeSeries(ts);
+        setError('');
+      })
+      .catch((err) => setError(String(err)));
+  }, [seriesLogs, interval]);
+
+  const plotData: Data[] = useMemo(() => {
+    if (!timeSeries) {
+      return [];
+    }
+    const series = timeSeries.series
+      .filter((s) => s.dimension === dimension)
+      .sort((a, b) => b.total - a.total)
+      .slice(0, maxSeries);
+    return series.flatMap((s): Data[] => [
+      {
+        x: timeSeries.buckets,
+        y: s.counts,
+        name: s.key,
+        legendgroup: s.key,
+        mode: 'lines',
+        type: 'scatter',
+      },
+      {
+        x: s.spikes.map((b) => timeSeries.buckets[b]),
+        y: s.spikes.map((b) => s.counts[b]),
+        text: s.spikes.map((b) => `${s.key}: ${s.counts[b]} logs, baseline ${s.baselines[b]}, score ${s.scores[b]?.toFixed(1)}`),
+        hoverinfo: 'text',
+        legendgroup: s.key,
+        showlegend: false,
+        mode: 'markers',
+        type: 'scatter',
+        marker: { color: 'red', size: 8, symbol: 'x' },
+      },
+    ]);
+  }, [timeSeries, dimension]);
+
+  return (
+    <div className="w-1/3 flex flex-col">
+      <div className="flex gap-2 px-2 text-xs">
+        <select className="border" value={dimension} onChange={(e) => setDimension(e.target.value)}>
+          {dimensions.map((d) => (
+            <option key={d} value={d}>
+              {d}
+            </option>
+          ))}
+        </select>
+        <input
+          className="border w-16"
+          placeholder={timeSeries?.interval ?? '1h'}
+          onBlur={(e) => setBucketInterval(e.target.value)}
+        />
+        {timeSeries && (
+          <span className="self-center">
+            {timeSeries.spikes.length} spikes ({timeSeries.baseline} baseline)
+          </span>
+        )}
+      </div>
+      {error && <p className="text-xs text-red-500 px-2">{error}</p>}
+      <Plot
+        data={plotData}
+        layout={{ showlegend: true, legend: { orientation: 'h' }, margin: { l: 30, r: 10, t: 10, b: 30 } }}
+        useResizeHandler={true}
+        style={{ width: '100%', height: '100%' }}
+      />
+    </div>
+  );
+};
@@ -1,10 +1,16 @@
 // Code generated by tygo. DO NOT EDIT.
+import { Coordinate, Projection } from './similarity';
+import { Clustering, Dendrogram } from './cluster';
 
 //////////
 // source: alerts.go
 
+export interface KibanaWatcherLogCondition {
+  met: boolean;
+}
 export interface KibanaWatcherLogResult {
   execution_time: string;
+  condition: KibanaWatcherLogCondition;
 }
 export interface KibanaWatcherLogSource {
   result: KibanaWatcherLogResult;
@@ -18,6 +24,200 @@ export interface KibanaWatcherLog {
 }
 export type KibanaWatcherLogs = (KibanaWatcherLog | undefined)[];
 
+//////////
+// source: clusters.go
+
+/**
+ * KibanaCluster describes a cluster well enough to label it: its most
+ * central errorMessage, the tokens which set it apart from the other
+ * clusters, what it involves and when it was seen.
+ */
+export interface KibanaCluster {
+  id: number /* int */;
+  size: number /* int */;
+  unique: number /* int */;
+  medoid: string;
+  tokens: string[];
+  microservices: { [key: string]: number /* int */};
+  messages: { [key: string]: number /* int */};
+  environments: { [key: string]: number /* int */};
+  firstSeen: string;
+  lastSeen: string;
+}
+export interface KibanaClusters {
+  clustering: Clustering;
+  clusters: KibanaCluster[];
+  outliers: number /* int */;
+}
+/**
+ * KibanaDendrogram holds the agglomerative clustering of the unique logs
+ * along with the leaf each log belongs to, in the order of the coordinates
+ * file.
+ */
+export interface KibanaDendrogram {
+  dendrogram?: Dendrogram;
+  leaves: number /* int */[];
+}
+export interface KibanaClusterCut {
+  threshold: number /* float64 */;
+  count: number /* int */;
+  clusters: KibanaCluster[];
+  logs: { [key: string]: number /* int */};
+}
+/**
+ * clusterTokens is how many distinguishing tokens label each cluster.
+ */
+
+//////////
+// source: cooccurrence.go
+
+/**
+ * KibanaCoOccurrence is how often an error of one message code or
+ * microservice, A, is followed within the window by an error of another,
+ * B. Count is the errors of A with one of B within the window either side,
+ * Support their share of all logs and Confidence their share of A's logs.
+ * Lift compares Confidence with the chance of one of B falling that close
+ * if B's errors were scattered at random, and Lag is the median time from
+ * each error of A to the nearest of B, in seconds, with LagSpread the
+ * median distance of the lags from it.
+ */
+export interface KibanaCoOccurrence {
+  dimension: string;
+  a: string;
+  b: string;
+  countA: number /* int */;
+  countB: number /* int */;
+  count: number /* int */;
+  support: number /* float64 */;
+  confidence: number /* float64 */;
+  lift: number /* float64 */;
+  lag: number /* float64 */;
+  lagSpread: number /* float64 */;
+}
+/**
+ * KibanaCoOccurrences lists the pairs at or above the minimum count and
+ * lift where B follows A, highest lift first. Skipped counts the logs left
+ * out because their timestamp does not parse.
+ */
+export interface KibanaCoOccurrences {
+  window: string;
+  minCount: number /* int */;
+  minLift: number /* float64 */;
+  logs: number /* int */;
+  skipped: number /* int */;
+  pairs: KibanaCoOccurrence[];
+}
+
+//////////
+// source: coverage.go
+
+/**
+ * KibanaBurst is a burst of errors of one message code which no watch
+ * covering that code fired for.
+ */
+export interface KibanaBurst {
+  message: string;
+  start: string;
+  end: string;
+  size: number /* int */;
+  peakRate: number /* int */;
+  watches: string[];
+  representative: string;
+  representativeId: string;
+}
+/**
+ * KibanaUnmatchedFire is a watcher fire with no burst of the message codes
+ * it covers nearby. NearbyLogs counts the logs of those codes which were
+ * nearby, too few to make a burst.
+ */
+export interface KibanaUnmatchedFire {
+  id: string;
+  watchId: string;
+  time: string;
+  messages: string[];
+  nearbyLogs: number /* int */;
+}
+/**
+ * KibanaCodeCoverage is the share of a message code's bursts which a watch
+ * covering the code fired for. A code no watch covers has no Watches, and
+ * codes whose logs made no burst come last.
+ */
+export interface KibanaCodeCoverage {
+  message: string;
+  watches: string[];
+  logs: number /* int */;
+  bursts: number /* int */;
+  covered: number /* int */;
+  coverage: number /* float64 */;
+}
+/**
+ * KibanaWatchCoverage is the share of a watch's fires with a burst of one
+ * of its message codes nearby. Watches covering no code cannot be matched
+ * and are counted as unmapped.
+ */
+export interface KibanaWatchCoverage {
+  watchId: string;
+  messages: string[];
+  unmapped: boolean;
+  fires: number /* int */;
+  matched: number /* int */;
+  coverage: number /* float64 */;
+}
+/**
+ * KibanaAlertCoverage compares the error bursts of each message code with
+ * the fires of the watches covering it in WatcherErrorMapping, over the
+ * period both the errors and the watcher executions span. A burst and a
+ * fire are nearby when they are no more than Window apart. Skipped counts
+ * the logs left out because their timestamp does not parse.
+ */
+export interface KibanaAlertCoverage {
+  from: string;
+  to: string;
+  gap: string;
+  minLogs: number /* int */;
+  window: string;
+  skipped: number /* int */;
+  bursts: number /* int */;
+  covered: number /* int */;
+  coverage: number /* float64 */;
+  fires: number /* int */;
+  matched: number /* int */;
+  precision: number /* float64 */;
+  codes: KibanaCodeCoverage[];
+  watches: KibanaWatchCoverage[];
+  uncovered: KibanaBurst[];
+  unmatched: KibanaUnmatchedFire[];
+}
+
+//////////
+// source: duplicates.go
+
+/**
+ * duplicatePairLimit caps how many candidate pairs are written out, most
+ * similar first.
+ */
+export interface KibanaDuplicateGroup {
+  size: number /* int */;
+  message: string;
+  microservices: { [key: string]: number /* int */};
+  ids: string[];
+}
+export interface KibanaDuplicatePair {
+  a: string;
+  b: string;
+  jaccard: number /* float64 */;
+}
+/**
+ * KibanaNearDuplicates lists the groups of logs whose normalised messages
+ * are near duplicates by MinHash, and candidate pairs of distinct logs with
+ * their estimated Jaccard similarity.
+ */
+export interface KibanaNearDuplicates {
+  threshold: number /* float64 */;
+  groups: KibanaDuplicateGroup[];
+  pairs: KibanaDuplicatePair[];
+}
+
 //////////
 // source: errors.go
 
@@ -36,17 +236,150 @@ export interface KibanaErrorLog {
   _source: KibanaErrorLogSource;
   sort: any[];
   coordinates: KibanaLogCoordinates;
+  cluster: KibanaLogCluster;
+  fingerprint: string;
 }
 export interface KibanaLogErrorComparable {
   KibanaErrorLog?: KibanaErrorLog;
 }
 export type KibanaErrorLogs = (KibanaErrorLog | undefined)[];
 
+//////////
+// source: fingerprints.go
+
+export const TrendNew = "new";
+export const TrendRegressed = "regressed";
+export const TrendGrowing = "growing";
+export const TrendShrinking = "shrinking";
+export const TrendResolved = "resolved";
+export const TrendStable = "stable";
+export interface KibanaFingerprint {
+  template: string;
+  message: string;
+  microservice: string;
+}
+/**
+ * KibanaFingerprintRun is the number of logs with each fingerprint in one
+ * dataset, identified by a hash of its log IDs so that rerunning the latest
+ * dataset replaces its counts rather than adding them again.
+ */
+export interface KibanaFingerprintRun {
+  dataset: string;
+  time: string;
+  from: string;
+  to: string;
+  logs: number /* int */;
+  counts: { [key: string]: number /* int */};
+}
+/**
+ * KibanaFingerprintHistory holds the runs of a pipeline oldest first and
+ * what each fingerprint stands for.
+ */
+export interface KibanaFingerprintHistory {
+  fingerprints: { [key: string]: KibanaFingerprint};
+  runs: KibanaFingerprintRun[];
+}
+export interface KibanaTrend {
+  fingerprint: string;
+  KibanaFingerprint: KibanaFingerprint;
+  status: string;
+  count: number /* int */;
+  previousCount: number /* int */;
+  change: number /* float64 */;
+  lastSeen?: string;
+}
+/**
+ * KibanaTrends compares the fingerprint counts of a run with the run
+ * before it. Change is the relative change in count, and LastSeen the
+ * latest earlier run a regressed fingerprint appeared in.
+ */
+export interface KibanaTrends {
+  dataset: string;
+  previous?: string;
+  summary: { [key: string]: number /* int */};
+  trends: KibanaTrend[];
+}
+
+//////////
+// source: incidents.go
+
+export const IncidentSplitNone = "";
+export const IncidentSplitCluster = "cluster";
+export const IncidentSplitMicroservice = "microservice";
+/**
+ * alertWindow is how far a watcher fire may be from an incident to have
+ * fired during it, matching the window watcher fires are linked to logs in.
+ */
+export interface KibanaIncidentAlert {
+  id: string;
+  watchId: string;
+  time: string;
+  /**
+   * Mapped is whether the watch covers one of the incident's message
+   * codes in WatcherErrorMapping.
+   */
+  mapped: boolean;
+}
+/**
+ * KibanaIncident is a burst of errors with no gap longer than the
+ * configured one, lasting Duration seconds. PeakRate is the most logs in
+ * any one minute, and Representative the errorMessage of its most common
+ * fingerprint.
+ */
+export interface KibanaIncident {
+  id: number /* int */;
+  key?: string;
+  start: string;
+  end: string;
+  duration: number /* float64 */;
+  size: number /* int */;
+  peakRate: number /* int */;
+  microservices: { [key: string]: number /* int */};
+  messages: { [key: string]: number /* int */};
+  clusters: { [key: string]: number /* int */};
+  representative: string;
+  representativeId: string;
+  alerts: KibanaIncidentAlert[];
+  ids: string[];
+}
+/**
+ * KibanaIncidents lists the incidents oldest first. When Split is set,
+ * logs are first divided by cluster or microservice and each incident
+ * belongs to one of them, named by its Key. Skipped counts the logs left
+ * out because their timestamp does not parse.
+ */
+export interface KibanaIncidents {
+  gap: string;
+  split?: string;
+  minLogs: number /* int */;
+  alerts: boolean;
+  skipped: number /* int */;
+  incidents: KibanaIncident[];
+}
+/**
+ * timedLog is a log with its parsed timestamp.
+ */
+/**
+ * watcherFire is a watcher execution with its parsed time.
+ */
+
 //////////
 // source: kibana.go
 
 export interface KibanaLogCoordinates {
-  error: any /* similarity.Coordinate */;
+  error: Coordinate;
+}
+export interface KibanaLogCluster {
+  id: number /* int */;
+  outlier: boolean;
+}
+export interface KibanaAnalysis {
+  metric: string;
+  weights?: { [key: string]: number /* float64 */};
+  projection: Projection;
+  clustering: Clustering;
+  clusters: KibanaCluster[];
+  logs: KibanaErrorLogs;
 }
 export interface KibanaLog {
   _id: string;
@@ -67,3 +400,170 @@ export interface KibanaClient {
   Username: string;
   Password: string;
 }
+
+//////////
+// source: noise.go
+
+/**
+ * KibanaWatchNoise measures how much one watch fires and how little each
+ * fire tells. Flaps counts the executions whose condition differed from
+ * the one before, and FlapRate their share of the chances to, so a watch
+ * alternating between met and not met every time scores one. Linked counts
+ * the fires whose watcher error log is a real log rather than a stand in,
+ * and ClusterShare is the share of those in the watch's most common
+ * cluster, DominantCluster, which is -1 when none of them is clustered.
+ * MeanTimeBetweenFires is in seconds.
+ */
+export interface KibanaWatchNoise {
+  watchId: string;
+  executions: number /* int */;
+  fires: number /* int */;
+  firesPerDay: number /* float64 */;
+  meanTimeBetweenFires: number /* float64 */;
+  flaps: number /* int */;
+  flapRate: number /* float64 */;
+  linked: number /* int */;
+  linkedShare: number /* float64 */;
+  dominantCluster: number /* int */;
+  clusterShare: number /* float64 */;
+  noise: number /* float64 */;
+}
+/**
+ * KibanaWatcherNoise ranks the watches noisiest first by
+ * FiresPerDay × (1 + FlapRate + (1 - LinkedShare) + ClusterShare), so a
+ * watch which fires often counts for more the more it flaps, the fewer of
+ * its fires lead to a log and the more they repeat one kind of error.
+ * Without the full execution History only fires are known and no watch
+ * flaps.
+ */
+export interface KibanaWatcherNoise {
+  from: string;
+  to: string;
+  days: number /* float64 */;
+  history: boolean;
+  watches: KibanaWatchNoise[];
+}
+
+//////////
+// source: novelty.go
+
+/**
+ * KibanaNovelPattern is a group of new logs which are close to each other
+ * but further than the novelty threshold from every reference log. Novelty
+ * is the smallest distance from any of its logs to a reference log, and
+ * Nearest the reference log that comes closest. Coordinate places its
+ * medoid into the saved embedding when there is one.
+ */
+export interface KibanaNovelPattern {
+  KibanaCluster: KibanaCluster;
+  novelty: number /* float64 */;
+  nearestId: string;
+  nearestMessage: string;
+  nearestCluster: number /* int */;
+  coordinate?: Coordinate;
+  ids: string[];
+}
+/**
+ * KibanaNovelty ranks the new error patterns of a batch of logs against a
+ * reference dataset, largest first, and gives the distance from each new
+ * log to its nearest reference log.
+ */
+export interface KibanaNovelty {
+  metric: string;
+  threshold: number /* float64 */;
+  reference: number /* int */;
+  batch: number /* int */;
+  novel: number /* int */;
+  patterns: KibanaNovelPattern[];
+  distances: { [key: string]: number /* float64 */};
+}
+
+//////////
+// source: similar.go
+
+/**
+ * KibanaSimilarError is a historical error close to a query. Logs identical
+ * under the metric are reported once, by the most recent of them, with how
+ * many there were and when they were first and last seen.
+ */
+export interface KibanaSimilarError {
+  id: string;
+  score: number /* float64 */;
+  distance: number /* float64 */;
+  errorMessage: string;
+  message: string;
+  microservice: string;
+  timestamp: string;
+  cluster: number /* int */;
+  count: number /* int */;
+  microservices: { [key: string]: number /* int */};
+  firstSeen: string;
+  lastSeen: string;
+}
+export interface KibanaSimilarErrors {
+  metric: string;
+  query: string;
+  id?: string;
+  matches: KibanaSimilarError[];
+}
+
+//////////
+// source: timeseries.go
+
+export const DimensionMessage = "message";
+export const DimensionMicroservice = "microservice";
+export const DimensionCluster = "cluster";
+/**
+ * maxTimeSeriesBuckets caps the buckets a time series may span, so that a
+ * short interval over a long period is rejected rather than allocated.
+ */
+/**
+ * KibanaSeries is the number of logs in each bucket for one message code,
+ * microservice or cluster, with the baseline median and robust z-score each
+ * count was compared with, null for buckets with too little history to be
+ * scored, and the buckets which spiked.
+ */
+export interface KibanaSeries {
+  dimension: string;
+  key: string;
+  total: number /* int */;
+  counts: number /* float64 */[];
+  baselines: (number /* float64 */ | undefined)[];
+  scores: (number /* float64 */ | undefined)[];
+  spikes: number /* int */[];
+}
+export interface KibanaSpike {
+  dimension: string;
+  key: string;
+  start: string;
+  count: number /* float64 */;
+  baseline: number /* float64 */;
+  score: number /* float64 */;
+}
+/**
+ * KibanaTimeSeries buckets logs by time, starting each bucket at the
+ * matching entry of Buckets, and lists every spike highest score first.
+ * Skipped counts the logs left out because their timestamp does not parse.
+ */
+export interface KibanaTimeSeries {
+  interval: string;
+  baseline: string;
+  window: number /* int */;
+  season?: string;
+  threshold: number /* float64 */;
+  skipped: number /* int */;
+  buckets: string[];
+  series: KibanaSeries[];
+  spikes: KibanaSpike[];
+}
+/**
+ * KibanaTimeSeriesLog is the part of a log its time series is counted
+ * from, which the client sends for the analysis it has loaded.
+ */
+export interface KibanaTimeSeriesLog {
+  id: string;
+  timestamp: string;
+  message: string;
+  microservice: string;
+  cluster: number /* int */;
+}
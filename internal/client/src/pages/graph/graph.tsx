@@ -1,21 +1,25 @@
 import React, { useCallback, useEffect, useMemo, useRef, useState } from 'react';
 import { LogFieldSelectors, LogFieldSelectorsActive } from '../../models/models';
-import { KibanaErrorLog } from '../../models/kibana';
-import { Data, Datum, Layout, PlotSelectionEvent, PlotType } from 'plotly.js';
+import { KibanaAnalysis, KibanaErrorLog } from '../../models/kibana';
+import { Data, Datum, Layout, PlotMouseEvent, PlotSelectionEvent, PlotType } from 'plotly.js';
 import { Controls } from '../../components/controls/controls';
 import Plot from 'react-plotly.js';
 import { Selected } from '../../components/selected/selected';
+import { clusterColour, Legend } from '../../components/legend/legend';
+import { TimeSeries } from '../../components/timeseries/timeseries';
 
 type LogSelector = (log: KibanaErrorLog) => string;
 
 type PlotData = {
   x: number[];
   y: number[];
+  z?: number[];
   text: string[];
   customdata: Datum[];
   mode: 'markers';
   type: PlotType;
   hoverinfo: 'text';
+  marker: { color: string[] };
 };
 
 const logSelectors: { [K in LogFieldSelectors]: LogSelector } = {
@@ -26,6 +30,29 @@ const logSelectors: { [K in LogFieldSelectors]: LogSelector } = {
     `<br>${log._source.errorMessage.replace(new RegExp(`(.{1,${50}})(\\s+|$)`, 'g'), '$1<br>')}<br>`,
 };
 
+const axisTitle = (analysis: KibanaAnalysis, axis: number) => {
+  const explained = analysis.projection.varianceExplained[axis];
+  return explained ? `${(explained * 100).toFixed(1)}%` : '';
+};
+
+const diagnosticsSummary = (analysis: KibanaAnalysis) => {
+  const diagnostics = analysis.projection.diagnostics;
+  if (!diagnostics || !diagnostics.sample) {
+    return '';
+  }
+  const explained = analysis.projection.varianceExplained.reduce((total, v) => total + v, 0);
+  const parts = [
+    `stress ${diagnostics.stress.toFixed(3)}`,
+    `trustworthiness ${diagnostics.trustworthiness.toFixed(3)}`,
+    `continuity ${diagnostics.continuity.toFixed(3)} at k=${diagnostics.neighbours}`,
+  ];
+  if (analysis.projection.method.endsWith('mds')) {
+    parts.push(`${(explained * 100).toFixed(1)}% variance explained`);
+    parts.push(`${(diagnostics.negativeMass * 100).toFixed(1)}% negative eigenvalue mass`);
+  }
+  return `${parts.join(', ')} over ${diagnostics.sample} unique logs`;
+};
+
 const getDate = (d: Date) => {
   return new Intl.DateTimeFormat('en-CA', {
     year: 'numeric',
@@ -34,7 +61,8 @@ const getDate = (d: Date) => {
   }).format(d);
 };
 
-export const Graph: React.FC<{ logs: KibanaErrorLog[]; clearLogs: () => void }> = ({ logs, clearLogs }) => {
+export const Graph: React.FC<{ analysis: KibanaAnalysis; clearLogs: () => void }> = ({ analysis, clearLogs }) => {
+  const logs = useMemo(() => analysis.logs.flatMap((log) => (log ? [log] : [])), [analysis]);
   const [selectors, setSelectors] = useState<LogFieldSelectorsActive>({
     id: true,
     microservice: false,
@@ -63,43 +91,57 @@ export const Graph: React.FC<{ logs: KibanaErrorLog[]; clearLogs: () => void }>
     );
   }, [logs, filters]);
 
+  const is3D = analysis.projection.dims >= 3;
+
   const plotData: Data[] = useMemo(() => {
     const d: PlotData = {
       x: [],
       y: [],
+      z: is3D ? [] : undefined,
       text: [],
       customdata: [],
       mode: 'markers',
-      type: 'scatter',
+      type: is3D ? 'scatter3d' : 'scatter',
       hoverinfo: 'text',
+      marker: { color: [] },
     };
     for (let i = 0; i < filteredLogs.length; i++) {
       const log = filteredLogs[i];
-      d.x.push(log.coordinates.error.X);
-      d.y.push(log.coordinates.error.Y);
+      d.x.push(log.coordinates.error[0]);
+      d.y.push(log.coordinates.error[1] ?? 0);
+      d.z?.push(log.coordinates.error[2] ?? 0);
       d.text.push(
         Object.entries(selectors)
           .flatMap(([f, a]) => (a ? logSelectors[f as LogFieldSelectors](log) : []))
           .join('<br>')
       );
+      d.marker.color.push(clusterColour(log));
       d.customdata.push(i);
     }
     return [d];
-  }, [selectors, filteredLogs]);
+  }, [selectors, filteredLogs, is3D]);
 
   const plotLayout: Partial<Layout> = useMemo(() => {
+    const axis = (i: number) => ({
+      title: { text: axisTitle(analysis, i) },
+      showticklabels: false,
+      zeroline: false,
+    });
+    if (is3D) {
+      return {
+        scene: {
+          xaxis: axis(0),
+          yaxis: axis(1),
+          zaxis: axis(2),
+        },
+      };
+    }
     return {
       dragmode: 'select',
-      xaxis: {
-        showticklabels: false,
-        zeroline: false,
-      },
-      yaxis: {
-        showticklabels: false,
-        zeroline: false,
-      },
+      xaxis: axis(0),
+      yaxis: axis(1),
     };
-  }, []);
+  }, [analysis, is3D]);
 
   const handleSelectorToggled = useCallback((name: LogFieldSelectors, checked: boolean) => {
     setSelectors((s) => ({ ...s, [name]: checked }));
@@ -125,6 +167,24 @@ export const Graph: React.FC<{ logs: KibanaErrorLog[]; clearLogs: () => void }>
     [filteredLogs]
   );
 
+  // Box select is not available in 3D, so points are picked by clicking.
+  const handleClick = useCallback(
+    (event: Readonly<PlotMouseEvent>) => {
+      if (!is3D) {
+        return;
+      }
+      setSelected(event.points.flatMap((p) => (typeof p.customdata === 'number' ? filteredLogs[p.customdata] : [])));
+    },
+    [filteredLogs, is3D]
+  );
+
+  const handleClusterSelected = useCallback(
+    (id: number) => {
+      setSelected(filteredLogs.filter((log) => log.cluster.id === id));
+    },
+    [filteredLogs]
+  );
+
   const handleDeselect = useCallback(() => {
     setSelected([]);
   }, []);
@@ -140,22 +200,33 @@ export const Graph: React.FC<{ logs: KibanaErrorLog[]; clearLogs: () => void }>
       <div className="w-full flex flex-col">
         <div className="flex justify-between align-items px-5">
           <h2>
-            {filteredLogs.length} of {logs.length} Logs
+            {filteredLogs.length} of {logs.length} Logs ({analysis.metric}, {analysis.projection.method}
+            {analysis.clustering.method &&
+              `, ${analysis.clustering.clusters} ${analysis.clustering.method} clusters, ${analysis.clustering.outliers} outliers`}
+            {analysis.projection.alignment &&
+              `, aligned with residual ${analysis.projection.alignment.residual.toPrecision(3)}`}
+            )
           </h2>
+          <p className="text-xs self-center">{diagnosticsSummary(analysis)}</p>
           <button className="cursor-pointer border px-1" onClick={clearLogs}>
             Eject File
           </button>
         </div>
-        <Plot
-          data={plotData}
-          layout={plotLayout}
-          onSelecting={handleSelecting}
-          onDeselect={handleDeselect}
-          useResizeHandler={true}
-          style={{ width: '100%', height: '100%' }}
-        />
+        <div className="flex flex-1 min-h-0">
+          <Plot
+            data={plotData}
+            layout={plotLayout}
+            onSelecting={handleSelecting}
+            onClick={handleClick}
+            onDeselect={handleDeselect}
+            useResizeHandler={true}
+            style={{ width: '100%', height: '100%' }}
+          />
+          <TimeSeries logs={logs} />
+        </div>
+        <Legend clusters={analysis.clusters} onClusterSelected={handleClusterSelected} />
       </div>
-      <Selected selecting={selecting} selectors={selectors} logs={selected} />
+      <Selected selecting={selecting} selectors={selectors} logs={selected} clusters={analysis.clusters} />
     </div>
   );
 };
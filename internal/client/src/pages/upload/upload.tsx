@@ -1,7 +1,34 @@
 import { ChangeEvent, useCallback } from 'react';
-import { KibanaErrorLog } from '../../models/kibana';
+import { KibanaAnalysis } from '../../models/kibana';
 
-export const Upload: React.FC<{ setLogs: (logs: KibanaErrorLog[]) => void }> = ({ setLogs }) => {
+type LegacyCoordinate = { X: number; Y: number };
+
+// Files generated before the metric was recorded are a bare array of logs,
+// files generated before N-dimensional coordinates hold an X/Y object, and
+// files generated before clustering have no cluster on each log.
+const parseAnalysis = (raw: string): KibanaAnalysis => {
+  const parsed = JSON.parse(raw);
+  const analysis: KibanaAnalysis = Array.isArray(parsed)
+    ? { metric: 'levenshtein', projection: { method: 'classical-mds', dims: 2, varianceExplained: [] }, logs: parsed }
+    : parsed;
+  analysis.projection.dims = analysis.projection.dims || 2;
+  analysis.projection.varianceExplained = analysis.projection.varianceExplained || [];
+  analysis.clustering = analysis.clustering || { method: '', space: '', clusters: 0, outliers: 0 };
+  analysis.clusters = analysis.clusters || [];
+  for (const log of analysis.logs) {
+    if (log && !log.cluster) {
+      log.cluster = { id: -1, outlier: false };
+    }
+    const coord: unknown = log?.coordinates.error;
+    if (log && coord && !Array.isArray(coord)) {
+      const legacy = coord as LegacyCoordinate;
+      log.coordinates.error = [legacy.X, legacy.Y];
+    }
+  }
+  return analysis;
+};
+
+export const Upload: React.FC<{ setAnalysis: (analysis: KibanaAnalysis) => void }> = ({ setAnalysis }) => {
   const handleFileInput = useCallback(
     (ev: ChangeEvent<HTMLInputElement>) => {
       const files = ev.target.files;
@@ -14,11 +41,11 @@ export const Upload: React.FC<{ setLogs: (logs: KibanaErrorLog[]) => void }> = (
       }
       const reader = new FileReader();
       reader.onload = (pe) => {
-        setLogs(JSON.parse(`${pe.target?.result}`));
+        setAnalysis(parseAnalysis(`${pe.target?.result}`));
       };
       reader.readAsText(file);
     },
-    [setLogs]
+    [setAnalysis]
   );
 
   return (
@@ -1,4 +1,11 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {kibana} from '../models';
+
+export function FindSimilarErrors(arg1:string,arg2:string,arg3:number):Promise<kibana.KibanaSimilarErrors>;
+
+export function GetErrorClusters(arg1:number,arg2:number):Promise<kibana.KibanaClusterCut>;
+
+export function GetErrorTimeSeries(arg1:Array<kibana.KibanaTimeSeriesLog>,arg2:string):Promise<kibana.KibanaTimeSeries>;
 
 export function Greet(arg1:string):Promise<string>;
@@ -2,6 +2,18 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function FindSimilarErrors(arg1, arg2, arg3) {
+  return window['go']['handler']['Handler']['FindSimilarErrors'](arg1, arg2, arg3);
+}
+
+export function GetErrorClusters(arg1, arg2) {
+  return window['go']['handler']['Handler']['GetErrorClusters'](arg1, arg2);
+}
+
+export function GetErrorTimeSeries(arg1, arg2) {
+  return window['go']['handler']['Handler']['GetErrorTimeSeries'](arg1, arg2);
+}
+
 export function Greet(arg1) {
   return window['go']['handler']['Handler']['Greet'](arg1);
 }
@@ -0,0 +1,251 @@
+export namespace kibana {
+	
+	export class KibanaCluster {
+	    id: number;
+	    size: number;
+	    unique: number;
+	    medoid: string;
+	    tokens: string[];
+	    microservices: {[key: string]: number};
+	    messages: {[key: string]: number};
+	    environments: {[key: string]: number};
+	    firstSeen: string;
+	    lastSeen: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaCluster(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.size = source["size"];
+	        this.unique = source["unique"];
+	        this.medoid = source["medoid"];
+	        this.tokens = source["tokens"];
+	        this.microservices = source["microservices"];
+	        this.messages = source["messages"];
+	        this.environments = source["environments"];
+	        this.firstSeen = source["firstSeen"];
+	        this.lastSeen = source["lastSeen"];
+	    }
+	}
+	export class KibanaClusterCut {
+	    threshold: number;
+	    count: number;
+	    clusters: KibanaCluster[];
+	    logs: {[key: string]: number};
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaClusterCut(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.threshold = source["threshold"];
+	        this.count = source["count"];
+	        this.clusters = this.convertValues(source["clusters"], KibanaCluster);
+	        this.logs = source["logs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class KibanaSeries {
+	    dimension: string;
+	    key: string;
+	    total: number;
+	    counts: number[];
+	    baselines: number[];
+	    scores: number[];
+	    spikes: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaSeries(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dimension = source["dimension"];
+	        this.key = source["key"];
+	        this.total = source["total"];
+	        this.counts = source["counts"];
+	        this.baselines = source["baselines"];
+	        this.scores = source["scores"];
+	        this.spikes = source["spikes"];
+	    }
+	}
+	export class KibanaSimilarError {
+	    id: string;
+	    score: number;
+	    distance: number;
+	    errorMessage: string;
+	    message: string;
+	    microservice: string;
+	    timestamp: string;
+	    cluster: number;
+	    count: number;
+	    microservices: {[key: string]: number};
+	    firstSeen: string;
+	    lastSeen: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaSimilarError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.score = source["score"];
+	        this.distance = source["distance"];
+	        this.errorMessage = source["errorMessage"];
+	        this.message = source["message"];
+	        this.microservice = source["microservice"];
+	        this.timestamp = source["timestamp"];
+	        this.cluster = source["cluster"];
+	        this.count = source["count"];
+	        this.microservices = source["microservices"];
+	        this.firstSeen = source["firstSeen"];
+	        this.lastSeen = source["lastSeen"];
+	    }
+	}
+	export class KibanaSimilarErrors {
+	    metric: string;
+	    query: string;
+	    id?: string;
+	    matches: KibanaSimilarError[];
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaSimilarErrors(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.metric = source["metric"];
+	        this.query = source["query"];
+	        this.id = source["id"];
+	        this.matches = this.convertValues(source["matches"], KibanaSimilarError);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class KibanaSpike {
+	    dimension: string;
+	    key: string;
+	    start: string;
+	    count: number;
+	    baseline: number;
+	    score: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaSpike(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dimension = source["dimension"];
+	        this.key = source["key"];
+	        this.start = source["start"];
+	        this.count = source["count"];
+	        this.baseline = source["baseline"];
+	        this.score = source["score"];
+	    }
+	}
+	export class KibanaTimeSeries {
+	    interval: string;
+	    baseline: string;
+	    window: number;
+	    season?: string;
+	    threshold: number;
+	    buckets: string[];
+	    series: KibanaSeries[];
+	    spikes: KibanaSpike[];
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaTimeSeries(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.interval = source["interval"];
+	        this.baseline = source["baseline"];
+	        this.window = source["window"];
+	        this.season = source["season"];
+	        this.threshold = source["threshold"];
+	        this.buckets = source["buckets"];
+	        this.series = this.convertValues(source["series"], KibanaSeries);
+	        this.spikes = this.convertValues(source["spikes"], KibanaSpike);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class KibanaTimeSeriesLog {
+	    id: string;
+	    timestamp: string;
+	    message: string;
+	    microservice: string;
+	    cluster: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new KibanaTimeSeriesLog(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.timestamp = source["timestamp"];
+	        this.message = source["message"];
+	        this.microservice = source["microservice"];
+	        this.cluster = source["cluster"];
+	    }
+	}
+
+}
+
@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// Agglomerate builds the dendrogram of n weighted points from their
+// distance matrix, which it overwrites, using the nearest-neighbour chain
+// algorithm in O(n²) time. Weights count as repeated points, so average and
+// Ward linkage give the same tree as clustering every copy. No points give
+// an empty dendrogram and one point a dendrogram with no merges.
+func Agglomerate(D *similarity.SymMatrix, weights []float64, linkage Linkage) (*Dendrogram, error) {
+	update, err := lanceWilliams(linkage)
+	if err != nil {
+		return nil, err
+	}
+	n := D.SymmetricDim()
+	if n == 0 {
+		return &Dendrogram{Linkage: linkage, Weights: []float64{}, Merges: []Merge{}}, nil
+	}
+	size := append([]float64{}, weights...)
+	if linkage == LinkageWard {
+		// Ward distance between clusters A and B is
+		// sqrt(2|A||B|/(|A|+|B|))·|centre(A)-centre(B)|, which for weighted
+		// points differs from their plain distance.
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				D.Set(i, j, D.At(i, j)*math.Sqrt(2*size[i]*size[j]/(size[i]+size[j])))
+			}
+		}
+	}
+	active := make([]bool, n)
+	for i := range active {
+		active[i] = true
+	}
+
+	// Merges are first recorded between slots, each slot standing for the
+	// cluster it was last merged into.
+	merges := make([]Merge, 0, max(n-1, 0))
+	chain := make([]int, 0, n)
+	next := 0
+	for len(merges) < n-1 {
+		if len(chain) == 0 {
+			for !active[next] {
+				next++
+			}
+			chain = append(chain, next)
+		}
+		for {
+			a := chain[len(chain)-1]
+			b, best := -1, math.Inf(1)
+			if len(chain) > 1 {
+				// Preferring the previous link on ties stops the chain
+				// from cycling.
+				b = chain[len(chain)-2]
+				best = D.At(a, b)
+			}
+			for k := 0; k < n; k++ {
+				if k != a && active[k] && D.At(a, k) < best {
+					b, best = k, D.At(a, k)
+				}
+			}
+			if len(chain) > 1 && b == chain[len(chain)-2] {
+				break
+			}
+			chain = append(chain, b)
+		}
+
+		a, b := chain[len(chain)-1], chain[len(chain)-2]
+		chain = chain[:len(chain)-2]
+		dab := D.At(a, b)
+		for k := 0; k < n; k++ {
+			if k != a && k != b && active[k] {
+				D.Set(k, b, update(D.At(k, a), D.At(k, b), dab, size[a], size[b], size[k]))
+			}
+		}
+		merges = append(merges, Merge{Left: a, Right: b, Distance: dab, Size: size[a] + size[b]})
+		size[b] += size[a]
+		active[a] = false
+		if len(merges)%max(n/10, 1) == 0 {
+			log.Printf("%d of %d merges...", len(merges), n-1)
+		}
+	}
+
+	sort.SliceStable(merges, func(i, j int) bool {
+		return merges[i].Distance < merges[j].Distance
+	})
+	uf := newUnionFind(2*n - 1)
+	for k := range merges {
+		node := n + k
+		a, b := uf.find(merges[k].Left), uf.find(merges[k].Right)
+		merges[k].Left, merges[k].Right = min(a, b), max(a, b)
+		uf.parent[a], uf.parent[b] = node, node
+	}
+	return &Dendrogram{
+		Linkage: linkage,
+		Weights: weights,
+		Merges:  merges,
+	}, nil
+}
+
+// lanceWilliams returns the distance from cluster k to the union of i and j
+// for each linkage, given the distances before the merge.
+func lanceWilliams(linkage Linkage) (func(dki, dkj, dij, si, sj, sk float64) float64, error) {
+	switch linkage {
+	case LinkageSingle:
+		return func(dki, dkj, dij, si, sj, sk float64) float64 {
+			return math.Min(dki, dkj)
+		}, nil
+	case LinkageComplete:
+		return func(dki, dkj, dij, si, sj, sk float64) float64 {
+			return math.Max(dki, dkj)
+		}, nil
+	case LinkageAverage:
+		return func(dki, dkj, dij, si, sj, sk float64) float64 {
+			return (si*dki + sj*dkj) / (si + sj)
+		}, nil
+	case LinkageWard:
+		return func(dki, dkj, dij, si, sj, sk float64) float64 {
+			v := ((si+sk)*dki*dki + (sj+sk)*dkj*dkj - sk*dij*dij) / (si + sj + sk)
+			return math.Sqrt(math.Max(v, 0))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown linkage '%s', expected one of %s", linkage, strings.Join(Linkages, ", "))
+}
+
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+	}
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
+	}
+	return i
+}
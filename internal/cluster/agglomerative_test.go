@@ -0,0 +1,175 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// bruteForce merges the two closest clusters at a time, measuring linkage
+// from the points of each cluster directly.
+func bruteForce(points [][2]float64, linkage Linkage) ([]float64, [][]int) {
+	dist := func(i, j int) float64 {
+		return math.Hypot(points[i][0]-points[j][0], points[i][1]-points[j][1])
+	}
+	linkageDistance := func(a, b []int) float64 {
+		switch linkage {
+		case LinkageSingle:
+			d := math.Inf(1)
+			for _, i := range a {
+				for _, j := range b {
+					d = math.Min(d, dist(i, j))
+				}
+			}
+			return d
+		case LinkageComplete:
+			d := 0.0
+			for _, i := range a {
+				for _, j := range b {
+					d = math.Max(d, dist(i, j))
+				}
+			}
+			return d
+		}
+		var d float64
+		for _, i := range a {
+			for _, j := range b {
+				d += dist(i, j)
+			}
+		}
+		return d / float64(len(a)*len(b))
+	}
+
+	clusters := make([][]int, len(points))
+	for i := range clusters {
+		clusters[i] = []int{i}
+	}
+	heights := []float64{}
+	// partitions[k] labels the points after k merges.
+	partitions := [][]int{labelsOf(clusters, len(points))}
+	for len(clusters) > 1 {
+		ba, bb, best := 0, 1, math.Inf(1)
+		for a := range clusters {
+			for b := a + 1; b < len(clusters); b++ {
+				if d := linkageDistance(clusters[a], clusters[b]); d < best {
+					ba, bb, best = a, b, d
+				}
+			}
+		}
+		clusters[ba] = append(clusters[ba], clusters[bb]...)
+		clusters = append(clusters[:bb], clusters[bb+1:]...)
+		heights = append(heights, best)
+		partitions = append(partitions, labelsOf(clusters, len(points)))
+	}
+	return heights, partitions
+}
+
+func labelsOf(clusters [][]int, n int) []int {
+	labels := make([]int, n)
+	for c, members := range clusters {
+		for _, i := range members {
+			labels[i] = c
+		}
+	}
+	return labels
+}
+
+// samePartition reports whether two labellings group points identically.
+func samePartition(a, b []int) bool {
+	ab, ba := map[int]int{}, map[int]int{}
+	for i := range a {
+		if l, ok := ab[a[i]]; ok && l != b[i] {
+			return false
+		}
+		if l, ok := ba[b[i]]; ok && l != a[i] {
+			return false
+		}
+		ab[a[i]], ba[b[i]] = b[i], a[i]
+	}
+	return true
+}
+
+func TestAgglomerate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	points := make([][2]float64, 10)
+	for i := range points {
+		points[i] = [2]float64{rnd.Float64() * 10, rnd.Float64() * 10}
+	}
+	weights := make([]float64, len(points))
+	for i := range weights {
+		weights[i] = 1
+	}
+	for _, linkage := range []Linkage{LinkageSingle, LinkageComplete, LinkageAverage} {
+		t.Run(linkage, func(t *testing.T) {
+			D := similarity.NewSymMatrix(len(points))
+			for i := range points {
+				for j := i + 1; j < len(points); j++ {
+					D.Set(i, j, math.Hypot(points[i][0]-points[j][0], points[i][1]-points[j][1]))
+				}
+			}
+			d, err := Agglomerate(D, weights, linkage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			heights, partitions := bruteForce(points, linkage)
+			if len(d.Merges) != len(heights) {
+				t.Fatalf("got %d merges, want %d", len(d.Merges), len(heights))
+			}
+			if !sort.SliceIsSorted(d.Merges, func(a, b int) bool { return d.Merges[a].Distance < d.Merges[b].Distance }) {
+				t.Error("merges are not in ascending order of distance")
+			}
+			for k, m := range d.Merges {
+				if math.Abs(m.Distance-heights[k]) > 1e-9 {
+					t.Errorf("merge %d: got distance %g, want %g", k, m.Distance, heights[k])
+				}
+			}
+			for count := 1; count <= len(points); count++ {
+				labels, clusters := d.CutCount(count)
+				if clusters != count {
+					t.Errorf("cut into %d: got %d clusters", count, clusters)
+				}
+				if want := partitions[len(points)-count]; !samePartition(labels, want) {
+					t.Errorf("cut into %d: got %v, want %v", count, labels, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAgglomerateDegenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		newick string
+	}{
+		{"empty", 0, ";"},
+		{"single", 1, "a;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := make([]float64, tt.n)
+			for i := range weights {
+				weights[i] = 1
+			}
+			d, err := Agglomerate(similarity.NewSymMatrix(tt.n), weights, LinkageAverage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.Merges) != 0 {
+				t.Errorf("got %d merges, want none", len(d.Merges))
+			}
+			if labels, clusters := d.CutDistance(1); len(labels) != tt.n || clusters != tt.n {
+				t.Errorf("cut at distance: got %v and %d clusters", labels, clusters)
+			}
+			if labels, clusters := d.CutCount(2); len(labels) != tt.n || clusters != tt.n {
+				t.Errorf("cut by count: got %v and %d clusters", labels, clusters)
+			}
+			if got := d.Newick(func(int) string { return "a" }); got != tt.newick {
+				t.Errorf("newick: got %q, want %q", got, tt.newick)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"math"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// Noise is the label of points which belong to no cluster.
+const Noise = -1
+
+// Points is anything clusters can be found in: weighted points and the
+// distance between any two of them. similarity.Space is one.
+type Points interface {
+	Len() int
+	Distance(i, j int) float64
+	Weight(i int) float64
+}
+
+type embedded struct {
+	Points
+	coords []similarity.Coordinate
+}
+
+func (e *embedded) Distance(i, j int) float64 {
+	var d float64
+	for a, v := range e.coords[i] {
+		diff := v - e.coords[j][a]
+		d += diff * diff
+	}
+	return math.Sqrt(d)
+}
+
+// Embedded measures the unique items of s by the Euclidean distance between
+// their projected coordinates, which must already have been embedded.
+func Embedded(s *similarity.Space) Points {
+	return &embedded{s, s.Embedding()}
+}
+
+// relabel numbers clusters from zero in descending order of total weight,
+// so cluster 0 is always the largest.
+func relabel(weight func(i int) float64, labels []int) int {
+	weights := map[int]float64{}
+	for i, l := range labels {
+		if l != Noise {
+			weights[l] += weight(i)
+		}
+	}
+	old := make([]int, 0, len(weights))
+	for l := range weights {
+		old = append(old, l)
+	}
+	sort.Slice(old, func(a, b int) bool {
+		if weights[old[a]] != weights[old[b]] {
+			return weights[old[a]] > weights[old[b]]
+		}
+		return old[a] < old[b]
+	})
+	ids := make(map[int]int, len(old))
+	for id, l := range old {
+		ids[l] = id
+	}
+	for i, l := range labels {
+		if l != Noise {
+			labels[i] = ids[l]
+		}
+	}
+	return len(old)
+}
@@ -0,0 +1,28 @@
+package cluster
+
+type Method = string
+
+const (
+	MethodNone    Method = ""
+	MethodDBSCAN  Method = "dbscan"
+	MethodHDBSCAN Method = "hdbscan"
+)
+
+var Methods = []Method{MethodDBSCAN, MethodHDBSCAN}
+
+// SpaceEmbedding clusters on the coordinates of the projection and
+// SpaceDistance on the similarity metric itself.
+const (
+	SpaceEmbedding = "embedding"
+	SpaceDistance  = "distance"
+)
+
+// Clustering records how logs were grouped and how many groups and
+// outliers were found.
+type Clustering struct {
+	Method     Method             `json:"method"`
+	Space      string             `json:"space"`
+	Parameters map[string]float64 `json:"parameters,omitempty"`
+	Clusters   int                `json:"clusters"`
+	Outliers   int                `json:"outliers"`
+}
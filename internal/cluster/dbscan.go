@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+// DBSCAN groups points with at least minPts weight within eps of them,
+// along with everything reachable from such core points (Ester et al.,
+// 1996). A point's own weight counts towards minPts, so a log repeated
+// often enough is a cluster on its own. It returns a label per point, Noise
+// for outliers, and the number of clusters.
+func DBSCAN(p Points, eps, minPts float64) ([]int, int, error) {
+	if eps <= 0 {
+		return nil, 0, fmt.Errorf("eps must be positive, got %g", eps)
+	}
+	n := p.Len()
+	neighbours := func(i int) []int {
+		nb := []int{}
+		for j := 0; j < n; j++ {
+			if j != i && p.Distance(i, j) <= eps {
+				nb = append(nb, j)
+			}
+		}
+		return nb
+	}
+
+	log.Printf("finding core points within %g...", eps)
+	core := make([]bool, n)
+	parallel.Range(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			weight := p.Weight(i)
+			for j := 0; j < n && weight < minPts; j++ {
+				if j != i && p.Distance(i, j) <= eps {
+					weight += p.Weight(j)
+				}
+			}
+			core[i] = weight >= minPts
+		}
+	})
+
+	log.Printf("expanding clusters...")
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = Noise
+	}
+	next := 0
+	for i := 0; i < n; i++ {
+		if !core[i] || labels[i] != Noise {
+			continue
+		}
+		labels[i] = next
+		queue := []int{i}
+		for len(queue) > 0 {
+			q := queue[0]
+			queue = queue[1:]
+			for _, j := range neighbours(q) {
+				if labels[j] != Noise {
+					continue
+				}
+				labels[j] = next
+				if core[j] {
+					queue = append(queue, j)
+				}
+			}
+		}
+		next++
+	}
+	return labels, relabel(p.Weight, labels), nil
+}
@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"slices"
+	"testing"
+)
+
+// weighted is a plane whose points each stand for a number of logs.
+type weighted struct {
+	plane
+	weights []float64
+}
+
+func (w weighted) Weight(i int) float64 { return w.weights[i] }
+
+func TestDBSCAN(t *testing.T) {
+	tests := []struct {
+		name     string
+		points   Points
+		eps      float64
+		minPts   float64
+		labels   []int
+		clusters int
+	}{
+		{
+			"two groups and an outlier",
+			plane{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {10, 10}, {10, 11}, {10, 12}, {50, 50}},
+			1.5, 3,
+			[]int{0, 0, 0, 0, 0, 1, 1, 1, Noise},
+			2,
+		},
+		{
+			// The end points have too few neighbours to be core points, but
+			// are reachable from one.
+			"border points",
+			plane{{0, 0}, {1, 0}, {2, 0}, {20, 0}},
+			1, 3,
+			[]int{0, 0, 0, Noise},
+			1,
+		},
+		{
+			"largest cluster first",
+			plane{{50, 50}, {50, 51}, {50, 52}, {0, 0}, {1, 0}, {2, 0}, {3, 0}},
+			1, 2,
+			[]int{1, 1, 1, 0, 0, 0, 0},
+			2,
+		},
+		{
+			"repeated log is a cluster on its own",
+			weighted{plane{{0, 0}, {30, 30}, {30, 31}}, []float64{5, 1, 1}},
+			1.5, 3,
+			[]int{0, Noise, Noise},
+			1,
+		},
+		{
+			"clusters ranked by weight",
+			weighted{plane{{0, 0}, {1, 0}, {2, 0}, {30, 30}}, []float64{1, 1, 1, 10}},
+			1.5, 3,
+			[]int{1, 1, 1, 0},
+			2,
+		},
+		{"empty", plane{}, 1, 3, []int{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, clusters, err := DBSCAN(tt.points, tt.eps, tt.minPts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clusters != tt.clusters {
+				t.Errorf("got %d clusters, want %d", clusters, tt.clusters)
+			}
+			if !slices.Equal(labels, tt.labels) {
+				t.Errorf("got labels %v, want %v", labels, tt.labels)
+			}
+		})
+	}
+}
+
+func TestDBSCANErrors(t *testing.T) {
+	for _, eps := range []float64{0, -1} {
+		if _, _, err := DBSCAN(plane{{0, 0}}, eps, 3); err == nil {
+			t.Errorf("eps %g: expected an error", eps)
+		}
+	}
+}
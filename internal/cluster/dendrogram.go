@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Linkage = string
+
+const (
+	LinkageSingle   Linkage = "single"
+	LinkageAverage  Linkage = "average"
+	LinkageComplete Linkage = "complete"
+	LinkageWard     Linkage = "ward"
+)
+
+var Linkages = []Linkage{LinkageSingle, LinkageAverage, LinkageComplete, LinkageWard}
+
+// Merge joins two nodes of a dendrogram. Leaves are numbered 0 to n-1 and
+// the node made by the k-th merge is numbered n+k.
+type Merge struct {
+	Left     int     `json:"left"`
+	Right    int     `json:"right"`
+	Distance float64 `json:"distance"`
+	Size     float64 `json:"size"`
+}
+
+// Dendrogram is the full merge history of agglomerative clustering, in
+// ascending order of distance.
+type Dendrogram struct {
+	Linkage Linkage   `json:"linkage"`
+	Weights []float64 `json:"weights"`
+	Merges  []Merge   `json:"merges"`
+}
+
+func (d *Dendrogram) Leaves() int {
+	return len(d.Weights)
+}
+
+// CutDistance keeps every merge at or below threshold and returns the
+// cluster of each leaf, numbered from zero by size, and the number of
+// clusters.
+func (d *Dendrogram) CutDistance(threshold float64) ([]int, int) {
+	k := sort.Search(len(d.Merges), func(k int) bool {
+		return d.Merges[k].Distance > threshold
+	})
+	return d.cut(k)
+}
+
+// CutCount keeps as few merges as leave count clusters.
+func (d *Dendrogram) CutCount(count int) ([]int, int) {
+	count = max(1, min(count, d.Leaves()))
+	return d.cut(d.Leaves() - count)
+}
+
+func (d *Dendrogram) cut(merges int) ([]int, int) {
+	n := d.Leaves()
+	uf := newUnionFind(max(2*n-1, 0))
+	for k := 0; k < merges; k++ {
+		m := d.Merges[k]
+		uf.parent[uf.find(m.Left)] = n + k
+		uf.parent[uf.find(m.Right)] = n + k
+	}
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = uf.find(i)
+	}
+	return labels, relabel(func(i int) float64 { return d.Weights[i] }, labels)
+}
+
+// Newick writes the dendrogram in Newick format with branch lengths, naming
+// each leaf with the given function.
+func (d *Dendrogram) Newick(name func(leaf int) string) string {
+	n := d.Leaves()
+	if n == 0 {
+		return ";"
+	}
+	height := func(node int) float64 {
+		if node < n {
+			return 0
+		}
+		return d.Merges[node-n].Distance
+	}
+	var b strings.Builder
+	var write func(node int, parent float64)
+	write = func(node int, parent float64) {
+		if node < n {
+			b.WriteString(quoteNewick(name(node)))
+		} else {
+			m := d.Merges[node-n]
+			b.WriteByte('(')
+			write(m.Left, m.Distance)
+			b.WriteByte(',')
+			write(m.Right, m.Distance)
+			b.WriteByte(')')
+		}
+		if parent >= 0 {
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatFloat(parent-height(node), 'g', 6, 64))
+		}
+	}
+	write(2*n-2, -1)
+	b.WriteByte(';')
+	return b.String()
+}
+
+func quoteNewick(s string) string {
+	if s != "" && !strings.ContainsAny(s, " ()[]':;,\t\n") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
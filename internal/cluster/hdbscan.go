@@ -0,0 +1,246 @@
+package cluster
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+// minLinkDistance keeps lambda, the reciprocal of distance, finite for
+// points which the metric cannot tell apart.
+const minLinkDistance = 1e-12
+
+type link struct {
+	a, b int
+	d    float64
+}
+
+// HDBSCAN finds clusters of varying density by building the single linkage
+// hierarchy of the mutual reachability distance, condensing away splits
+// which shed fewer than minClusterSize weight, and keeping the most stable
+// clusters (Campello, Moulavi & Sander, 2013). Weights count as repeated
+// points throughout. It returns a label per point, Noise for outliers, and
+// the number of clusters.
+func HDBSCAN(p Points, minClusterSize, minSamples float64) ([]int, int, error) {
+	if minClusterSize < 2 {
+		return nil, 0, fmt.Errorf("min cluster size must be at least 2, got %g", minClusterSize)
+	}
+	n := p.Len()
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = Noise
+	}
+	if n == 0 {
+		return labels, 0, nil
+	}
+
+	log.Printf("computing core distances for %g samples...", minSamples)
+	core := coreDistances(p, minSamples)
+	log.Printf("building minimum spanning tree of %d points...", n)
+	tree := mutualReachabilityTree(p, core)
+	log.Printf("condensing cluster tree...")
+	h := condense(p, tree, core, minClusterSize)
+	selected := h.selectClusters()
+
+	for i := range labels {
+		for c := h.pointCluster[i]; c >= 0; c = h.parent[c] {
+			if selected[c] {
+				labels[i] = c
+				break
+			}
+		}
+	}
+	return labels, relabel(p.Weight, labels), nil
+}
+
+// coreDistances finds, for each point, the distance within which there is
+// at least minSamples weight including the point itself. It is never less
+// than the distance to the nearest other point. Like the spanning tree it
+// compares every pair of points.
+func coreDistances(p Points, minSamples float64) []float64 {
+	n := p.Len()
+	core := make([]float64, n)
+	parallel.Range(n, func(lo, hi int) {
+		order := make([]int, 0, n-1)
+		dist := make([]float64, n)
+		for i := lo; i < hi; i++ {
+			order = order[:0]
+			for j := 0; j < n; j++ {
+				if j != i {
+					dist[j] = p.Distance(i, j)
+					order = append(order, j)
+				}
+			}
+			sort.Slice(order, func(a, b int) bool {
+				return dist[order[a]] < dist[order[b]]
+			})
+			weight := p.Weight(i)
+			for _, j := range order {
+				core[i] = dist[j]
+				weight += p.Weight(j)
+				if weight >= minSamples {
+					break
+				}
+			}
+			core[i] = math.Max(core[i], minLinkDistance)
+		}
+	})
+	return core
+}
+
+// mutualReachabilityTree runs Prim's algorithm over the complete graph of
+// mutual reachability distances max(core(a), core(b), d(a, b)) without ever
+// holding more than one row of it.
+func mutualReachabilityTree(p Points, core []float64) []link {
+	n := p.Len()
+	best := make([]float64, n)
+	from := make([]int, n)
+	done := make([]bool, n)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	tree := make([]link, 0, n-1)
+	current := 0
+	done[0] = true
+	for len(tree) < n-1 {
+		parallel.Range(n, func(lo, hi int) {
+			for j := lo; j < hi; j++ {
+				if done[j] {
+					continue
+				}
+				d := math.Max(p.Distance(current, j), math.Max(core[current], core[j]))
+				if d < best[j] {
+					best[j] = d
+					from[j] = current
+				}
+			}
+		})
+		next := -1
+		for j := range best {
+			if !done[j] && (next < 0 || best[j] < best[next]) {
+				next = j
+			}
+		}
+		tree = append(tree, link{from[next], next, best[next]})
+		done[next] = true
+		current = next
+		if len(tree)%max(n/10, 1) == 0 {
+			log.Printf("%d of %d tree edges...", len(tree), n-1)
+		}
+	}
+	return tree
+}
+
+// hierarchy is the condensed cluster tree. Cluster 0 is the root and
+// children always have higher IDs than their parents.
+type hierarchy struct {
+	parent       []int
+	birth        []float64
+	stability    []float64
+	pointCluster []int
+}
+
+func condense(p Points, tree []link, core []float64, minClusterSize float64) *hierarchy {
+	n := p.Len()
+	sort.Slice(tree, func(a, b int) bool {
+		return tree[a].d < tree[b].d
+	})
+
+	// Single linkage: node n+k merges the two components joined by the
+	// k-th shortest edge.
+	nodes := 2*n - 1
+	left := make([]int, nodes)
+	right := make([]int, nodes)
+	dist := make([]float64, nodes)
+	size := make([]float64, nodes)
+	uf := newUnionFind(nodes)
+	for i := 0; i < n; i++ {
+		size[i] = p.Weight(i)
+	}
+	for k, e := range tree {
+		node := n + k
+		a, b := uf.find(e.a), uf.find(e.b)
+		left[node], right[node], dist[node] = a, b, e.d
+		size[node] = size[a] + size[b]
+		uf.parent[a], uf.parent[b] = node, node
+	}
+
+	h := &hierarchy{
+		parent:       []int{-1},
+		birth:        []float64{0},
+		stability:    []float64{0},
+		pointCluster: make([]int, n),
+	}
+	fall := func(node, cluster int, lambda float64) {
+		stack := []int{node}
+		for len(stack) > 0 {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if m >= n {
+				stack = append(stack, left[m], right[m])
+				continue
+			}
+			h.pointCluster[m] = cluster
+			h.stability[cluster] += (lambda - h.birth[cluster]) * size[m]
+		}
+	}
+	var split func(node, cluster int)
+	split = func(node, cluster int) {
+		if node < n {
+			fall(node, cluster, 1/core[node])
+			return
+		}
+		lambda := 1 / math.Max(dist[node], minLinkDistance)
+		a, b := left[node], right[node]
+		bigA, bigB := size[a] >= minClusterSize, size[b] >= minClusterSize
+		switch {
+		case bigA && bigB:
+			h.stability[cluster] += (lambda - h.birth[cluster]) * size[node]
+			for _, child := range []int{a, b} {
+				h.parent = append(h.parent, cluster)
+				h.birth = append(h.birth, lambda)
+				h.stability = append(h.stability, 0)
+				split(child, len(h.parent)-1)
+			}
+		case bigA:
+			fall(b, cluster, lambda)
+			split(a, cluster)
+		case bigB:
+			fall(a, cluster, lambda)
+			split(b, cluster)
+		default:
+			fall(a, cluster, lambda)
+			fall(b, cluster, lambda)
+		}
+	}
+	split(nodes-1, 0)
+	return h
+}
+
+// selectClusters picks the set of non-overlapping clusters with the most
+// total stability, preferring a parent over its children on ties. The root
+// is never selected, as one cluster holding everything says nothing.
+func (h *hierarchy) selectClusters() []bool {
+	count := len(h.parent)
+	selected := make([]bool, count)
+	children := make([]float64, count)
+	for c := count - 1; c > 0; c-- {
+		total := children[c]
+		if h.stability[c] >= children[c] {
+			selected[c] = true
+			total = h.stability[c]
+		}
+		children[h.parent[c]] += total
+	}
+	covered := make([]bool, count)
+	for c := 1; c < count; c++ {
+		if covered[h.parent[c]] || selected[h.parent[c]] {
+			covered[c] = true
+			selected[c] = false
+		}
+	}
+	return selected
+}
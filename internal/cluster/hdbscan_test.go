@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type plane [][2]float64
+
+func (p plane) Len() int { return len(p) }
+
+func (p plane) Distance(i, j int) float64 {
+	return math.Hypot(p[i][0]-p[j][0], p[i][1]-p[j][1])
+}
+
+func (p plane) Weight(i int) float64 { return 1 }
+
+func blobs(rnd *rand.Rand, centres [][2]float64, size int, spread float64) plane {
+	p := plane{}
+	for _, c := range centres {
+		for i := 0; i < size; i++ {
+			p = append(p, [2]float64{c[0] + rnd.NormFloat64()*spread, c[1] + rnd.NormFloat64()*spread})
+		}
+	}
+	return p
+}
+
+func TestHDBSCAN(t *testing.T) {
+	tests := []struct {
+		name     string
+		centres  [][2]float64
+		size     int
+		clusters int
+	}{
+		{"two blobs", [][2]float64{{0, 0}, {20, 20}}, 30, 2},
+		{"three blobs", [][2]float64{{0, 0}, {20, 0}, {0, 20}}, 25, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := blobs(rand.New(rand.NewSource(3)), tt.centres, tt.size, 1)
+			labels, clusters, err := HDBSCAN(p, 5, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clusters != tt.clusters {
+				t.Fatalf("got %d clusters, want %d", clusters, tt.clusters)
+			}
+			seen := map[int]bool{}
+			for b := range tt.centres {
+				blob := labels[b*tt.size : (b+1)*tt.size]
+				counts := map[int]int{}
+				for _, l := range blob {
+					counts[l]++
+				}
+				label, best := Noise, 0
+				for l, n := range counts {
+					if l != Noise && n > best {
+						label, best = l, n
+					}
+				}
+				if label == Noise || best < tt.size*9/10 {
+					t.Errorf("blob %d: labels %v", b, blob)
+				}
+				if seen[label] {
+					t.Errorf("blob %d shares cluster %d with another blob", b, label)
+				}
+				seen[label] = true
+			}
+		})
+	}
+}
+
+func TestHDBSCANErrors(t *testing.T) {
+	if _, _, err := HDBSCAN(plane{}, 1, 1); err == nil {
+		t.Error("expected an error for a min cluster size below 2")
+	}
+	labels, clusters, err := HDBSCAN(plane{}, 5, 5)
+	if err != nil || len(labels) != 0 || clusters != 0 {
+		t.Errorf("empty: got %v, %d, %v", labels, clusters, err)
+	}
+}
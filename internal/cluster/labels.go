@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"math"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+// medoidSample caps how many members are compared when finding a medoid,
+// so large clusters cost at most medoidSample² distances.
+const medoidSample = 500
+
+// Medoid returns the member with the least weighted distance to the other
+// members. Clusters larger than medoidSample are judged on an evenly spaced
+// sample of their members.
+func Medoid(p Points, members []int) int {
+	if len(members) == 0 {
+		return -1
+	}
+	sample := members
+	if len(members) > medoidSample {
+		sample = make([]int, medoidSample)
+		for i := range sample {
+			sample[i] = members[i*len(members)/medoidSample]
+		}
+	}
+	cost := make([]float64, len(sample))
+	parallel.Range(len(sample), func(lo, hi int) {
+		for a := lo; a < hi; a++ {
+			for _, j := range sample {
+				cost[a] += p.Weight(j) * p.Distance(sample[a], j)
+			}
+		}
+	})
+	best := 0
+	for a := range cost {
+		if cost[a] < cost[best] {
+			best = a
+		}
+	}
+	return sample[best]
+}
+
+// DistinctiveTokens scores every token of each group by its term frequency
+// within the group times its inverse frequency across groups, and returns
+// the top k of each group. Tokens found in every group score lowest.
+func DistinctiveTokens(groups []map[string]float64, k int) [][]string {
+	df := map[string]int{}
+	for _, g := range groups {
+		for t := range g {
+			df[t]++
+		}
+	}
+	top := make([][]string, len(groups))
+	for i, g := range groups {
+		var total float64
+		for _, c := range g {
+			total += c
+		}
+		type scored struct {
+			token string
+			score float64
+		}
+		scores := make([]scored, 0, len(g))
+		for t, c := range g {
+			idf := math.Log(float64(1+len(groups)) / float64(df[t]))
+			scores = append(scores, scored{t, c / total * idf})
+		}
+		sort.Slice(scores, func(a, b int) bool {
+			if scores[a].score != scores[b].score {
+				return scores[a].score > scores[b].score
+			}
+			return scores[a].token < scores[b].token
+		})
+		top[i] = []string{}
+		for _, s := range scores[:min(k, len(scores))] {
+			top[i] = append(top[i], s.token)
+		}
+	}
+	return top
+}
@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMedoid(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  Points
+		members []int
+		want    int
+	}{
+		{"middle of a line", plane{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}, []int{0, 1, 2, 3, 4}, 2},
+		{"members only", plane{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}, []int{2, 3, 4}, 3},
+		{"single member", plane{{0, 0}, {5, 5}}, []int{1}, 1},
+		{"no members", plane{{0, 0}}, []int{}, -1},
+		{
+			// A heavily repeated point pulls the medoid towards it.
+			"weighted",
+			weighted{plane{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}, []float64{1, 1, 1, 1, 20}},
+			[]int{0, 1, 2, 3, 4},
+			4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Medoid(tt.points, tt.members); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMedoidSample(t *testing.T) {
+	p := plane{}
+	for i := 0; i < 3*medoidSample; i++ {
+		p = append(p, [2]float64{float64(i), 0})
+	}
+	members := make([]int, len(p))
+	for i := range members {
+		members[i] = i
+	}
+	if got := Medoid(p, members); got < len(p)/2-10 || got > len(p)/2+10 {
+		t.Errorf("got medoid %d of %d points on a line, want near the middle", got, len(p))
+	}
+}
+
+func TestDistinctiveTokens(t *testing.T) {
+	groups := []map[string]float64{
+		{"failed": 4, "connection": 4, "refused": 3, "db": 1},
+		{"failed": 4, "timeout": 5, "order": 2},
+		{"failed": 1, "invoice": 2, "missing": 2},
+		{"failed": 1},
+		{},
+	}
+	tests := []struct {
+		k    int
+		want [][]string
+	}{
+		{2, [][]string{{"connection", "refused"}, {"timeout", "order"}, {"invoice", "missing"}, {"failed"}, {}}},
+		// Tokens common to most groups come last.
+		{10, [][]string{{"connection", "refused", "db", "failed"}, {"timeout", "order", "failed"}, {"invoice", "missing", "failed"}, {"failed"}, {}}},
+	}
+	for _, tt := range tests {
+		got := DistinctiveTokens(groups, tt.k)
+		for g := range tt.want {
+			if !slices.Equal(got[g], tt.want[g]) {
+				t.Errorf("top %d of group %d: got %v, want %v", tt.k, g, got[g], tt.want[g])
+			}
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -8,6 +13,67 @@ type Config struct {
 	KibanaURL    string `envconfig:"KIBANA_URL" default:"https://elk-pr-kibana.service.ops.iptho.co.uk/"`
 	LDAPUsername string `envconfig:"LDAP_USERNAME"`
 	LDAPPassword string `envconfig:"LDAP_PASSWORD"`
+
+	SimilarityMetric  string             `envconfig:"SIMILARITY_METRIC" default:"levenshtein"`
+	SimilarityWeights map[string]float64 `envconfig:"SIMILARITY_WEIGHTS"`
+
+	MDSLandmarks      int `envconfig:"MDS_LANDMARKS" default:"300"`
+	MDSClassicalLimit int `envconfig:"MDS_CLASSICAL_LIMIT" default:"20000"`
+
+	Dimensions     int     `envconfig:"DIMENSIONS" default:"2"`
+	Projection     string  `envconfig:"PROJECTION" default:"mds"`
+	TSNEPerplexity float64 `envconfig:"TSNE_PERPLEXITY" default:"30"`
+	TSNEIterations int     `envconfig:"TSNE_ITERATIONS" default:"1000"`
+	UMAPNeighbours int     `envconfig:"UMAP_NEIGHBOURS" default:"15"`
+	UMAPMinDist    float64 `envconfig:"UMAP_MIN_DIST" default:"0.1"`
+	UMAPEpochs     int     `envconfig:"UMAP_EPOCHS" default:"0"`
+
+	DiagnosticNeighbours int `envconfig:"DIAGNOSTIC_NEIGHBOURS" default:"10"`
+	DiagnosticSample     int `envconfig:"DIAGNOSTIC_SAMPLE" default:"1000"`
+
+	ClusterAlgorithm      string  `envconfig:"CLUSTER_ALGORITHM" default:"hdbscan"`
+	ClusterSpace          string  `envconfig:"CLUSTER_SPACE" default:"embedding"`
+	ClusterMinPoints      float64 `envconfig:"CLUSTER_MIN_POINTS" default:"5"`
+	DBSCANEps             float64 `envconfig:"DBSCAN_EPS" default:"0.1"`
+	HDBSCANMinClusterSize float64 `envconfig:"HDBSCAN_MIN_CLUSTER_SIZE" default:"10"`
+	Linkage               string  `envconfig:"LINKAGE" default:"average"`
+
+	ReuseModel     bool   `envconfig:"REUSE_MODEL" default:"false"`
+	Align          bool   `envconfig:"ALIGN" default:"true"`
+	AlignReference string `envconfig:"ALIGN_REFERENCE"`
+
+	MinHash                bool    `envconfig:"MINHASH" default:"false"`
+	MinHashes              int     `envconfig:"MINHASH_HASHES" default:"128"`
+	MinHashBands           int     `envconfig:"MINHASH_BANDS" default:"32"`
+	ShingleSize            int     `envconfig:"SHINGLE_SIZE" default:"2"`
+	NearDuplicateThreshold float64 `envconfig:"NEAR_DUPLICATE_THRESHOLD" default:"0.8"`
+	CollapseNearDuplicates bool    `envconfig:"COLLAPSE_NEAR_DUPLICATES" default:"false"`
+
+	NoveltyThreshold float64 `envconfig:"NOVELTY_THRESHOLD" default:"0.3"`
+	TrendThreshold   float64 `envconfig:"TREND_THRESHOLD" default:"0.5"`
+	HistoryRuns      int     `envconfig:"HISTORY_RUNS" default:"52"`
+
+	TimeSeriesInterval string  `envconfig:"TIMESERIES_INTERVAL" default:"1h"`
+	SpikeBaseline      string  `envconfig:"SPIKE_BASELINE" default:"rolling"`
+	SpikeWindow        int     `envconfig:"SPIKE_WINDOW" default:"24"`
+	SpikeSeason        string  `envconfig:"SPIKE_SEASON" default:"24h"`
+	SpikeThreshold     float64 `envconfig:"SPIKE_THRESHOLD" default:"3.5"`
+	SpikeMinCount      float64 `envconfig:"SPIKE_MIN_COUNT" default:"5"`
+
+	IncidentGap     string `envconfig:"INCIDENT_GAP" default:"15m"`
+	IncidentSplit   string `envconfig:"INCIDENT_SPLIT"`
+	IncidentMinLogs int    `envconfig:"INCIDENT_MIN_LOGS" default:"5"`
+
+	CoOccurrenceWindow   string  `envconfig:"COOCCURRENCE_WINDOW" default:"1m"`
+	CoOccurrenceMinCount int     `envconfig:"COOCCURRENCE_MIN_COUNT" default:"5"`
+	CoOccurrenceMinLift  float64 `envconfig:"COOCCURRENCE_MIN_LIFT" default:"3"`
+
+	DistanceCachePath       string `envconfig:"DISTANCE_CACHE_PATH"`
+	DistanceCacheMaxAge     int    `envconfig:"DISTANCE_CACHE_MAX_AGE" default:"10"`
+	DistanceCacheMaxEntries int    `envconfig:"DISTANCE_CACHE_MAX_ENTRIES" default:"5000000"`
+
+	CoordinateJitter float64 `envconfig:"COORDINATE_JITTER" default:"0"`
+	Seed             int64   `envconfig:"SEED" default:"1"`
 }
 
 func Load() (*Config, error) {
@@ -15,3 +81,86 @@ func Load() (*Config, error) {
 	err := envconfig.Process("", &c)
 	return &c, err
 }
+
+// BindFlags lets the analysis commands override the environment per run.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.SimilarityMetric, "metric", c.SimilarityMetric, "similarity metric (levenshtein, jaro-winkler, jaccard, ngram-cosine, tfidf-cosine)")
+	fs.IntVar(&c.Dimensions, "dims", c.Dimensions, "number of dimensions to embed into")
+	fs.StringVar(&c.Projection, "projection", c.Projection, "projection (mds, tsne, umap)")
+	fs.Float64Var(&c.TSNEPerplexity, "perplexity", c.TSNEPerplexity, "t-sne perplexity")
+	fs.IntVar(&c.TSNEIterations, "iterations", c.TSNEIterations, "t-sne iterations")
+	fs.IntVar(&c.UMAPNeighbours, "neighbours", c.UMAPNeighbours, "umap nearest neighbours")
+	fs.Float64Var(&c.UMAPMinDist, "min-dist", c.UMAPMinDist, "umap minimum distance")
+	fs.IntVar(&c.UMAPEpochs, "epochs", c.UMAPEpochs, "umap epochs, or 0 to choose by size")
+	fs.IntVar(&c.DiagnosticNeighbours, "diagnostic-neighbours", c.DiagnosticNeighbours, "neighbourhood size for trustworthiness and continuity")
+	fs.IntVar(&c.DiagnosticSample, "diagnostic-sample", c.DiagnosticSample, "unique logs sampled for embedding diagnostics")
+	fs.IntVar(&c.MDSLandmarks, "landmarks", c.MDSLandmarks, "number of landmarks for landmark mds")
+	fs.IntVar(&c.MDSClassicalLimit, "classical-limit", c.MDSClassicalLimit, "largest input embedded with classical mds")
+	fs.StringVar(&c.ClusterAlgorithm, "cluster", c.ClusterAlgorithm, "clustering algorithm (dbscan, hdbscan, or none)")
+	fs.StringVar(&c.ClusterSpace, "cluster-space", c.ClusterSpace, "cluster on the projected coordinates (embedding) or the metric (distance)")
+	fs.Float64Var(&c.ClusterMinPoints, "min-points", c.ClusterMinPoints, "dbscan core point weight and hdbscan min samples")
+	fs.Float64Var(&c.DBSCANEps, "eps", c.DBSCANEps, "dbscan neighbourhood radius")
+	fs.Float64Var(&c.HDBSCANMinClusterSize, "min-cluster-size", c.HDBSCANMinClusterSize, "hdbscan minimum cluster size")
+	fs.StringVar(&c.Linkage, "linkage", c.Linkage, "agglomerative clustering linkage (single, average, complete, ward, or none)")
+	fs.BoolVar(&c.ReuseModel, "reuse-model", c.ReuseModel, "place logs into the saved embedding model instead of computing a new one")
+	fs.BoolVar(&c.Align, "align", c.Align, "rotate, reflect and scale new coordinates to match a reference run")
+	fs.StringVar(&c.AlignReference, "align-reference", c.AlignReference, "coordinates file to align to, defaulting to the previous run")
+	fs.BoolVar(&c.MinHash, "minhash", c.MinHash, "index logs by minhash to report near duplicates and seed neighbour searches")
+	fs.IntVar(&c.MinHashes, "minhash-hashes", c.MinHashes, "number of minhash functions in each signature")
+	fs.IntVar(&c.MinHashBands, "minhash-bands", c.MinHashBands, "number of lsh bands each signature is split into")
+	fs.IntVar(&c.ShingleSize, "shingle", c.ShingleSize, "tokens per shingle of a normalised message")
+	fs.Float64Var(&c.NearDuplicateThreshold, "near-duplicate-threshold", c.NearDuplicateThreshold, "estimated jaccard similarity at which logs are near duplicates")
+	fs.BoolVar(&c.CollapseNearDuplicates, "collapse-near-duplicates", c.CollapseNearDuplicates, "embed and cluster each group of near duplicates as one log")
+	fs.Float64Var(&c.NoveltyThreshold, "novelty-threshold", c.NoveltyThreshold, "distance to the nearest reference log beyond which a log is novel")
+	fs.Float64Var(&c.TrendThreshold, "trend-threshold", c.TrendThreshold, "relative change in count at which a fingerprint is growing or shrinking")
+	fs.IntVar(&c.HistoryRuns, "history-runs", c.HistoryRuns, "runs kept in the fingerprint history, or 0 to keep them all")
+	fs.StringVar(&c.TimeSeriesInterval, "interval", c.TimeSeriesInterval, "time series bucket interval, e.g. 15m or 1h")
+	fs.StringVar(&c.SpikeBaseline, "spike-baseline", c.SpikeBaseline, "spike baseline (rolling or seasonal)")
+	fs.IntVar(&c.SpikeWindow, "spike-window", c.SpikeWindow, "earlier buckets, or seasons, each bucket is compared with")
+	fs.StringVar(&c.SpikeSeason, "spike-season", c.SpikeSeason, "length of a season for the seasonal baseline")
+	fs.Float64Var(&c.SpikeThreshold, "spike-threshold", c.SpikeThreshold, "robust z-score at which a bucket spikes")
+	fs.Float64Var(&c.SpikeMinCount, "spike-min-count", c.SpikeMinCount, "fewest logs in a bucket that can spike")
+	fs.StringVar(&c.IncidentGap, "incident-gap", c.IncidentGap, "quiet gap which separates two incidents")
+	fs.StringVar(&c.IncidentSplit, "incident-split", c.IncidentSplit, "split incidents by cluster or microservice, or empty for neither")
+	fs.IntVar(&c.IncidentMinLogs, "incident-min-logs", c.IncidentMinLogs, "fewest logs in an incident")
+	fs.StringVar(&c.CoOccurrenceWindow, "cooccurrence-window", c.CoOccurrenceWindow, "window within which two errors co-occur")
+	fs.IntVar(&c.CoOccurrenceMinCount, "cooccurrence-min-count", c.CoOccurrenceMinCount, "fewest co-occurrences a reported pair needs")
+	fs.Float64Var(&c.CoOccurrenceMinLift, "cooccurrence-min-lift", c.CoOccurrenceMinLift, "lowest lift over chance a reported pair needs")
+	fs.StringVar(&c.DistanceCachePath, "distance-cache", c.DistanceCachePath, "file to keep pairwise distances in between runs, or empty for none")
+	fs.IntVar(&c.DistanceCacheMaxAge, "distance-cache-max-age", c.DistanceCacheMaxAge, "runs a cached distance may go unused before it is evicted")
+	fs.IntVar(&c.DistanceCacheMaxEntries, "distance-cache-max-entries", c.DistanceCacheMaxEntries, "most distances kept in the cache")
+	fs.Float64Var(&c.CoordinateJitter, "jitter", c.CoordinateJitter, "scatter duplicate logs by this fraction of the embedding spread")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "random seed")
+	fs.Func("weights", "per-feature similarity weights, e.g. errorMessage:1,microservice:0.5", func(s string) error {
+		weights, err := parseWeights(s)
+		if err != nil {
+			return err
+		}
+		c.SimilarityWeights = weights
+		return nil
+	})
+}
+
+func parseWeights(s string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	var total float64
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight '%s', expected name:value", pair)
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for '%s': %s", name, err)
+		}
+		weights[strings.TrimSpace(name)] = w
+		total += w
+	}
+	if len(weights) > 0 && total <= 0 {
+		return nil, fmt.Errorf("weights must add up to more than zero")
+	}
+	return weights, nil
+}
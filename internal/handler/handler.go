@@ -29,6 +29,24 @@ func (a *Handler) Greet(name string) string {
 	return fmt.Sprintf("Hello %s, It's show time!", name)
 }
 
+// GetErrorClusters cuts the error dendrogram into count clusters, or at the
+// distance threshold when count is zero.
+func (a *Handler) GetErrorClusters(threshold float64, count int) (*kibana.KibanaClusterCut, error) {
+	return a.kibanaClient.CutErrors(threshold, count)
+}
+
+// FindSimilarErrors returns the k analysed errors most similar to the log
+// with the given id, or to a pasted error message when id is empty.
+func (a *Handler) FindSimilarErrors(message, id string, k int) (*kibana.KibanaSimilarErrors, error) {
+	return a.kibanaClient.FindSimilarErrors(message, id, k)
+}
+
+// GetErrorTimeSeries buckets the logs of the loaded analysis by interval,
+// such as 15m or 1h, or by the configured interval when it is empty.
+func (a *Handler) GetErrorTimeSeries(logs []kibana.KibanaTimeSeriesLog, interval string) (*kibana.KibanaTimeSeries, error) {
+	return a.kibanaClient.ErrorTimeSeries(logs, interval)
+}
+
 // type GetDataResponse struct {
 // 	Logs *kibana.KibanaErrorLogs `json:"logs"`
 // }
@@ -9,7 +9,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/atoscerebro/bms-analysis/internal/similarity"
 	"github.com/go-viper/mapstructure/v2"
 	"golang.org/x/sync/errgroup"
 )
@@ -41,10 +40,27 @@ var WatcherErrorMapping = map[string][]string{
 }
 
 var AlertsWatcherOutputPath = "alerts-watcher-output.json"
+var AlertsExecutionsOutputPath = "alerts-executions-output.json"
+var AlertsExecutionHistoryOutputPath = "alerts-execution-history-output.json"
+var AlertsNoiseOutputPath = "alerts-noise-output.json"
 var AlertsCoordinatesOutputPath = "alerts-coordinate-output.json"
+var AlertsClusterOutputPath = "alerts-cluster-output.json"
+var AlertsDendrogramOutputPath = "alerts-dendrogram-output.json"
+var AlertsNewickOutputPath = "alerts-dendrogram-output.nwk"
+var AlertsModelOutputPath = "alerts-model-output.json"
+var AlertsDuplicatesOutputPath = "alerts-duplicates-output.json"
+var AlertsHistoryPath = "alerts-fingerprint-history.json"
+var AlertsTrendsOutputPath = "alerts-trends-output.json"
+var AlertsTimeSeriesOutputPath = "alerts-timeseries-output.json"
+var AlertsTimeSeriesCSVOutputPath = "alerts-timeseries-output.csv"
+
+type KibanaWatcherLogCondition struct {
+	Met bool `mapstructure:"met" json:"met"`
+}
 
 type KibanaWatcherLogResult struct {
-	ExecutionTime string `mapstructure:"execution_time" json:"execution_time"`
+	ExecutionTime string                    `mapstructure:"execution_time" json:"execution_time"`
+	Condition     KibanaWatcherLogCondition `mapstructure:"condition" json:"condition"`
 }
 
 type KibanaWatcherLogSource struct {
@@ -62,6 +78,33 @@ type KibanaWatcherLog struct {
 type KibanaWatcherLogs []*KibanaWatcherLog
 
 func (c *KibanaClient) GetWatcherExecutions() (*KibanaWatcherLogs, error) {
+	return c.searchWatcherExecutions([]map[string]interface{}{
+		{
+			"term": map[string]interface{}{
+				"result.condition.met": true,
+			},
+		},
+	}, []string{
+		"watch_id",
+		"result.execution_time",
+		"result.actions",
+		"result.condition",
+		"result.status",
+	})
+}
+
+// GetWatcherExecutionHistory fetches every execution of the BMS watches
+// from the last month, whether its condition was met or not, with only
+// what is needed to follow each watch's state.
+func (c *KibanaClient) GetWatcherExecutionHistory() (*KibanaWatcherLogs, error) {
+	return c.searchWatcherExecutions([]map[string]interface{}{}, []string{
+		"watch_id",
+		"result.execution_time",
+		"result.condition.met",
+	})
+}
+
+func (c *KibanaClient) searchWatcherExecutions(must []map[string]interface{}, source []string) (*KibanaWatcherLogs, error) {
 	query := map[string]interface{}{
 		"sort": []map[string]interface{}{
 			{
@@ -70,34 +113,23 @@ func (c *KibanaClient) GetWatcherExecutions() (*KibanaWatcherLogs, error) {
 				},
 			},
 		},
-		"_source": []string{
-			"watch_id",
-			"result.execution_time",
-			"result.actions",
-			"result.condition",
-			"result.status",
-		},
+		"_source": source,
 		"query": map[string]interface{}{
 			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"term": map[string]interface{}{
-							"result.condition.met": true,
-						},
-					},
-					{
+				"must": append(must,
+					map[string]interface{}{
 						"prefix": map[string]interface{}{
 							"watch_id": "BMS_",
 						},
 					},
-					{
+					map[string]interface{}{
 						"range": map[string]interface{}{
 							"result.execution_time": map[string]string{
 								"gte": "now-1M/M",
 							},
 						},
 					},
-				},
+				),
 			},
 		},
 	}
@@ -124,6 +156,37 @@ func (c *KibanaClient) GetWatcherExecutions() (*KibanaWatcherLogs, error) {
 	return &watcherHits, nil
 }
 
+// readWatcherExecutions loads the watcher executions written by the alerts
+// analysis, which alone fetches them, so every other analysis sees the same
+// snapshot as the watcher error logs.
+func readWatcherExecutions(path string) (*KibanaWatcherLogs, error) {
+	var executions *KibanaWatcherLogs
+	executionsFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watcher executions, run the alerts analysis first: %s", err)
+	}
+	log.Println("loading watcher executions from local file...")
+	if err = json.Unmarshal(executionsFile, &executions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal watcher executions file: %s", err)
+	}
+	return executions, nil
+}
+
+// fetchWatcherExecutions fetches watcher executions from kibana and writes
+// them to the local file.
+func fetchWatcherExecutions(path string, fetch func() (*KibanaWatcherLogs, error)) (*KibanaWatcherLogs, error) {
+	log.Println("fetching watcher logs from kibana...")
+	executions, err := fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watcher logs: %s", err)
+	}
+	log.Println("writing watcher logs to local file...")
+	if err = output(executions, path); err != nil {
+		return nil, fmt.Errorf("failed to write watcher logs: %s", err)
+	}
+	return executions, nil
+}
+
 func (c *KibanaClient) GetWatcherErrorLogs(wlogs *KibanaWatcherLogs) (*KibanaErrorLogs, error) {
 	mu := sync.Mutex{}
 	results := KibanaErrorLogs{}
@@ -238,48 +301,86 @@ func (c *KibanaClient) GetWatcherErrorLogs(wlogs *KibanaWatcherLogs) (*KibanaErr
 	return &results, nil
 }
 
-func (c *KibanaClient) AnalyseAlerts() error {
+// loadWatcherLogs loads the watcher error logs from the local file, or
+// fetches the watcher executions and then their error logs and writes both.
+// The executions are also fetched when only their own file is missing, so
+// the error analysis can join them even while the error logs are cached.
+func (c *KibanaClient) loadWatcherLogs() (*KibanaErrorLogs, error) {
 	var watcherErrorLogs *KibanaErrorLogs
-	var err error
-
 	watcherLogsFile, err := os.ReadFile(AlertsWatcherOutputPath)
 	if err == nil {
 		log.Println("loading logs from local file...")
 		if err = json.Unmarshal(watcherLogsFile, &watcherErrorLogs); err != nil {
-			return fmt.Errorf("failed to unmarshal logs file: %s", err)
+			return nil, fmt.Errorf("failed to unmarshal logs file: %s", err)
 		}
-	} else {
-		var watcherLogs *KibanaWatcherLogs
-
-		log.Println("fetching watcher logs from kibana...")
-		if watcherLogs, err = c.GetWatcherExecutions(); err != nil {
-			return fmt.Errorf("failed to get logs: %s", err)
-		}
-		log.Println("fetching watcher error logs from kibana...")
-		if watcherErrorLogs, err = c.GetWatcherErrorLogs(watcherLogs); err != nil {
-			return fmt.Errorf("failed to get logs: %s", err)
-		}
-		log.Println("writing watcher error logs to local file...")
-		if err = output(watcherErrorLogs, AlertsWatcherOutputPath); err != nil {
-			return fmt.Errorf("failed to write logs: %s", err)
+		if _, err := os.Stat(AlertsExecutionsOutputPath); err != nil {
+			if _, err := fetchWatcherExecutions(AlertsExecutionsOutputPath, c.GetWatcherExecutions); err != nil {
+				log.Printf("continuing without watcher executions for the error analysis: %s", err)
+			}
 		}
+		return watcherErrorLogs, nil
 	}
 
-	log.Println("calculating alert similarity...")
-	comparableLogs := make([]similarity.Comparable, len(*watcherErrorLogs))
-	for i, l := range *watcherErrorLogs {
-		comparableLogs[i] = &KibanaLogErrorComparable{l}
+	watcherLogs, err := fetchWatcherExecutions(AlertsExecutionsOutputPath, c.GetWatcherExecutions)
+	if err != nil {
+		return nil, err
 	}
-	coords, err := similarity.Coordinates(comparableLogs)
+	log.Println("fetching watcher error logs from kibana...")
+	if watcherErrorLogs, err = c.GetWatcherErrorLogs(watcherLogs); err != nil {
+		return nil, fmt.Errorf("failed to get logs: %s", err)
+	}
+	log.Println("writing watcher error logs to local file...")
+	if err = output(watcherErrorLogs, AlertsWatcherOutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write logs: %s", err)
+	}
+	return watcherErrorLogs, nil
+}
+
+func (c *KibanaClient) AnalyseAlerts() error {
+	watcherErrorLogs, err := c.loadWatcherLogs()
 	if err != nil {
-		return fmt.Errorf("failed to calculate coordinates: %s", err)
+		return err
 	}
-	for i, coord := range coords {
-		(*watcherErrorLogs)[i].Coordinates.Error = coord
+
+	log.Println("calculating alert similarity...")
+	analysis, err := c.analyse(watcherErrorLogs, AlertsModelOutputPath, AlertsCoordinatesOutputPath)
+	if err != nil {
+		return err
 	}
-	if err := output(watcherErrorLogs, AlertsCoordinatesOutputPath); err != nil {
+	if err := output(analysis, AlertsCoordinatesOutputPath); err != nil {
 		return fmt.Errorf("failed to write coordinates: %s", err)
 	}
+	if err := outputModel(analysis, AlertsModelOutputPath); err != nil {
+		return fmt.Errorf("failed to write model: %s", err)
+	}
+	if err := output(summariseClusters(analysis), AlertsClusterOutputPath); err != nil {
+		return fmt.Errorf("failed to write clusters: %s", err)
+	}
+	if err := outputDendrogram(analysis, AlertsDendrogramOutputPath, AlertsNewickOutputPath); err != nil {
+		return fmt.Errorf("failed to write dendrogram: %s", err)
+	}
+	if err := outputDuplicates(analysis, AlertsDuplicatesOutputPath); err != nil {
+		return fmt.Errorf("failed to write near duplicates: %s", err)
+	}
+	if err := c.trackFingerprints(analysis.Logs, AlertsHistoryPath, AlertsTrendsOutputPath); err != nil {
+		return fmt.Errorf("failed to track fingerprints: %s", err)
+	}
+	ts, err := c.timeSeries(analysis.Logs, "")
+	if err != nil {
+		return err
+	}
+	if err := outputTimeSeries(ts, AlertsTimeSeriesOutputPath, AlertsTimeSeriesCSVOutputPath); err != nil {
+		return fmt.Errorf("failed to write time series: %s", err)
+	}
+	noise, err := watcherNoise(analysis.Logs, func() (*KibanaWatcherLogs, error) {
+		return fetchWatcherExecutions(AlertsExecutionHistoryOutputPath, c.GetWatcherExecutionHistory)
+	})
+	if err != nil {
+		return err
+	}
+	if err := output(noise, AlertsNoiseOutputPath); err != nil {
+		return fmt.Errorf("failed to write watcher noise: %s", err)
+	}
 
 	return nil
 }
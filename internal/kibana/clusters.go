@@ -0,0 +1,259 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// KibanaCluster describes a cluster well enough to label it: its most
+// central errorMessage, the tokens which set it apart from the other
+// clusters, what it involves and when it was seen.
+type KibanaCluster struct {
+	ID            int            `json:"id"`
+	Size          int            `json:"size"`
+	Unique        int            `json:"unique"`
+	Medoid        string         `json:"medoid"`
+	Tokens        []string       `json:"tokens"`
+	Microservices map[string]int `json:"microservices"`
+	Messages      map[string]int `json:"messages"`
+	Environments  map[string]int `json:"environments"`
+	FirstSeen     string         `json:"firstSeen"`
+	LastSeen      string         `json:"lastSeen"`
+}
+
+type KibanaClusters struct {
+	Clustering cluster.Clustering `json:"clustering"`
+	Clusters   []KibanaCluster    `json:"clusters"`
+	Outliers   int                `json:"outliers"`
+}
+
+// KibanaDendrogram holds the agglomerative clustering of the unique logs
+// along with the leaf each log belongs to, in the order of the coordinates
+// file.
+type KibanaDendrogram struct {
+	Dendrogram *cluster.Dendrogram `json:"dendrogram"`
+	Leaves     []int               `json:"leaves"`
+}
+
+type KibanaClusterCut struct {
+	Threshold float64         `json:"threshold"`
+	Count     int             `json:"count"`
+	Clusters  []KibanaCluster `json:"clusters"`
+	Logs      map[string]int  `json:"logs"`
+}
+
+// cluster labels every log with the cluster its unique record falls in.
+func (c *KibanaClient) cluster(space *similarity.Space, logs *KibanaErrorLogs) (*cluster.Clustering, error) {
+	clustering := &cluster.Clustering{
+		Method: c.config.ClusterAlgorithm,
+		Space:  c.config.ClusterSpace,
+	}
+	if clustering.Method == cluster.MethodNone || clustering.Method == "none" {
+		clustering.Method = cluster.MethodNone
+		for _, l := range *logs {
+			l.Cluster = KibanaLogCluster{ID: cluster.Noise}
+		}
+		return clustering, nil
+	}
+
+	var points cluster.Points
+	switch clustering.Space {
+	case cluster.SpaceEmbedding:
+		points = cluster.Embedded(space)
+	case cluster.SpaceDistance:
+		points = space
+	default:
+		return nil, fmt.Errorf("unknown cluster space '%s', expected %s or %s", clustering.Space, cluster.SpaceEmbedding, cluster.SpaceDistance)
+	}
+
+	var labels []int
+	var err error
+	switch clustering.Method {
+	case cluster.MethodDBSCAN:
+		clustering.Parameters = map[string]float64{
+			"eps":       c.config.DBSCANEps,
+			"minPoints": c.config.ClusterMinPoints,
+		}
+		labels, clustering.Clusters, err = cluster.DBSCAN(points, c.config.DBSCANEps, c.config.ClusterMinPoints)
+	case cluster.MethodHDBSCAN:
+		clustering.Parameters = map[string]float64{
+			"minClusterSize": c.config.HDBSCANMinClusterSize,
+			"minSamples":     c.config.ClusterMinPoints,
+		}
+		labels, clustering.Clusters, err = cluster.HDBSCAN(points, c.config.HDBSCANMinClusterSize, c.config.ClusterMinPoints)
+	default:
+		return nil, fmt.Errorf("unknown cluster algorithm '%s', expected one of %s", clustering.Method, strings.Join(cluster.Methods, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range *logs {
+		id := labels[space.UniqueOf(i)]
+		l.Cluster = KibanaLogCluster{ID: id, Outlier: id == cluster.Noise}
+		if l.Cluster.Outlier {
+			clustering.Outliers++
+		}
+	}
+	log.Printf("found %d clusters and %d outliers...", clustering.Clusters, clustering.Outliers)
+	return clustering, nil
+}
+
+// agglomerate builds the dendrogram of the unique logs, as long as their
+// distance matrix fits within the same limit as classical MDS.
+func (c *KibanaClient) agglomerate(space *similarity.Space, logs *KibanaErrorLogs) (*KibanaDendrogram, error) {
+	if c.config.Linkage == "" || c.config.Linkage == "none" {
+		return nil, nil
+	}
+	if space.Len() > c.config.MDSClassicalLimit {
+		log.Printf("skipping dendrogram of %d unique records, over the limit of %d...", space.Len(), c.config.MDSClassicalLimit)
+		return nil, nil
+	}
+	log.Printf("computing %s linkage dendrogram...", c.config.Linkage)
+	weights := make([]float64, space.Len())
+	for i := range weights {
+		weights[i] = space.Weight(i)
+	}
+	d, err := cluster.Agglomerate(space.DistanceMatrix(), weights, c.config.Linkage)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([]int, len(*logs))
+	for i := range leaves {
+		leaves[i] = space.UniqueOf(i)
+	}
+	return &KibanaDendrogram{Dendrogram: d, Leaves: leaves}, nil
+}
+
+// outputDendrogram writes the dendrogram as JSON and as Newick, with each
+// leaf named by the ID of the first log it stands for.
+func outputDendrogram(analysis *KibanaAnalysis, jsonPath, newickPath string) error {
+	d := analysis.dendrogram
+	if d == nil {
+		return nil
+	}
+	if err := output(d, jsonPath); err != nil {
+		return err
+	}
+	names := make([]string, d.Dendrogram.Leaves())
+	for i := len(d.Leaves) - 1; i >= 0; i-- {
+		names[d.Leaves[i]] = analysis.Logs[i].ID
+	}
+	newick := d.Dendrogram.Newick(func(leaf int) string {
+		return names[leaf]
+	})
+	if err := os.WriteFile(newickPath, []byte(newick), 0644); err != nil {
+		return fmt.Errorf("failed to write output: %s", err)
+	}
+	return nil
+}
+
+// cutDendrogram cuts the dendrogram into count clusters, or at threshold
+// when count is not positive, and describes the clusters.
+func cutDendrogram(d *KibanaDendrogram, space *similarity.Space, logs KibanaErrorLogs, threshold float64, count int) (*KibanaClusterCut, error) {
+	if len(d.Leaves) != len(logs) {
+		return nil, fmt.Errorf("dendrogram has %d logs but coordinates have %d", len(d.Leaves), len(logs))
+	}
+	var labels []int
+	if count > 0 {
+		labels, count = d.Dendrogram.CutCount(count)
+	} else {
+		labels, count = d.Dendrogram.CutDistance(threshold)
+	}
+	cut := &KibanaClusterCut{
+		Threshold: threshold,
+		Count:     count,
+		Clusters:  describeClusters(space, logs, count, func(i int) int { return labels[d.Leaves[i]] }),
+		Logs:      make(map[string]int, len(logs)),
+	}
+	for i, l := range logs {
+		cut.Logs[l.ID] = labels[d.Leaves[i]]
+	}
+	return cut, nil
+}
+
+func summariseClusters(analysis *KibanaAnalysis) *KibanaClusters {
+	return &KibanaClusters{
+		Clustering: analysis.Clustering,
+		Clusters:   analysis.Clusters,
+		Outliers:   analysis.Clustering.Outliers,
+	}
+}
+
+// clusterTokens is how many distinguishing tokens label each cluster.
+const clusterTokens = 5
+
+// describeClusters labels each of the given number of clusters, skipping
+// logs labelled as noise. The medoid is measured with the similarity
+// metric of the space the logs were compared in.
+func describeClusters(space *similarity.Space, logs KibanaErrorLogs, clusters int, label func(i int) int) []KibanaCluster {
+	summary := make([]KibanaCluster, clusters)
+	members := make([][]int, clusters)
+	seen := make([]map[int]bool, clusters)
+	tokens := make([]map[string]float64, clusters)
+	first := make([]time.Time, clusters)
+	last := make([]time.Time, clusters)
+	for id := range summary {
+		summary[id] = KibanaCluster{
+			ID:            id,
+			Microservices: map[string]int{},
+			Messages:      map[string]int{},
+			Environments:  map[string]int{},
+		}
+		seen[id] = map[int]bool{}
+		tokens[id] = map[string]float64{}
+	}
+	for i, l := range logs {
+		id := label(i)
+		if id < 0 || id >= clusters {
+			continue
+		}
+		s := &summary[id]
+		s.Size++
+		s.Microservices[l.Source.Microservice]++
+		s.Messages[l.Source.Message]++
+		s.Environments[l.Source.Environment]++
+		if u := space.UniqueOf(i); !seen[id][u] {
+			seen[id][u] = true
+			members[id] = append(members[id], u)
+		}
+		for _, t := range similarity.Tokens(l.Source.ErrorMessage) {
+			// Bare numbers are usually IDs, which make poor labels.
+			if strings.IndexFunc(t, unicode.IsLetter) >= 0 {
+				tokens[id][t]++
+			}
+		}
+		if ts, err := time.Parse(time.RFC3339, l.Source.TimeStamp); err == nil {
+			if first[id].IsZero() || ts.Before(first[id]) {
+				first[id] = ts
+				s.FirstSeen = l.Source.TimeStamp
+			}
+			if last[id].IsZero() || ts.After(last[id]) {
+				last[id] = ts
+				s.LastSeen = l.Source.TimeStamp
+			}
+		}
+	}
+
+	log.Printf("labelling %d clusters...", clusters)
+	distinctive := cluster.DistinctiveTokens(tokens, clusterTokens)
+	medoids := make([]string, space.Len())
+	for i := len(logs) - 1; i >= 0; i-- {
+		medoids[space.UniqueOf(i)] = logs[i].Source.ErrorMessage
+	}
+	for id := range summary {
+		summary[id].Unique = len(members[id])
+		summary[id].Tokens = distinctive[id]
+		if m := cluster.Medoid(space, members[id]); m >= 0 {
+			summary[id].Medoid = medoids[m]
+		}
+	}
+	return summary
+}
@@ -0,0 +1,79 @@
+package kibana
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+)
+
+func TestDescribeClusters(t *testing.T) {
+	logs := KibanaErrorLogs{
+		errorLog("a", "auth", "FailedConnecting", "connection refused to db 1", 120),
+		errorLog("b", "auth", "FailedConnecting", "connection refused to db 2", 0),
+		errorLog("c", "gateway", "FailedConnecting", "connection refused to db 2", 60),
+		errorLog("d", "orders", "FailedReading", "timeout reading order 17", 30),
+		errorLog("e", "orders", "FailedReading", "timeout reading order 17", 90),
+		errorLog("f", "orders", "FailedReading", "unparseable", 0),
+	}
+	logs[5].Source.TimeStamp = "not a time"
+	labels := []int{0, 0, 0, 1, 1, cluster.Noise}
+	c := testClient(t, nil)
+	opts, err := c.similarityOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	space, err := newSpace(logs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := describeClusters(space, logs, 2, func(i int) int { return labels[i] })
+	want := []KibanaCluster{
+		{
+			ID:            0,
+			Size:          3,
+			Unique:        2,
+			Medoid:        "connection refused to db 2",
+			Tokens:        []string{"connection", "db", "refused", "to"},
+			Microservices: map[string]int{"auth": 2, "gateway": 1},
+			Messages:      map[string]int{"FailedConnecting": 3},
+			Environments:  map[string]int{"prod": 3},
+			FirstSeen:     logs[1].Source.TimeStamp,
+			LastSeen:      logs[0].Source.TimeStamp,
+		},
+		{
+			ID:            1,
+			Size:          2,
+			Unique:        1,
+			Medoid:        "timeout reading order 17",
+			Tokens:        []string{"order", "reading", "timeout"},
+			Microservices: map[string]int{"orders": 2},
+			Messages:      map[string]int{"FailedReading": 2},
+			Environments:  map[string]int{"prod": 2},
+			FirstSeen:     logs[3].Source.TimeStamp,
+			LastSeen:      logs[4].Source.TimeStamp,
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d clusters, want %d", len(got), len(want))
+	}
+	for id := range want {
+		g, w := got[id], want[id]
+		if g.ID != w.ID || g.Size != w.Size || g.Unique != w.Unique || g.Medoid != w.Medoid || g.FirstSeen != w.FirstSeen || g.LastSeen != w.LastSeen {
+			t.Errorf("cluster %d: got %+v, want %+v", id, g, w)
+		}
+		if !slices.Equal(g.Tokens, w.Tokens) {
+			t.Errorf("cluster %d: got tokens %v, want %v", id, g.Tokens, w.Tokens)
+		}
+		for _, counts := range [][2]map[string]int{{g.Microservices, w.Microservices}, {g.Messages, w.Messages}, {g.Environments, w.Environments}} {
+			if len(counts[0]) != len(counts[1]) {
+				t.Errorf("cluster %d: got counts %v, want %v", id, counts[0], counts[1])
+			}
+			for k, v := range counts[1] {
+				if counts[0][k] != v {
+					t.Errorf("cluster %d: got counts %v, want %v", id, counts[0], counts[1])
+				}
+			}
+		}
+	}
+}
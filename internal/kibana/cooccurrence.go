@@ -0,0 +1,147 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/timeseries"
+)
+
+// KibanaCoOccurrence is how often an error of one message code or
+// microservice, A, is followed within the window by an error of another,
+// B. Count is the errors of A with one of B within the window either side,
+// Support their share of all logs and Confidence their share of A's logs.
+// Lift compares Confidence with the chance of one of B falling that close
+// if B's errors were scattered at random, and Lag is the median time from
+// each error of A to the nearest of B, in seconds, with LagSpread the
+// median distance of the lags from it.
+type KibanaCoOccurrence struct {
+	Dimension  string  `json:"dimension"`
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	CountA     int     `json:"countA"`
+	CountB     int     `json:"countB"`
+	Count      int     `json:"count"`
+	Support    float64 `json:"support"`
+	Confidence float64 `json:"confidence"`
+	Lift       float64 `json:"lift"`
+	Lag        float64 `json:"lag"`
+	LagSpread  float64 `json:"lagSpread"`
+}
+
+// KibanaCoOccurrences lists the pairs at or above the minimum count and
+// lift where B follows A, highest lift first. Skipped counts the logs left
+// out because their timestamp does not parse.
+type KibanaCoOccurrences struct {
+	Window   string               `json:"window"`
+	MinCount int                  `json:"minCount"`
+	MinLift  float64              `json:"minLift"`
+	Logs     int                  `json:"logs"`
+	Skipped  int                  `json:"skipped"`
+	Pairs    []KibanaCoOccurrence `json:"pairs"`
+}
+
+// coOccurrences compares every pair of message codes, and of
+// microservices, in both directions, and reports each pair once, in the
+// direction which shows which one tends to come first.
+func (c *KibanaClient) coOccurrences(logs KibanaErrorLogs) (*KibanaCoOccurrences, error) {
+	window, err := time.ParseDuration(c.config.CoOccurrenceWindow)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid co-occurrence window '%s'", c.config.CoOccurrenceWindow)
+	}
+	result := &KibanaCoOccurrences{
+		Window:   window.String(),
+		MinCount: c.config.CoOccurrenceMinCount,
+		MinLift:  c.config.CoOccurrenceMinLift,
+		Logs:     len(logs),
+		Pairs:    []KibanaCoOccurrence{},
+	}
+	timed, skipped := byTime(logs)
+	result.Skipped = skipped
+	logSkipped(skipped, "co-occurrences")
+	if len(timed) == 0 {
+		return result, nil
+	}
+	span := timed[len(timed)-1].time.Sub(timed[0].time)
+	log.Printf("finding errors which co-occur within %s...", result.Window)
+	for _, d := range dimensions {
+		if d.name == DimensionCluster {
+			continue
+		}
+		events := map[string][]time.Time{}
+		for _, t := range timed {
+			k := d.key(t.log)
+			events[k] = append(events[k], t.time)
+		}
+		// measure reports how B follows A, and whether it often follows
+		// closely enough, and after rather than before, to be kept.
+		measure := func(a, b string) (KibanaCoOccurrence, bool) {
+			timesA, timesB := events[a], events[b]
+			lags := timeseries.Nearest(timesA, timesB, window)
+			if len(lags) < max(result.MinCount, 1) {
+				return KibanaCoOccurrence{}, false
+			}
+			confidence := float64(len(lags)) / float64(len(timesA))
+			pair := KibanaCoOccurrence{
+				Dimension:  d.name,
+				A:          a,
+				B:          b,
+				CountA:     len(timesA),
+				CountB:     len(timesB),
+				Count:      len(lags),
+				Support:    float64(len(lags)) / float64(len(logs)),
+				Confidence: confidence,
+				Lift:       confidence / timeseries.Chance(len(timesB), span, window),
+			}
+			median := timeseries.MedianLag(lags)
+			if pair.Lift < result.MinLift || median < 0 {
+				return KibanaCoOccurrence{}, false
+			}
+			for i, lag := range lags {
+				lags[i] = (lag - median).Abs()
+			}
+			pair.Lag = median.Seconds()
+			pair.LagSpread = timeseries.MedianLag(lags).Seconds()
+			return pair, true
+		}
+		keys := make([]string, 0, len(events))
+		for k := range events {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, a := range keys {
+			for _, b := range keys[i+1:] {
+				// Each direction is judged on its own, so both may be kept.
+				// Report the one in which B follows soonest, or with the
+				// higher lift when the lags are equal.
+				ab, okAB := measure(a, b)
+				ba, okBA := measure(b, a)
+				switch {
+				case okAB && okBA:
+					if ba.Lag < ab.Lag || (ba.Lag == ab.Lag && ba.Lift > ab.Lift) {
+						ab = ba
+					}
+					result.Pairs = append(result.Pairs, ab)
+				case okAB:
+					result.Pairs = append(result.Pairs, ab)
+				case okBA:
+					result.Pairs = append(result.Pairs, ba)
+				}
+			}
+		}
+	}
+	sort.Slice(result.Pairs, func(a, b int) bool {
+		pa, pb := result.Pairs[a], result.Pairs[b]
+		if pa.Lift != pb.Lift {
+			return pa.Lift > pb.Lift
+		}
+		if pa.A != pb.A {
+			return pa.A < pb.A
+		}
+		return pa.B < pb.B
+	})
+	log.Printf("found %d co-occurring pairs...", len(result.Pairs))
+	return result, nil
+}
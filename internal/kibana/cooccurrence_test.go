@@ -0,0 +1,102 @@
+package kibana
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+func TestCoOccurrences(t *testing.T) {
+	logs := KibanaErrorLogs{}
+	add := func(microservice, message string, seconds int) {
+		logs = append(logs, errorLog(fmt.Sprint(len(logs)), microservice, message, "failed", seconds))
+	}
+	// Every receive failure is followed five seconds later by a delete
+	// failure, while timeouts are spread evenly and unrelated to either.
+	for i := 0; i < 12; i++ {
+		add("inbound", "FailedReceivingFromSQS", i*600)
+		add("cleanup", "FailedDeletingFromSQS", i*600+5)
+		add("orders", "Timeout", i*600+300)
+	}
+	c := testClient(t, func(cfg *config.Config) {
+		cfg.CoOccurrenceWindow = "1m"
+		cfg.CoOccurrenceMinCount = 5
+		cfg.CoOccurrenceMinLift = 3
+	})
+	result, err := c.coOccurrences(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Logs != len(logs) || result.Window != "1m0s" {
+		t.Errorf("got %d logs within %s", result.Logs, result.Window)
+	}
+	want := map[string][2]string{
+		DimensionMessage:      {"FailedReceivingFromSQS", "FailedDeletingFromSQS"},
+		DimensionMicroservice: {"inbound", "cleanup"},
+	}
+	if len(result.Pairs) != len(want) {
+		t.Fatalf("got pairs %+v, want one per dimension", result.Pairs)
+	}
+	for _, p := range result.Pairs {
+		if w, ok := want[p.Dimension]; !ok || p.A != w[0] || p.B != w[1] {
+			t.Errorf("got pair %s -> %s by %s, want %s -> %s", p.A, p.B, p.Dimension, w[0], w[1])
+		}
+		if p.Count != 12 || p.CountA != 12 || p.CountB != 12 || p.Confidence != 1 || p.Lag != 5 || p.LagSpread != 0 {
+			t.Errorf("got %+v", p)
+		}
+		if p.Support != 12.0/36 || p.Lift < 3 {
+			t.Errorf("got support %g and lift %g", p.Support, p.Lift)
+		}
+	}
+
+	c.config.CoOccurrenceMinCount = 13
+	if result, err = c.coOccurrences(logs); err != nil || len(result.Pairs) != 0 {
+		t.Errorf("got %v, %v above the minimum count", result, err)
+	}
+	c.config.CoOccurrenceWindow = "soon"
+	if _, err := c.coOccurrences(logs); err == nil {
+		t.Error("expected an error for an invalid window")
+	}
+}
+
+func TestCoOccurrencesReportOneDirection(t *testing.T) {
+	logs := KibanaErrorLogs{}
+	add := func(message string, seconds int) {
+		logs = append(logs, errorLog(fmt.Sprint(len(logs)), "inbound", message, "failed", seconds))
+	}
+	// A burst of one code is followed by a single log of the other, each
+	// way round, so B follows A and A follows B, but A follows B sooner.
+	for i := 0; i < 3; i++ {
+		add("Alpha", i*1200)
+		add("Alpha", i*1200+1)
+		add("Alpha", i*1200+2)
+		add("Beta", i*1200+7)
+		add("Beta", i*1200+600)
+		add("Beta", i*1200+601)
+		add("Beta", i*1200+602)
+		add("Alpha", i*1200+606)
+	}
+	c := testClient(t, func(cfg *config.Config) {
+		cfg.CoOccurrenceWindow = "30s"
+		cfg.CoOccurrenceMinCount = 3
+		cfg.CoOccurrenceMinLift = 1
+	})
+	for _, reverse := range []bool{false, true} {
+		if reverse {
+			for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+				logs[i], logs[j] = logs[j], logs[i]
+			}
+		}
+		result, err := c.coOccurrences(logs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Pairs) != 1 {
+			t.Fatalf("got pairs %+v, want one", result.Pairs)
+		}
+		if p := result.Pairs[0]; p.A != "Beta" || p.B != "Alpha" || p.Lag <= 0 {
+			t.Errorf("got pair %s -> %s after %gs, want Beta -> Alpha", p.A, p.B, p.Lag)
+		}
+	}
+}
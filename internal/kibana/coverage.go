@@ -0,0 +1,330 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/timeseries"
+)
+
+// KibanaBurst is a burst of errors of one message code which no watch
+// covering that code fired for.
+type KibanaBurst struct {
+	Message          string   `json:"message"`
+	Start            string   `json:"start"`
+	End              string   `json:"end"`
+	Size             int      `json:"size"`
+	PeakRate         int      `json:"peakRate"`
+	Watches          []string `json:"watches"`
+	Representative   string   `json:"representative"`
+	RepresentativeID string   `json:"representativeId"`
+}
+
+// KibanaUnmatchedFire is a watcher fire with no burst of the message codes
+// it covers nearby. NearbyLogs counts the logs of those codes which were
+// nearby, too few to make a burst.
+type KibanaUnmatchedFire struct {
+	ID         string   `json:"id"`
+	WatchID    string   `json:"watchId"`
+	Time       string   `json:"time"`
+	Messages   []string `json:"messages"`
+	NearbyLogs int      `json:"nearbyLogs"`
+}
+
+// KibanaCodeCoverage is the share of a message code's bursts which a watch
+// covering the code fired for. A code no watch covers has no Watches, and
+// codes whose logs made no burst come last.
+type KibanaCodeCoverage struct {
+	Message  string   `json:"message"`
+	Watches  []string `json:"watches"`
+	Logs     int      `json:"logs"`
+	Bursts   int      `json:"bursts"`
+	Covered  int      `json:"covered"`
+	Coverage float64  `json:"coverage"`
+}
+
+// KibanaWatchCoverage is the share of a watch's fires with a burst of one
+// of its message codes nearby. Watches covering no code cannot be matched
+// and are counted as unmapped.
+type KibanaWatchCoverage struct {
+	WatchID  string   `json:"watchId"`
+	Messages []string `json:"messages"`
+	Unmapped bool     `json:"unmapped"`
+	Fires    int      `json:"fires"`
+	Matched  int      `json:"matched"`
+	Coverage float64  `json:"coverage"`
+}
+
+// KibanaAlertCoverage compares the error bursts of each message code with
+// the fires of the watches covering it in WatcherErrorMapping, over the
+// period both the errors and the watcher executions span. A burst and a
+// fire are nearby when they are no more than Window apart. Skipped counts
+// the logs left out because their timestamp does not parse.
+type KibanaAlertCoverage struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Gap       string                `json:"gap"`
+	MinLogs   int                   `json:"minLogs"`
+	Window    string                `json:"window"`
+	Skipped   int                   `json:"skipped"`
+	Bursts    int                   `json:"bursts"`
+	Covered   int                   `json:"covered"`
+	Coverage  float64               `json:"coverage"`
+	Fires     int                   `json:"fires"`
+	Matched   int                   `json:"matched"`
+	Precision float64               `json:"precision"`
+	Codes     []KibanaCodeCoverage  `json:"codes"`
+	Watches   []KibanaWatchCoverage `json:"watches"`
+	Uncovered []KibanaBurst         `json:"uncovered"`
+	Unmatched []KibanaUnmatchedFire `json:"unmatched"`
+}
+
+// watchesOf lists the watches covering each message code.
+func watchesOf() map[string][]string {
+	watches := map[string][]string{}
+	for watch, codes := range WatcherErrorMapping {
+		for _, code := range codes {
+			watches[code] = append(watches[code], watch)
+		}
+	}
+	for _, w := range watches {
+		slices.Sort(w)
+	}
+	return watches
+}
+
+// near reports whether any of times, which must be sorted, lies within
+// window of the range from start to end.
+func near(times []time.Time, start, end time.Time, window time.Duration) bool {
+	i := sort.Search(len(times), func(i int) bool { return !times[i].Before(start.Add(-window)) })
+	return i < len(times) && !times[i].After(end.Add(window))
+}
+
+// countNear counts the times, which must be sorted, within window of t.
+func countNear(times []time.Time, t time.Time, window time.Duration) int {
+	lo := sort.Search(len(times), func(i int) bool { return !times[i].Before(t.Add(-window)) })
+	hi := sort.Search(len(times), func(i int) bool { return times[i].After(t.Add(window)) })
+	return hi - lo
+}
+
+func share(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// alertCoverage finds the bursts of each message code as incidents are
+// found, and matches them with the fires of the watches covering the code.
+func (c *KibanaClient) alertCoverage(logs KibanaErrorLogs, executions *KibanaWatcherLogs) (*KibanaAlertCoverage, error) {
+	gap, err := time.ParseDuration(c.config.IncidentGap)
+	if err != nil || gap <= 0 {
+		return nil, fmt.Errorf("invalid incident gap '%s'", c.config.IncidentGap)
+	}
+	timed, skipped := byTime(logs)
+	logSkipped(skipped, "alert coverage")
+	fires, err := watcherFires(executions)
+	if err != nil {
+		return nil, err
+	}
+	if len(timed) == 0 || len(fires) == 0 {
+		return nil, fmt.Errorf("alert coverage needs both error logs and watcher executions")
+	}
+	from := timed[0].time
+	if fires[0].time.After(from) {
+		from = fires[0].time
+	}
+	to := timed[len(timed)-1].time
+	if fires[len(fires)-1].time.Before(to) {
+		to = fires[len(fires)-1].time
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("error logs from %s to %s and watcher executions from %s to %s do not overlap",
+			timed[0].time.Format(time.RFC3339), timed[len(timed)-1].time.Format(time.RFC3339),
+			fires[0].time.Format(time.RFC3339), fires[len(fires)-1].time.Format(time.RFC3339))
+	}
+	result := &KibanaAlertCoverage{
+		From:      from.Format(time.RFC3339),
+		To:        to.Format(time.RFC3339),
+		Gap:       gap.String(),
+		MinLogs:   c.config.IncidentMinLogs,
+		Window:    alertWindow.String(),
+		Skipped:   skipped,
+		Codes:     []KibanaCodeCoverage{},
+		Watches:   []KibanaWatchCoverage{},
+		Uncovered: []KibanaBurst{},
+		Unmatched: []KibanaUnmatchedFire{},
+	}
+	log.Printf("comparing error bursts with watcher fires from %s to %s...", result.From, result.To)
+
+	byCode := map[string][]timedLog{}
+	for _, t := range timed {
+		if !t.time.Before(from) && !t.time.After(to) {
+			byCode[t.log.Source.Message] = append(byCode[t.log.Source.Message], t)
+		}
+	}
+	byWatch := map[string][]time.Time{}
+	for _, f := range fires {
+		if !f.time.Before(from) && !f.time.After(to) {
+			byWatch[f.execution.Source.WatchId] = append(byWatch[f.execution.Source.WatchId], f.time)
+		}
+	}
+
+	// burstRanges holds the start and end of every burst of each code, for
+	// matching fires to them.
+	burstRanges := map[string][][2]time.Time{}
+	codeTimes := map[string][]time.Time{}
+	watches := watchesOf()
+	for code, group := range byCode {
+		cc := KibanaCodeCoverage{Message: code, Watches: watches[code], Logs: len(group)}
+		if cc.Watches == nil {
+			cc.Watches = []string{}
+		}
+		groupTimes := times(group)
+		codeTimes[code] = groupTimes
+		for _, b := range timeseries.Bursts(groupTimes, gap, c.config.IncidentMinLogs) {
+			burst := group[b[0]:b[1]]
+			start, end := burst[0].time, burst[len(burst)-1].time
+			burstRanges[code] = append(burstRanges[code], [2]time.Time{start, end})
+			cc.Bursts++
+			covered := false
+			for _, watch := range cc.Watches {
+				covered = covered || near(byWatch[watch], start, end, alertWindow)
+			}
+			if covered {
+				cc.Covered++
+				continue
+			}
+			r := representative(burst)
+			result.Uncovered = append(result.Uncovered, KibanaBurst{
+				Message:          code,
+				Start:            start.Format(time.RFC3339),
+				End:              end.Format(time.RFC3339),
+				Size:             len(burst),
+				PeakRate:         timeseries.PeakRate(groupTimes[b[0]:b[1]], time.Minute),
+				Watches:          cc.Watches,
+				Representative:   r.Source.ErrorMessage,
+				RepresentativeID: r.ID,
+			})
+		}
+		cc.Coverage = share(cc.Covered, cc.Bursts)
+		result.Bursts += cc.Bursts
+		result.Covered += cc.Covered
+		result.Codes = append(result.Codes, cc)
+	}
+
+	for _, f := range fires {
+		if f.time.Before(from) || f.time.After(to) {
+			continue
+		}
+		watch := f.execution.Source.WatchId
+		codes := WatcherErrorMapping[watch]
+		matched, nearby := false, 0
+		for _, code := range codes {
+			for _, r := range burstRanges[code] {
+				matched = matched || (!f.time.Before(r[0].Add(-alertWindow)) && !f.time.After(r[1].Add(alertWindow)))
+			}
+			nearby += countNear(codeTimes[code], f.time, alertWindow)
+		}
+		i := slices.IndexFunc(result.Watches, func(w KibanaWatchCoverage) bool { return w.WatchID == watch })
+		if i < 0 {
+			i = len(result.Watches)
+			result.Watches = append(result.Watches, KibanaWatchCoverage{WatchID: watch, Messages: codes, Unmapped: len(codes) == 0})
+			if codes == nil {
+				result.Watches[i].Messages = []string{}
+			}
+		}
+		w := &result.Watches[i]
+		w.Fires++
+		if w.Unmapped {
+			continue
+		}
+		result.Fires++
+		if matched {
+			w.Matched++
+			result.Matched++
+			continue
+		}
+		result.Unmatched = append(result.Unmatched, KibanaUnmatchedFire{
+			ID:         f.execution.ID,
+			WatchID:    watch,
+			Time:       f.time.Format(time.RFC3339),
+			Messages:   w.Messages,
+			NearbyLogs: nearby,
+		})
+	}
+	// Watches which never fired despite bursts of their codes belong in the
+	// report too.
+	for _, cc := range result.Codes {
+		if cc.Bursts == 0 {
+			continue
+		}
+		for _, watch := range cc.Watches {
+			if !slices.ContainsFunc(result.Watches, func(w KibanaWatchCoverage) bool { return w.WatchID == watch }) {
+				result.Watches = append(result.Watches, KibanaWatchCoverage{WatchID: watch, Messages: WatcherErrorMapping[watch]})
+			}
+		}
+	}
+	for i := range result.Watches {
+		result.Watches[i].Coverage = share(result.Watches[i].Matched, result.Watches[i].Fires)
+	}
+	result.Coverage = share(result.Covered, result.Bursts)
+	result.Precision = share(result.Matched, result.Fires)
+
+	sort.Slice(result.Codes, func(a, b int) bool {
+		ca, cb := result.Codes[a], result.Codes[b]
+		if (ca.Bursts == 0) != (cb.Bursts == 0) {
+			return cb.Bursts == 0
+		}
+		if ca.Coverage != cb.Coverage {
+			return ca.Coverage < cb.Coverage
+		}
+		if ca.Bursts != cb.Bursts {
+			return ca.Bursts > cb.Bursts
+		}
+		return ca.Message < cb.Message
+	})
+	sort.Slice(result.Watches, func(a, b int) bool {
+		wa, wb := result.Watches[a], result.Watches[b]
+		if wa.Unmapped != wb.Unmapped {
+			return !wa.Unmapped
+		}
+		if wa.Coverage != wb.Coverage {
+			return wa.Coverage < wb.Coverage
+		}
+		if wa.Fires != wb.Fires {
+			return wa.Fires > wb.Fires
+		}
+		return wa.WatchID < wb.WatchID
+	})
+	sort.SliceStable(result.Uncovered, func(a, b int) bool {
+		return result.Uncovered[a].Start < result.Uncovered[b].Start
+	})
+	log.Printf("%d of %d error bursts were alerted on and %d of %d watcher fires had a burst nearby...",
+		result.Covered, result.Bursts, result.Matched, result.Fires)
+	return result, nil
+}
+
+// FindAlertCoverage compares the analysed errors with the watcher
+// executions of the alerts analysis.
+func (c *KibanaClient) FindAlertCoverage() (*KibanaAlertCoverage, error) {
+	logs, err := c.GetErrors()
+	if err != nil {
+		return nil, err
+	}
+	executions, err := readWatcherExecutions(AlertsExecutionsOutputPath)
+	if err != nil {
+		return nil, err
+	}
+	coverage, err := c.alertCoverage(*logs, executions)
+	if err != nil {
+		return nil, err
+	}
+	if err := output(coverage, ErrorsCoverageOutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write alert coverage: %s", err)
+	}
+	return coverage, nil
+}
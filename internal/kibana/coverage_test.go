@@ -0,0 +1,156 @@
+package kibana
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+// fire makes an execution of the watch the given number of seconds after
+// the epoch.
+func fire(id, watch string, seconds int) *KibanaWatcherLog {
+	return &KibanaWatcherLog{
+		ID: id,
+		Source: KibanaWatcherLogSource{
+			WatchId: watch,
+			Result: KibanaWatcherLogResult{
+				ExecutionTime: epoch.Add(time.Duration(seconds) * time.Second).Format(time.RFC3339),
+				Condition:     KibanaWatcherLogCondition{Met: true},
+			},
+		},
+	}
+}
+
+func TestAlertCoverage(t *testing.T) {
+	logs := KibanaErrorLogs{}
+	burst := func(message string, start, size int) {
+		for i := 0; i < size; i++ {
+			logs = append(logs, errorLog(fmt.Sprint(len(logs)), "inbound", message, "failed", start+15*i))
+		}
+	}
+	burst("FailedReceivingFromSQS", 0, 5)
+	burst("FailedReceivingFromSQS", 7200, 5)
+	burst("FailedSigning", 10800, 2)
+	burst("Mystery", 14400, 3)
+	fingerprint(logs)
+	executions := KibanaWatcherLogs{
+		fire("general-1", "BMS_PRD1_GeneralError", -60),
+		fire("receiving", "BMS_PRD1_FailedReceivingFromSQS", 120),
+		fire("general-2", "BMS_PRD1_GeneralError", 3600),
+		fire("signing", "BMS_PRD1_FailedSigning", 10860),
+		fire("general-3", "BMS_PRD1_GeneralError", 18000),
+	}
+	c := testClient(t, func(cfg *config.Config) {
+		cfg.IncidentGap = "15m"
+		cfg.IncidentMinLogs = 3
+	})
+	result, err := c.alertCoverage(logs, &executions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.From != epoch.Format(time.RFC3339) || result.To != logs[len(logs)-1].Source.TimeStamp {
+		t.Errorf("got period from %s to %s", result.From, result.To)
+	}
+	if result.Bursts != 3 || result.Covered != 1 || result.Coverage != 1.0/3 {
+		t.Errorf("got %d of %d bursts covered, %g", result.Covered, result.Bursts, result.Coverage)
+	}
+	// Fires of the unmapped general error watch are not counted, and only
+	// fires within the period the logs span are compared.
+	if result.Fires != 2 || result.Matched != 1 || result.Precision != 0.5 {
+		t.Errorf("got %d of %d fires matched, %g", result.Matched, result.Fires, result.Precision)
+	}
+
+	codes := []string{}
+	for _, cc := range result.Codes {
+		codes = append(codes, fmt.Sprintf("%s %d/%d", cc.Message, cc.Covered, cc.Bursts))
+	}
+	if want := []string{"Mystery 0/1", "FailedReceivingFromSQS 1/2", "FailedSigning 0/0"}; !slices.Equal(codes, want) {
+		t.Errorf("got codes %v, want %v", codes, want)
+	}
+	watches := []string{}
+	for _, w := range result.Watches {
+		watches = append(watches, fmt.Sprintf("%s %d/%d %t", w.WatchID, w.Matched, w.Fires, w.Unmapped))
+	}
+	if want := []string{
+		"BMS_PRD1_FailedSigning 0/1 false",
+		"BMS_PRD1_FailedReceivingFromSQS 1/1 false",
+		"BMS_PRD1_GeneralError 0/1 true",
+	}; !slices.Equal(watches, want) {
+		t.Errorf("got watches %v, want %v", watches, want)
+	}
+
+	if len(result.Uncovered) != 2 {
+		t.Fatalf("got uncovered bursts %+v, want two", result.Uncovered)
+	}
+	if b := result.Uncovered[0]; b.Message != "FailedReceivingFromSQS" || b.Size != 5 || !slices.Equal(b.Watches, []string{"BMS_PRD1_FailedReceivingFromSQS"}) || b.RepresentativeID != "5" {
+		t.Errorf("got first uncovered burst %+v", b)
+	}
+	if b := result.Uncovered[1]; b.Message != "Mystery" || b.Size != 3 || len(b.Watches) != 0 {
+		t.Errorf("got second uncovered burst %+v", b)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0].ID != "signing" || result.Unmatched[0].NearbyLogs != 2 {
+		t.Errorf("got unmatched fires %+v, want the signing fire near two logs", result.Unmatched)
+	}
+}
+
+func TestAlertCoverageErrors(t *testing.T) {
+	c := testClient(t, nil)
+	logs := KibanaErrorLogs{errorLog("a", "inbound", "FailedSigning", "failed", 0)}
+	late := KibanaWatcherLogs{fire("late", "BMS_PRD1_FailedSigning", 86400)}
+	tests := []struct {
+		name       string
+		logs       KibanaErrorLogs
+		executions *KibanaWatcherLogs
+	}{
+		{"no executions", logs, nil},
+		{"no logs", KibanaErrorLogs{}, &late},
+		{"no overlap", logs, &late},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.alertCoverage(tt.logs, tt.executions); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCachedWatcherLogsFetchExecutions(t *testing.T) {
+	inTempDir(t, &AlertsWatcherOutputPath)
+	inTempDir(t, &AlertsExecutionsOutputPath)
+	if err := output(KibanaErrorLogs{errorLog("f1", "inbound", "FailedSigning", "failed", 0)}, AlertsWatcherOutputPath); err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	kibana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"hits": {"total": 1, "hits": [{"_id": "f1", "_source": {"watch_id": "BMS_SigningErrors", "result": {"execution_time": %q, "condition": {"met": true}}}}]}}`,
+			epoch.Format(time.RFC3339))
+	}))
+	defer kibana.Close()
+	c := testClient(t, func(cfg *config.Config) { cfg.KibanaURL = kibana.URL })
+
+	// The error logs are cached but the executions are not, so only the
+	// executions are fetched, once.
+	for run := 0; run < 2; run++ {
+		logs, err := c.loadWatcherLogs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*logs) != 1 || requests != 1 {
+			t.Errorf("run %d: got %d logs after %d requests, want 1 after 1", run, len(*logs), requests)
+		}
+	}
+	executions, err := readWatcherExecutions(AlertsExecutionsOutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*executions) != 1 || (*executions)[0].Source.WatchId != "BMS_SigningErrors" {
+		t.Errorf("got executions %+v, want the fetched fire", *executions)
+	}
+}
@@ -0,0 +1,85 @@
+package kibana
+
+import (
+	"log"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// duplicatePairLimit caps how many candidate pairs are written out, most
+// similar first.
+const duplicatePairLimit = 10000
+
+type KibanaDuplicateGroup struct {
+	Size          int            `json:"size"`
+	Message       string         `json:"message"`
+	Microservices map[string]int `json:"microservices"`
+	IDs           []string       `json:"ids"`
+}
+
+type KibanaDuplicatePair struct {
+	A       string  `json:"a"`
+	B       string  `json:"b"`
+	Jaccard float64 `json:"jaccard"`
+}
+
+// KibanaNearDuplicates lists the groups of logs whose normalised messages
+// are near duplicates by MinHash, and candidate pairs of distinct logs with
+// their estimated Jaccard similarity.
+type KibanaNearDuplicates struct {
+	Threshold float64                `json:"threshold"`
+	Groups    []KibanaDuplicateGroup `json:"groups"`
+	Pairs     []KibanaDuplicatePair  `json:"pairs"`
+}
+
+// nearDuplicates reports the near duplicates found by the space's LSH
+// index, or nil when MinHash is off. Logs without a near duplicate are left
+// out of the groups.
+func (c *KibanaClient) nearDuplicates(space *similarity.Space, logs KibanaErrorLogs) *KibanaNearDuplicates {
+	groups, pairs := space.NearDuplicates(c.config.NearDuplicateThreshold)
+	if groups == nil {
+		return nil
+	}
+	duplicates := &KibanaNearDuplicates{
+		Threshold: c.config.NearDuplicateThreshold,
+		Groups:    []KibanaDuplicateGroup{},
+		Pairs:     []KibanaDuplicatePair{},
+	}
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		group := KibanaDuplicateGroup{
+			Size:          len(g),
+			Message:       logs[g[0]].Source.ErrorMessage,
+			Microservices: map[string]int{},
+			IDs:           make([]string, len(g)),
+		}
+		for k, i := range g {
+			group.Microservices[logs[i].Source.Microservice]++
+			group.IDs[k] = logs[i].ID
+		}
+		duplicates.Groups = append(duplicates.Groups, group)
+	}
+	if len(pairs) > duplicatePairLimit {
+		log.Printf("keeping the %d most similar of %d candidate pairs...", duplicatePairLimit, len(pairs))
+		pairs = pairs[:duplicatePairLimit]
+	}
+	for _, p := range pairs {
+		duplicates.Pairs = append(duplicates.Pairs, KibanaDuplicatePair{
+			A:       logs[p.A].ID,
+			B:       logs[p.B].ID,
+			Jaccard: p.Jaccard,
+		})
+	}
+	log.Printf("found %d groups of near duplicates and %d candidate pairs...", len(duplicates.Groups), len(duplicates.Pairs))
+	return duplicates
+}
+
+// outputDuplicates writes the near duplicate report when MinHash is on.
+func outputDuplicates(analysis *KibanaAnalysis, path string) error {
+	if analysis.duplicates == nil {
+		return nil
+	}
+	return output(analysis.duplicates, path)
+}
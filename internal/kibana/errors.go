@@ -1,11 +1,14 @@
 package kibana
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
 	"github.com/atoscerebro/bms-analysis/internal/similarity"
 	"github.com/go-viper/mapstructure/v2"
 )
@@ -35,6 +38,18 @@ var ErrorKeywords = []string{
 
 var ErrorsMessageOutputPath = "errors-message-output.json"
 var ErrorsCoordinatesOutputPath = "errors-coordinate-output.json"
+var ErrorsClusterOutputPath = "errors-cluster-output.json"
+var ErrorsDendrogramOutputPath = "errors-dendrogram-output.json"
+var ErrorsNewickOutputPath = "errors-dendrogram-output.nwk"
+var ErrorsModelOutputPath = "errors-model-output.json"
+var ErrorsDuplicatesOutputPath = "errors-duplicates-output.json"
+var ErrorsHistoryPath = "errors-fingerprint-history.json"
+var ErrorsTrendsOutputPath = "errors-trends-output.json"
+var ErrorsTimeSeriesOutputPath = "errors-timeseries-output.json"
+var ErrorsTimeSeriesCSVOutputPath = "errors-timeseries-output.csv"
+var ErrorsIncidentsOutputPath = "errors-incidents-output.json"
+var ErrorsCoOccurrenceOutputPath = "errors-cooccurrence-output.json"
+var ErrorsCoverageOutputPath = "errors-coverage-output.json"
 
 type KibanaErrorLogSource struct {
 	CorrelationId string `json:"correlationId"`
@@ -52,6 +67,8 @@ type KibanaErrorLog = struct {
 	Source      KibanaErrorLogSource `json:"_source"`
 	Sort        []interface{}        `json:"sort"`
 	Coordinates KibanaLogCoordinates `json:"coordinates"`
+	Cluster     KibanaLogCluster     `json:"cluster"`
+	Fingerprint string               `json:"fingerprint"`
 }
 
 type KibanaLogErrorComparable struct {
@@ -62,6 +79,23 @@ func (kl *KibanaLogErrorComparable) Metric() string {
 	return kl.Source.ErrorMessage
 }
 
+// Features reports a timestamp which does not parse on the timestamp
+// feature alone, so it only matters when that feature is weighted.
+func (kl *KibanaLogErrorComparable) Features() []similarity.Feature {
+	timestamp, err := time.Parse(time.RFC3339, kl.Source.TimeStamp)
+	if err != nil {
+		err = fmt.Errorf("failed to parse time of log %s: %s", kl.ID, err)
+	}
+	return []similarity.Feature{
+		{Name: "errorMessage", Kind: similarity.FeatureText, Text: kl.Source.ErrorMessage},
+		{Name: "microservice", Kind: similarity.FeatureCategorical, Text: kl.Source.Microservice},
+		{Name: "message", Kind: similarity.FeatureCategorical, Text: kl.Source.Message},
+		{Name: "environment", Kind: similarity.FeatureCategorical, Text: kl.Source.Environment},
+		{Name: "httpStatus", Kind: similarity.FeatureNumeric, Number: float64(kl.Source.HttpStatus)},
+		{Name: "timestamp", Kind: similarity.FeatureTime, Time: timestamp, Err: err},
+	}
+}
+
 type KibanaErrorLogs []*KibanaErrorLog
 
 func (kl *KibanaErrorLogs) ByMessage() map[string][]*KibanaErrorLog {
@@ -149,16 +183,69 @@ func (c *KibanaClient) GetErrorsForMessageKeywords(keywords []string) (*KibanaEr
 // }
 
 func (c *KibanaClient) GetErrors() (*KibanaErrorLogs, error) {
-	var logs *KibanaErrorLogs
-	var err error
-	errorsFile, err := os.ReadFile(ErrorsCoordinatesOutputPath)
+	analysis, err := readAnalysis(ErrorsCoordinatesOutputPath)
+	if err != nil {
+		return nil, err
+	}
+	return &analysis.Logs, nil
+}
+
+// readAnalysis loads a coordinates file. Files written before the metric
+// was recorded are a bare array of logs compared with levenshtein, none of
+// which were clustered.
+func readAnalysis(path string) (*KibanaAnalysis, error) {
+	file, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read logs file: %s", err)
 	}
-	if err = json.Unmarshal(errorsFile, &logs); err != nil {
+	if trimmed := bytes.TrimSpace(file); len(trimmed) > 0 && trimmed[0] == '[' {
+		var logs KibanaErrorLogs
+		if err = json.Unmarshal(file, &logs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal logs: %s", err)
+		}
+		for _, l := range logs {
+			if l != nil {
+				l.Cluster = KibanaLogCluster{ID: cluster.Noise}
+			}
+		}
+		return &KibanaAnalysis{Metric: similarity.MetricLevenshtein, Logs: logs}, nil
+	}
+	var analysis *KibanaAnalysis
+	if err = json.Unmarshal(file, &analysis); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal logs: %s", err)
 	}
-	return logs, nil
+	return analysis, nil
+}
+
+// CutErrors cuts the saved error dendrogram into count clusters, or at the
+// distance threshold when count is not positive, measuring the clusters
+// with the metric and weights the errors were analysed with.
+func (c *KibanaClient) CutErrors(threshold float64, count int) (*KibanaClusterCut, error) {
+	var d *KibanaDendrogram
+	dendrogramFile, err := os.ReadFile(ErrorsDendrogramOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dendrogram file: %s", err)
+	}
+	if err = json.Unmarshal(dendrogramFile, &d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dendrogram: %s", err)
+	}
+	analysis, err := readAnalysis(ErrorsCoordinatesOutputPath)
+	if err != nil {
+		return nil, err
+	}
+	metric := analysis.Metric
+	if metric == "" {
+		metric = c.config.SimilarityMetric
+	}
+	opts, err := c.analysisOptions(metric, analysis.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure similarity: %s", err)
+	}
+	space, err := newSpace(analysis.Logs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return cutDendrogram(d, space, analysis.Logs, threshold, count)
 }
 
 func (c *KibanaClient) AnalyseErrors() error {
@@ -182,19 +269,58 @@ func (c *KibanaClient) AnalyseErrors() error {
 	}
 
 	log.Println("calculating error similarity...")
-	comparableLogs := make([]similarity.Comparable, len(*logs))
-	for i, l := range *logs {
-		comparableLogs[i] = &KibanaLogErrorComparable{l}
+	analysis, err := c.analyse(logs, ErrorsModelOutputPath, ErrorsCoordinatesOutputPath)
+	if err != nil {
+		return err
+	}
+	if err := output(analysis, ErrorsCoordinatesOutputPath); err != nil {
+		return fmt.Errorf("failed to write coordinates: %s", err)
+	}
+	if err := outputModel(analysis, ErrorsModelOutputPath); err != nil {
+		return fmt.Errorf("failed to write model: %s", err)
+	}
+	if err := output(summariseClusters(analysis), ErrorsClusterOutputPath); err != nil {
+		return fmt.Errorf("failed to write clusters: %s", err)
 	}
-	coords, err := similarity.Coordinates(comparableLogs)
+	if err := outputDendrogram(analysis, ErrorsDendrogramOutputPath, ErrorsNewickOutputPath); err != nil {
+		return fmt.Errorf("failed to write dendrogram: %s", err)
+	}
+	if err := outputDuplicates(analysis, ErrorsDuplicatesOutputPath); err != nil {
+		return fmt.Errorf("failed to write near duplicates: %s", err)
+	}
+	if err := c.trackFingerprints(analysis.Logs, ErrorsHistoryPath, ErrorsTrendsOutputPath); err != nil {
+		return fmt.Errorf("failed to track fingerprints: %s", err)
+	}
+	ts, err := c.timeSeries(analysis.Logs, "")
 	if err != nil {
-		return fmt.Errorf("failed to calculate coordinates: %s", err)
+		return err
 	}
-	for i, coord := range coords {
-		(*logs)[i].Coordinates.Error = coord
+	if err := outputTimeSeries(ts, ErrorsTimeSeriesOutputPath, ErrorsTimeSeriesCSVOutputPath); err != nil {
+		return fmt.Errorf("failed to write time series: %s", err)
 	}
-	if err := output(logs, ErrorsCoordinatesOutputPath); err != nil {
-		return fmt.Errorf("failed to write coordinates: %s", err)
+	executions := optionalWatcherExecutions(analysis.Logs)
+	incidents, err := c.incidents(analysis.Logs, executions)
+	if err != nil {
+		return err
+	}
+	if err := output(incidents, ErrorsIncidentsOutputPath); err != nil {
+		return fmt.Errorf("failed to write incidents: %s", err)
+	}
+	if executions != nil {
+		// Coverage is a by-product here, so missing or stale executions
+		// skip it rather than the analyses after it.
+		if coverage, err := c.alertCoverage(analysis.Logs, executions); err != nil {
+			log.Printf("skipping alert coverage: %s", err)
+		} else if err := output(coverage, ErrorsCoverageOutputPath); err != nil {
+			return fmt.Errorf("failed to write alert coverage: %s", err)
+		}
+	}
+	coOccurrences, err := c.coOccurrences(analysis.Logs)
+	if err != nil {
+		return err
+	}
+	if err := output(coOccurrences, ErrorsCoOccurrenceOutputPath); err != nil {
+		return fmt.Errorf("failed to write co-occurrences: %s", err)
 	}
 
 	return nil
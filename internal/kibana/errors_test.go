@@ -0,0 +1,84 @@
+package kibana
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+func TestReadAnalysis(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		metric  string
+		coord   similarity.Coordinate
+		cluster int
+	}{
+		{
+			"analysis",
+			`{"metric": "jaccard", "logs": [{"_id": "a", "_source": {"errorMessage": "boom"}, "coordinates": {"error": [1, 2, 3]}, "cluster": {"id": 4}}]}`,
+			"jaccard", similarity.Coordinate{1, 2, 3}, 4,
+		},
+		{
+			"bare array",
+			`[{"_id": "a", "_source": {"errorMessage": "boom"}, "coordinates": {"error": [1, 2]}}]`,
+			similarity.MetricLevenshtein, similarity.Coordinate{1, 2}, cluster.Noise,
+		},
+		{
+			"bare array of x and y",
+			` [{"_id": "a", "_source": {"errorMessage": "boom"}, "coordinates": {"error": {"X": 1, "Y": 2}}}]`,
+			similarity.MetricLevenshtein, similarity.Coordinate{1, 2}, cluster.Noise,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, &ErrorsCoordinatesOutputPath)
+			if err := os.WriteFile(ErrorsCoordinatesOutputPath, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			analysis, err := readAnalysis(ErrorsCoordinatesOutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if analysis.Metric != tt.metric {
+				t.Errorf("got metric %s, want %s", analysis.Metric, tt.metric)
+			}
+			logs, err := testClient(t, nil).GetErrors()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*logs) != 1 {
+				t.Fatalf("got %d logs, want 1", len(*logs))
+			}
+			l := (*logs)[0]
+			if l.ID != "a" || l.Source.ErrorMessage != "boom" || l.Cluster.ID != tt.cluster || !reflect.DeepEqual(l.Coordinates.Error, tt.coord) {
+				t.Errorf("got %+v", l)
+			}
+		})
+	}
+}
+
+func TestReadAnalysisErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"malformed analysis", `{"logs": 1}`},
+		{"malformed array", `[1]`},
+		{"malformed coordinate", `[{"coordinates": {"error": "a"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, &ErrorsCoordinatesOutputPath)
+			if err := os.WriteFile(ErrorsCoordinatesOutputPath, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readAnalysis(ErrorsCoordinatesOutputPath); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
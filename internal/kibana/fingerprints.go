@@ -0,0 +1,272 @@
+package kibana
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+const (
+	TrendNew       = "new"
+	TrendRegressed = "regressed"
+	TrendGrowing   = "growing"
+	TrendShrinking = "shrinking"
+	TrendResolved  = "resolved"
+	TrendStable    = "stable"
+)
+
+// trendOrder ranks statuses in the trend report, most pressing first.
+var trendOrder = []string{TrendNew, TrendRegressed, TrendGrowing, TrendShrinking, TrendResolved, TrendStable}
+
+// Fingerprint identifies an error pattern across runs by hashing its
+// normalised errorMessage template together with its message code and
+// microservice, so the same error gets the same fingerprint every time.
+func Fingerprint(l *KibanaErrorLog) string {
+	h := sha256.New()
+	for _, part := range []string{similarity.Normalise(l.Source.ErrorMessage), l.Source.Message, l.Source.Microservice} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+type KibanaFingerprint struct {
+	Template     string `json:"template"`
+	Message      string `json:"message"`
+	Microservice string `json:"microservice"`
+}
+
+// KibanaFingerprintRun is the number of logs with each fingerprint in one
+// dataset, identified by a hash of its log IDs so that rerunning the latest
+// dataset replaces its counts rather than adding them again.
+type KibanaFingerprintRun struct {
+	Dataset string         `json:"dataset"`
+	Time    string         `json:"time"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Logs    int            `json:"logs"`
+	Counts  map[string]int `json:"counts"`
+}
+
+// KibanaFingerprintHistory holds the runs of a pipeline oldest first and
+// what each fingerprint stands for.
+type KibanaFingerprintHistory struct {
+	Fingerprints map[string]KibanaFingerprint `json:"fingerprints"`
+	Runs         []KibanaFingerprintRun       `json:"runs"`
+}
+
+type KibanaTrend struct {
+	Fingerprint string `json:"fingerprint"`
+	KibanaFingerprint
+	Status        string  `json:"status"`
+	Count         int     `json:"count"`
+	PreviousCount int     `json:"previousCount"`
+	Change        float64 `json:"change"`
+	LastSeen      string  `json:"lastSeen,omitempty"`
+}
+
+// KibanaTrends compares the fingerprint counts of a run with the run
+// before it. Change is the relative change in count, and LastSeen the
+// latest earlier run a regressed fingerprint appeared in.
+type KibanaTrends struct {
+	Dataset  string         `json:"dataset"`
+	Previous string         `json:"previous,omitempty"`
+	Summary  map[string]int `json:"summary"`
+	Trends   []KibanaTrend  `json:"trends"`
+}
+
+// fingerprint writes the fingerprint of every log into it.
+func fingerprint(logs KibanaErrorLogs) {
+	for _, l := range logs {
+		l.Fingerprint = Fingerprint(l)
+	}
+}
+
+func readHistory(path string) (*KibanaFingerprintHistory, error) {
+	history := &KibanaFingerprintHistory{
+		Fingerprints: map[string]KibanaFingerprint{},
+		Runs:         []KibanaFingerprintRun{},
+	}
+	file, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fingerprint history: %s", err)
+	}
+	if err = json.Unmarshal(file, history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fingerprint history: %s", err)
+	}
+	return history, nil
+}
+
+// run counts the fingerprints of the logs, which must already carry them.
+// From and To are the earliest and latest timestamps that parse.
+func run(logs KibanaErrorLogs, history *KibanaFingerprintHistory) KibanaFingerprintRun {
+	ids := make([]string, len(logs))
+	var from, to time.Time
+	r := KibanaFingerprintRun{
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Logs:   len(logs),
+		Counts: map[string]int{},
+	}
+	for i, l := range logs {
+		ids[i] = l.ID
+		r.Counts[l.Fingerprint]++
+		if ts, err := time.Parse(time.RFC3339, l.Source.TimeStamp); err == nil {
+			if from.IsZero() || ts.Before(from) {
+				from = ts
+				r.From = l.Source.TimeStamp
+			}
+			if to.IsZero() || ts.After(to) {
+				to = ts
+				r.To = l.Source.TimeStamp
+			}
+		}
+		if _, ok := history.Fingerprints[l.Fingerprint]; !ok {
+			history.Fingerprints[l.Fingerprint] = KibanaFingerprint{
+				Template:     similarity.Normalise(l.Source.ErrorMessage),
+				Message:      l.Source.Message,
+				Microservice: l.Source.Microservice,
+			}
+		}
+	}
+	slices.Sort(ids)
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+	}
+	r.Dataset = hex.EncodeToString(h.Sum(nil)[:8])
+	return r
+}
+
+// trackFingerprints records the fingerprint counts of the logs in the
+// history at historyPath, replacing the latest run if it was of the same
+// dataset and keeping at most the configured number of runs along with the
+// fingerprints seen in them, and writes how each fingerprint changed since
+// the previous run to trendsPath.
+func (c *KibanaClient) trackFingerprints(logs KibanaErrorLogs, historyPath, trendsPath string) error {
+	history, err := readHistory(historyPath)
+	if err != nil {
+		return err
+	}
+	current := run(logs, history)
+	if last := len(history.Runs) - 1; last >= 0 && history.Runs[last].Dataset == current.Dataset {
+		history.Runs = history.Runs[:last]
+	}
+	trends := compareRuns(history, current, c.config.TrendThreshold)
+	history.Runs = append(history.Runs, current)
+	if limit := c.config.HistoryRuns; limit > 0 && len(history.Runs) > limit {
+		history.Runs = history.Runs[len(history.Runs)-limit:]
+		pruneFingerprints(history)
+	}
+	log.Printf("tracked %d fingerprints over %d runs: %d new, %d regressed, %d growing, %d shrinking, %d resolved...",
+		len(current.Counts), len(history.Runs), trends.Summary[TrendNew], trends.Summary[TrendRegressed],
+		trends.Summary[TrendGrowing], trends.Summary[TrendShrinking], trends.Summary[TrendResolved])
+	if err := output(history, historyPath); err != nil {
+		return fmt.Errorf("failed to write fingerprint history: %s", err)
+	}
+	if err := output(trends, trendsPath); err != nil {
+		return fmt.Errorf("failed to write trends: %s", err)
+	}
+	return nil
+}
+
+// pruneFingerprints forgets the fingerprints which no kept run has, those
+// resolved longer ago than the history reaches back.
+func pruneFingerprints(history *KibanaFingerprintHistory) {
+	kept := map[string]bool{}
+	for _, r := range history.Runs {
+		for f := range r.Counts {
+			kept[f] = true
+		}
+	}
+	for f := range history.Fingerprints {
+		if !kept[f] {
+			delete(history.Fingerprints, f)
+		}
+	}
+}
+
+// compareRuns classifies every fingerprint of the current and previous
+// runs. A fingerprint absent from the previous run is new if no earlier run
+// had it and regressed otherwise; one present in both is growing or
+// shrinking when its count changed by at least threshold, relative to the
+// previous count.
+func compareRuns(history *KibanaFingerprintHistory, current KibanaFingerprintRun, threshold float64) *KibanaTrends {
+	trends := &KibanaTrends{
+		Dataset: current.Dataset,
+		Summary: map[string]int{},
+		Trends:  []KibanaTrend{},
+	}
+	previous := KibanaFingerprintRun{Counts: map[string]int{}}
+	if len(history.Runs) > 0 {
+		previous = history.Runs[len(history.Runs)-1]
+		trends.Previous = previous.Dataset
+	}
+	lastSeen := map[string]string{}
+	for _, r := range history.Runs {
+		for f := range r.Counts {
+			lastSeen[f] = r.To
+		}
+	}
+
+	fingerprints := map[string]bool{}
+	for f := range current.Counts {
+		fingerprints[f] = true
+	}
+	for f := range previous.Counts {
+		fingerprints[f] = true
+	}
+	for f := range fingerprints {
+		t := KibanaTrend{
+			Fingerprint:       f,
+			KibanaFingerprint: history.Fingerprints[f],
+			Count:             current.Counts[f],
+			PreviousCount:     previous.Counts[f],
+		}
+		switch {
+		case t.PreviousCount == 0 && lastSeen[f] == "":
+			t.Status = TrendNew
+		case t.PreviousCount == 0:
+			t.Status = TrendRegressed
+			t.LastSeen = lastSeen[f]
+		case t.Count == 0:
+			t.Status = TrendResolved
+			t.Change = -1
+		default:
+			t.Change = float64(t.Count-t.PreviousCount) / float64(t.PreviousCount)
+			switch {
+			case t.Change >= threshold:
+				t.Status = TrendGrowing
+			case t.Change <= -threshold:
+				t.Status = TrendShrinking
+			default:
+				t.Status = TrendStable
+			}
+		}
+		trends.Summary[t.Status]++
+		trends.Trends = append(trends.Trends, t)
+	}
+	sort.Slice(trends.Trends, func(a, b int) bool {
+		ta, tb := trends.Trends[a], trends.Trends[b]
+		if ta.Status != tb.Status {
+			return slices.Index(trendOrder, ta.Status) < slices.Index(trendOrder, tb.Status)
+		}
+		if ta.Count+ta.PreviousCount != tb.Count+tb.PreviousCount {
+			return ta.Count+ta.PreviousCount > tb.Count+tb.PreviousCount
+		}
+		return ta.Fingerprint < tb.Fingerprint
+	})
+	return trends
+}
@@ -0,0 +1,124 @@
+package kibana
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := errorLog("a", "orders", "failed", "timeout reading order 17", 0)
+	tests := []struct {
+		name string
+		log  *KibanaErrorLog
+		same bool
+	}{
+		{"other identifiers", errorLog("b", "orders", "failed", "timeout reading order 18", 60), true},
+		{"other template", errorLog("c", "orders", "failed", "timeout writing order 17", 0), false},
+		{"other microservice", errorLog("d", "billing", "failed", "timeout reading order 17", 0), false},
+		{"other message", errorLog("e", "orders", "rejected", "timeout reading order 17", 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := Fingerprint(a) == Fingerprint(tt.log); same != tt.same {
+				t.Errorf("got same fingerprint %t, want %t", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestRunTimes(t *testing.T) {
+	logs := KibanaErrorLogs{
+		errorLog("a", "orders", "failed", "timeout", 0),
+		errorLog("b", "orders", "failed", "timeout", 0),
+		errorLog("c", "orders", "failed", "timeout", 0),
+		errorLog("d", "orders", "failed", "timeout", 0),
+	}
+	// Ordered as strings these are the other way round.
+	logs[0].Source.TimeStamp = "2026-01-01T09:30:00Z"
+	logs[1].Source.TimeStamp = "2026-01-01T10:00:00+02:00"
+	logs[2].Source.TimeStamp = "2026-01-01T09:00:00-01:00"
+	logs[3].Source.TimeStamp = "not a time"
+	fingerprint(logs)
+	r := run(logs, &KibanaFingerprintHistory{Fingerprints: map[string]KibanaFingerprint{}})
+	if r.From != logs[1].Source.TimeStamp || r.To != logs[2].Source.TimeStamp {
+		t.Errorf("got from %s to %s, want from %s to %s", r.From, r.To, logs[1].Source.TimeStamp, logs[2].Source.TimeStamp)
+	}
+	if r.Logs != 4 || len(r.Counts) != 1 {
+		t.Errorf("got %d logs with %d fingerprints, want 4 with 1", r.Logs, len(r.Counts))
+	}
+}
+
+func TestTrackFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	historyPath, trendsPath := filepath.Join(dir, "history.json"), filepath.Join(dir, "trends.json")
+	c := testClient(t, func(cfg *config.Config) {
+		cfg.HistoryRuns = 2
+		cfg.TrendThreshold = 0.5
+	})
+	timeout := func(id string) *KibanaErrorLog {
+		return errorLog(id, "orders", "failed", "timeout reading order 17", 0)
+	}
+	refused := func(id string) *KibanaErrorLog { return errorLog(id, "auth", "failed", "connection refused", 0) }
+	missing := func(id string) *KibanaErrorLog { return errorLog(id, "billing", "failed", "invoice not found", 0) }
+	runs := []struct {
+		logs   KibanaErrorLogs
+		status map[string]string
+		kept   int
+	}{
+		{KibanaErrorLogs{timeout("1"), refused("2")}, map[string]string{"1": TrendNew, "2": TrendNew}, 2},
+		{KibanaErrorLogs{timeout("3"), timeout("4"), missing("5")}, map[string]string{"3": TrendGrowing, "5": TrendNew, "2": TrendResolved}, 3},
+		// The same logs again replace the latest run rather than adding one.
+		{KibanaErrorLogs{timeout("3"), timeout("4"), missing("5")}, map[string]string{"3": TrendGrowing, "5": TrendNew, "2": TrendResolved}, 3},
+		{KibanaErrorLogs{timeout("6"), refused("7")}, map[string]string{"6": TrendShrinking, "7": TrendRegressed, "5": TrendResolved}, 3},
+		{KibanaErrorLogs{timeout("8"), refused("9"), missing("10")}, map[string]string{"8": TrendStable, "9": TrendStable, "10": TrendRegressed}, 3},
+		{KibanaErrorLogs{timeout("11")}, map[string]string{"11": TrendStable, "9": TrendResolved, "10": TrendResolved}, 3},
+		// Only the last two runs are kept, so the fingerprints resolved in
+		// the previous run are forgotten and are new when they come back.
+		{KibanaErrorLogs{timeout("12"), timeout("13")}, map[string]string{"12": TrendGrowing}, 1},
+		{KibanaErrorLogs{missing("14")}, map[string]string{"14": TrendNew, "12": TrendResolved}, 2},
+	}
+	byID := map[string]*KibanaErrorLog{}
+	for r, tt := range runs {
+		fingerprint(tt.logs)
+		for _, l := range tt.logs {
+			byID[l.ID] = l
+		}
+		if err := c.trackFingerprints(tt.logs, historyPath, trendsPath); err != nil {
+			t.Fatal(err)
+		}
+		history, err := readHistory(historyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Fingerprints) != tt.kept {
+			t.Errorf("run %d: got %d fingerprints in the history, want %d", r, len(history.Fingerprints), tt.kept)
+		}
+		if len(history.Runs) > c.config.HistoryRuns {
+			t.Errorf("run %d: got %d runs in the history, want at most %d", r, len(history.Runs), c.config.HistoryRuns)
+		}
+		file, err := os.ReadFile(trendsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trends KibanaTrends
+		if err := json.Unmarshal(file, &trends); err != nil {
+			t.Fatal(err)
+		}
+		statuses := map[string]string{}
+		for _, trend := range trends.Trends {
+			statuses[trend.Fingerprint] = trend.Status
+		}
+		if len(statuses) != len(tt.status) {
+			t.Errorf("run %d: got %d trends, want %d", r, len(statuses), len(tt.status))
+		}
+		for id, want := range tt.status {
+			if got := statuses[byID[id].Fingerprint]; got != want {
+				t.Errorf("run %d: log %s got status %q, want %q", r, id, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/timeseries"
+)
+
+const (
+	IncidentSplitNone         = ""
+	IncidentSplitCluster      = "cluster"
+	IncidentSplitMicroservice = "microservice"
+)
+
+// alertWindow is how far a watcher fire may be from an incident to have
+// fired during it, matching the window watcher fires are linked to logs in.
+const alertWindow = 10 * time.Minute
+
+type KibanaIncidentAlert struct {
+	ID      string `json:"id"`
+	WatchID string `json:"watchId"`
+	Time    string `json:"time"`
+	// Mapped is whether the watch covers one of the incident's message
+	// codes in WatcherErrorMapping.
+	Mapped bool `json:"mapped"`
+}
+
+// KibanaIncident is a burst of errors with no gap longer than the
+// configured one, lasting Duration seconds. PeakRate is the most logs in
+// any one minute, and Representative the errorMessage of its most common
+// fingerprint.
+type KibanaIncident struct {
+	ID               int                   `json:"id"`
+	Key              string                `json:"key,omitempty"`
+	Start            string                `json:"start"`
+	End              string                `json:"end"`
+	Duration         float64               `json:"duration"`
+	Size             int                   `json:"size"`
+	PeakRate         int                   `json:"peakRate"`
+	Microservices    map[string]int        `json:"microservices"`
+	Messages         map[string]int        `json:"messages"`
+	Clusters         map[string]int        `json:"clusters"`
+	Representative   string                `json:"representative"`
+	RepresentativeID string                `json:"representativeId"`
+	Alerts           []KibanaIncidentAlert `json:"alerts"`
+	IDs              []string              `json:"ids"`
+}
+
+// KibanaIncidents lists the incidents oldest first. When Split is set,
+// logs are first divided by cluster or microservice and each incident
+// belongs to one of them, named by its Key. Skipped counts the logs left
+// out because their timestamp does not parse.
+type KibanaIncidents struct {
+	Gap       string           `json:"gap"`
+	Split     string           `json:"split,omitempty"`
+	MinLogs   int              `json:"minLogs"`
+	Alerts    bool             `json:"alerts"`
+	Skipped   int              `json:"skipped"`
+	Incidents []KibanaIncident `json:"incidents"`
+}
+
+// timedLog is a log with its parsed timestamp.
+type timedLog struct {
+	log  *KibanaErrorLog
+	time time.Time
+}
+
+// byTime parses the timestamp of every log and sorts them oldest first,
+// leaving out logs whose timestamp does not parse and counting them.
+func byTime(logs KibanaErrorLogs) ([]timedLog, int) {
+	timed := make([]timedLog, 0, len(logs))
+	for _, l := range logs {
+		t, err := time.Parse(time.RFC3339, l.Source.TimeStamp)
+		if err != nil {
+			continue
+		}
+		timed = append(timed, timedLog{l, t.UTC()})
+	}
+	sort.SliceStable(timed, func(a, b int) bool {
+		return timed[a].time.Before(timed[b].time)
+	})
+	return timed, len(logs) - len(timed)
+}
+
+// logSkipped reports how many logs a report left out for their timestamps.
+func logSkipped(skipped int, report string) {
+	if skipped > 0 {
+		log.Printf("skipping %d logs with unreadable timestamps in the %s...", skipped, report)
+	}
+}
+
+func times(timed []timedLog) []time.Time {
+	out := make([]time.Time, len(timed))
+	for i, t := range timed {
+		out[i] = t.time
+	}
+	return out
+}
+
+// incidents splits the logs into bursts separated by more than the
+// configured gap, within each cluster or microservice when split is set,
+// and joins each with the watcher fires during it. Watcher executions may
+// be nil, leaving the incidents without alerts.
+func (c *KibanaClient) incidents(logs KibanaErrorLogs, executions *KibanaWatcherLogs) (*KibanaIncidents, error) {
+	gap, err := time.ParseDuration(c.config.IncidentGap)
+	if err != nil || gap <= 0 {
+		return nil, fmt.Errorf("invalid incident gap '%s'", c.config.IncidentGap)
+	}
+	split := c.config.IncidentSplit
+	var key func(l *KibanaErrorLog) string
+	switch split {
+	case IncidentSplitNone:
+		key = func(l *KibanaErrorLog) string { return "" }
+	case IncidentSplitCluster:
+		key = clusterKey
+	case IncidentSplitMicroservice:
+		key = func(l *KibanaErrorLog) string { return l.Source.Microservice }
+	default:
+		return nil, fmt.Errorf("unknown incident split '%s', expected cluster, microservice or none", split)
+	}
+
+	timed, skipped := byTime(logs)
+	logSkipped(skipped, "incidents")
+	groups := map[string][]timedLog{}
+	for _, t := range timed {
+		k := key(t.log)
+		groups[k] = append(groups[k], t)
+	}
+	alerts, err := watcherFires(executions)
+	if err != nil {
+		return nil, err
+	}
+	result := &KibanaIncidents{
+		Gap:       gap.String(),
+		Split:     split,
+		MinLogs:   c.config.IncidentMinLogs,
+		Alerts:    executions != nil,
+		Skipped:   skipped,
+		Incidents: []KibanaIncident{},
+	}
+	log.Printf("segmenting %d logs into incidents with gaps of %s...", len(logs), result.Gap)
+	for k, group := range groups {
+		for _, b := range timeseries.Bursts(times(group), gap, c.config.IncidentMinLogs) {
+			result.Incidents = append(result.Incidents, describeIncident(k, group[b[0]:b[1]], alerts))
+		}
+	}
+	sort.SliceStable(result.Incidents, func(a, b int) bool {
+		ia, ib := result.Incidents[a], result.Incidents[b]
+		if ia.Start != ib.Start {
+			return ia.Start < ib.Start
+		}
+		return ia.Key < ib.Key
+	})
+	for i := range result.Incidents {
+		result.Incidents[i].ID = i
+	}
+	log.Printf("found %d incidents...", len(result.Incidents))
+	return result, nil
+}
+
+// watcherFire is a watcher execution with its parsed time.
+type watcherFire struct {
+	execution *KibanaWatcherLog
+	time      time.Time
+}
+
+// watcherFires parses and sorts the watcher executions oldest first.
+func watcherFires(executions *KibanaWatcherLogs) ([]watcherFire, error) {
+	if executions == nil {
+		return nil, nil
+	}
+	fires := make([]watcherFire, 0, len(*executions))
+	for _, e := range *executions {
+		t, err := time.Parse(time.RFC3339, e.Source.Result.ExecutionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time of watcher execution %s: %s", e.ID, err)
+		}
+		fires = append(fires, watcherFire{e, t.UTC()})
+	}
+	sort.SliceStable(fires, func(a, b int) bool {
+		return fires[a].time.Before(fires[b].time)
+	})
+	return fires, nil
+}
+
+// representative is the first log of the most common fingerprint.
+func representative(burst []timedLog) *KibanaErrorLog {
+	fingerprints := map[string]int{}
+	for _, t := range burst {
+		fingerprints[t.log.Fingerprint]++
+	}
+	var r *KibanaErrorLog
+	best := 0
+	for _, t := range burst {
+		if n := fingerprints[t.log.Fingerprint]; n > best {
+			best = n
+			r = t.log
+		}
+	}
+	return r
+}
+
+func describeIncident(key string, burst []timedLog, fires []watcherFire) KibanaIncident {
+	start, end := burst[0].time, burst[len(burst)-1].time
+	incident := KibanaIncident{
+		Key:           key,
+		Start:         start.Format(time.RFC3339),
+		End:           end.Format(time.RFC3339),
+		Duration:      end.Sub(start).Seconds(),
+		Size:          len(burst),
+		PeakRate:      timeseries.PeakRate(times(burst), time.Minute),
+		Microservices: map[string]int{},
+		Messages:      map[string]int{},
+		Clusters:      map[string]int{},
+		Alerts:        []KibanaIncidentAlert{},
+		IDs:           make([]string, len(burst)),
+	}
+	for i, t := range burst {
+		incident.IDs[i] = t.log.ID
+		incident.Microservices[t.log.Source.Microservice]++
+		incident.Messages[t.log.Source.Message]++
+		incident.Clusters[clusterKey(t.log)]++
+	}
+	r := representative(burst)
+	incident.Representative = r.Source.ErrorMessage
+	incident.RepresentativeID = r.ID
+
+	from := sort.Search(len(fires), func(i int) bool {
+		return !fires[i].time.Before(start.Add(-alertWindow))
+	})
+	for _, f := range fires[from:] {
+		if f.time.After(end.Add(alertWindow)) {
+			break
+		}
+		watch := f.execution.Source.WatchId
+		mapped := false
+		for _, code := range WatcherErrorMapping[watch] {
+			mapped = mapped || incident.Messages[code] > 0
+		}
+		incident.Alerts = append(incident.Alerts, KibanaIncidentAlert{
+			ID:      f.execution.ID,
+			WatchID: watch,
+			Time:    f.time.Format(time.RFC3339),
+			Mapped:  mapped,
+		})
+	}
+	sort.SliceStable(incident.Alerts, func(a, b int) bool {
+		return incident.Alerts[a].Mapped && !incident.Alerts[b].Mapped
+	})
+	return incident
+}
+
+// optionalWatcherExecutions is the watcher executions of the alerts
+// analysis, or nil when there are none or they do not overlap the logs, so
+// errors can be analysed without them rather than joined with another
+// month's fires.
+func optionalWatcherExecutions(logs KibanaErrorLogs) *KibanaWatcherLogs {
+	executions, err := readWatcherExecutions(AlertsExecutionsOutputPath)
+	if err != nil {
+		log.Printf("continuing without watcher executions: %s", err)
+		return nil
+	}
+	timed, _ := byTime(logs)
+	if len(timed) == 0 {
+		return nil
+	}
+	fires, err := watcherFires(executions)
+	if err != nil {
+		log.Printf("continuing without watcher executions: %s", err)
+		return nil
+	}
+	from, to := timed[0].time.Add(-alertWindow), timed[len(timed)-1].time.Add(alertWindow)
+	if len(fires) == 0 || fires[0].time.After(to) || fires[len(fires)-1].time.Before(from) {
+		log.Printf("continuing without watcher executions, which do not overlap the logs from %s to %s",
+			timed[0].time.Format(time.RFC3339), timed[len(timed)-1].time.Format(time.RFC3339))
+		return nil
+	}
+	return executions
+}
+
+// FindIncidents segments the analysed errors into incidents.
+func (c *KibanaClient) FindIncidents() (*KibanaIncidents, error) {
+	logs, err := c.GetErrors()
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := c.incidents(*logs, optionalWatcherExecutions(*logs))
+	if err != nil {
+		return nil, err
+	}
+	if err := output(incidents, ErrorsIncidentsOutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write incidents: %s", err)
+	}
+	return incidents, nil
+}
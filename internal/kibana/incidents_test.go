@@ -0,0 +1,25 @@
+package kibana
+
+import "testing"
+
+func TestByTime(t *testing.T) {
+	bad := errorLog("c", "inbound", "FailedSigning", "failed", 0)
+	bad.Source.TimeStamp = "yesterday"
+	logs := KibanaErrorLogs{
+		errorLog("a", "inbound", "FailedSigning", "failed", 60),
+		bad,
+		errorLog("b", "inbound", "FailedSigning", "failed", 0),
+	}
+	timed, skipped := byTime(logs)
+	if skipped != 1 || len(timed) != 2 || timed[0].log.ID != "b" || timed[1].log.ID != "a" {
+		t.Errorf("got %d skipped and %+v, want 1 skipped and b before a", skipped, timed)
+	}
+
+	incidents, err := testClient(t, nil).incidents(logs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incidents.Skipped != 1 {
+		t.Errorf("got %d skipped, want 1", incidents.Skipped)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
 	"github.com/atoscerebro/bms-analysis/internal/config"
 	"github.com/atoscerebro/bms-analysis/internal/similarity"
 )
@@ -19,6 +20,24 @@ type KibanaLogCoordinates struct {
 	Error similarity.Coordinate `json:"error"`
 }
 
+type KibanaLogCluster struct {
+	ID      int  `json:"id"`
+	Outlier bool `json:"outlier"`
+}
+
+type KibanaAnalysis struct {
+	Metric     string                `json:"metric"`
+	Weights    map[string]float64    `json:"weights,omitempty"`
+	Projection similarity.Projection `json:"projection"`
+	Clustering cluster.Clustering    `json:"clustering"`
+	Clusters   []KibanaCluster       `json:"clusters"`
+	Logs       KibanaErrorLogs       `json:"logs"`
+
+	dendrogram *KibanaDendrogram
+	model      *similarity.Model
+	duplicates *KibanaNearDuplicates
+}
+
 type KibanaLog struct {
 	ID          string                 `json:"_id"`
 	Source      map[string]interface{} `json:"_source"`
@@ -41,6 +60,8 @@ type KibanaClient struct {
 	URL      string
 	Username string
 	Password string
+	config   *config.Config
+	cache    *similarity.DistanceCache
 }
 
 func NewKibanaClient(cfg *config.Config) *KibanaClient {
@@ -48,7 +69,250 @@ func NewKibanaClient(cfg *config.Config) *KibanaClient {
 		URL:      cfg.KibanaURL,
 		Username: cfg.LDAPUsername,
 		Password: cfg.LDAPPassword,
+		config:   cfg,
+	}
+}
+
+func (c *KibanaClient) similarityOptions() (similarity.Options, error) {
+	return c.analysisOptions(c.config.SimilarityMetric, c.config.SimilarityWeights)
+}
+
+// analysisOptions configures similarity with the given metric and weights,
+// such as those a saved analysis was run with, rather than the configured
+// ones.
+func (c *KibanaClient) analysisOptions(metric string, weights map[string]float64) (similarity.Options, error) {
+	m, err := similarity.NewMetric(metric)
+	if err != nil {
+		return similarity.Options{}, err
+	}
+	opts := similarity.Options{
+		Metric:         m,
+		Weights:        weights,
+		Landmarks:      c.config.MDSLandmarks,
+		ClassicalLimit: c.config.MDSClassicalLimit,
+		Jitter:         c.config.CoordinateJitter,
+		Seed:           c.config.Seed,
+		Dims:           c.config.Dimensions,
+		Projection:     c.config.Projection,
+		Perplexity:     c.config.TSNEPerplexity,
+		Iterations:     c.config.TSNEIterations,
+		Neighbours:     c.config.UMAPNeighbours,
+		MinDist:        c.config.UMAPMinDist,
+		Epochs:         c.config.UMAPEpochs,
+
+		DiagnosticNeighbours: c.config.DiagnosticNeighbours,
+		DiagnosticSample:     c.config.DiagnosticSample,
+	}
+	if c.config.MinHash {
+		opts.LSH = &similarity.LSHOptions{
+			Hashes:  c.config.MinHashes,
+			Bands:   c.config.MinHashBands,
+			Shingle: c.config.ShingleSize,
+			Seed:    c.config.Seed,
+		}
+		if c.config.CollapseNearDuplicates {
+			opts.NearDuplicates = c.config.NearDuplicateThreshold
+		}
+	}
+	return opts, nil
+}
+
+// cachedMetric opens the distance cache, if one is configured, begins a run
+// and looks the metric's distances up in it. Only analyses begin runs, since
+// only they save the cache and so end them.
+func (c *KibanaClient) cachedMetric(m similarity.Metric) (similarity.Metric, error) {
+	if c.config.DistanceCachePath == "" {
+		return m, nil
+	}
+	if c.cache == nil {
+		cache, err := similarity.OpenDistanceCache(c.config.DistanceCachePath, c.config.DistanceCacheMaxEntries)
+		if err != nil {
+			return nil, err
+		}
+		c.cache = cache
+	}
+	c.cache.BeginRun()
+	return c.cache.Metric(m), nil
+}
+
+func newSpace(logs KibanaErrorLogs, opts similarity.Options) (*similarity.Space, error) {
+	comparableLogs := make([]similarity.Comparable, len(logs))
+	for i, l := range logs {
+		comparableLogs[i] = &KibanaLogErrorComparable{l}
+	}
+	space, err := similarity.NewSpace(comparableLogs, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build similarity space: %s", err)
+	}
+	return space, nil
+}
+
+// embed places the logs into the model saved at modelPath when asked to
+// reuse it and one exists, and otherwise computes a new embedding, aligns
+// it to the previous run at coordinatesPath and builds its model. It
+// returns the model either way, and whether it was reused.
+func (c *KibanaClient) embed(space *similarity.Space, logs KibanaErrorLogs, modelPath, coordinatesPath string) ([]similarity.Coordinate, *similarity.Projection, *similarity.Model, bool, error) {
+	if c.config.ReuseModel {
+		modelFile, err := os.ReadFile(modelPath)
+		if err == nil {
+			var model similarity.Model
+			if err = json.Unmarshal(modelFile, &model); err != nil {
+				return nil, nil, nil, false, fmt.Errorf("failed to unmarshal model: %s", err)
+			}
+			if model.Metric != space.Metric().Name() {
+				log.Printf("saved model uses the %s metric rather than %s...", model.Metric, space.Metric().Name())
+			}
+			log.Println("placing logs into saved model...")
+			coords, projection, err := space.Project(&model)
+			return coords, projection, &model, true, err
+		}
+		log.Println("no saved model to reuse, computing a new embedding...")
+	}
+	coords, projection, err := space.Embed()
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+	// The model is fitted to the embedding as computed, since placements
+	// are measured against raw distances, and carries the alignment over.
+	model, err := space.Model()
+	if err != nil {
+		return nil, nil, nil, false, fmt.Errorf("failed to build model: %s", err)
+	}
+	if model.Alignment, err = c.align(space, logs, coords, coordinatesPath); err != nil {
+		return nil, nil, nil, false, fmt.Errorf("failed to align coordinates: %s", err)
+	}
+	return coords, projection, model, false, nil
+}
+
+// align rotates, reflects and scales a new embedding onto a reference run,
+// the previous coordinates file unless another is configured, using the
+// logs both runs share. It returns the alignment, or nil when it skipped
+// aligning.
+func (c *KibanaClient) align(space *similarity.Space, logs KibanaErrorLogs, coords []similarity.Coordinate, previousPath string) (*similarity.Alignment, error) {
+	if !c.config.Align || len(coords) == 0 {
+		return nil, nil
+	}
+	path := c.config.AlignReference
+	if path == "" {
+		path = previousPath
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Println("no reference run to align to...")
+		return nil, nil
+	}
+	reference, err := readAnalysis(path)
+	if err != nil {
+		log.Printf("skipping alignment to unreadable reference run: %s", err)
+		return nil, nil
+	}
+	byID := map[string]similarity.Coordinate{}
+	for _, l := range reference.Logs {
+		if l != nil {
+			byID[l.ID] = l.Coordinates.Error
+		}
+	}
+	shared, references := []similarity.Coordinate{}, []similarity.Coordinate{}
+	for i, l := range logs {
+		if ref, ok := byID[l.ID]; ok && len(ref) == len(coords[i]) {
+			shared = append(shared, coords[i])
+			references = append(references, ref)
+		}
+	}
+	if len(shared) <= len(coords[0]) {
+		log.Printf("only %d logs shared with the reference run, skipping alignment...", len(shared))
+		return nil, nil
+	}
+	alignment, err := similarity.Align(shared, references)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("aligned %d shared logs with residual %.4g...", alignment.Shared, alignment.Residual)
+	space.Align(alignment, coords)
+	return alignment, nil
+}
+
+func (c *KibanaClient) analyse(logs *KibanaErrorLogs, modelPath, coordinatesPath string) (*KibanaAnalysis, error) {
+	fingerprint(*logs)
+	opts, err := c.similarityOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure similarity: %s", err)
+	}
+	if opts.Metric, err = c.cachedMetric(opts.Metric); err != nil {
+		return nil, fmt.Errorf("failed to open distance cache: %s", err)
+	}
+	// The dendrogram reuses the distances the embedding computed.
+	opts.KeepDistances = c.config.Linkage != "" && c.config.Linkage != "none"
+	space, err := newSpace(*logs, opts)
+	if err != nil {
+		return nil, err
+	}
+	coords, projection, model, reused, err := c.embed(space, *logs, modelPath, coordinatesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate coordinates: %s", err)
+	}
+	// Placed logs are measured as the saved model measured its own, which
+	// need not be how they are configured now.
+	metric, weights := opts.Metric.Name(), opts.Weights
+	if reused {
+		metric, weights = model.Metric, map[string]float64{}
+		for k, name := range model.Features {
+			weights[name] = model.Weights[k]
+		}
+		model = nil
+	}
+	for i, coord := range coords {
+		(*logs)[i].Coordinates.Error = coord
+	}
+	clustering, err := c.cluster(space, logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cluster: %s", err)
+	}
+	clusters := describeClusters(space, *logs, clustering.Clusters, func(i int) int {
+		return (*logs)[i].Cluster.ID
+	})
+	dendrogram, err := c.agglomerate(space, logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dendrogram: %s", err)
+	}
+	if err := c.saveDistanceCache(); err != nil {
+		return nil, err
+	}
+	return &KibanaAnalysis{
+		Metric:     metric,
+		Weights:    weights,
+		Projection: *projection,
+		Clustering: *clustering,
+		Clusters:   clusters,
+		Logs:       *logs,
+		dendrogram: dendrogram,
+		model:      model,
+		duplicates: c.nearDuplicates(space, *logs),
+	}, nil
+}
+
+// saveDistanceCache evicts stale distances from the cache, writes it back
+// and reports its size.
+func (c *KibanaClient) saveDistanceCache() error {
+	if c.cache == nil {
+		return nil
+	}
+	evicted := c.cache.Evict(c.config.DistanceCacheMaxAge, c.config.DistanceCacheMaxEntries)
+	log.Printf("saving distance cache, evicted %d entries...", evicted)
+	if err := c.cache.Save(); err != nil {
+		return err
+	}
+	r := c.cache.Report()
+	log.Printf("distance cache holds %d pairs in %d bytes at %s, answered %d of %d lookups this run...", r.Entries, r.Bytes, r.Path, r.Hits, r.Hits+r.Misses)
+	return nil
+}
+
+// outputModel saves a newly computed embedding model, leaving any reused
+// model untouched.
+func outputModel(analysis *KibanaAnalysis, path string) error {
+	if analysis.model == nil {
+		return nil
 	}
+	return output(analysis.model, path)
 }
 
 func output(o interface{}, path string) error {
@@ -0,0 +1,88 @@
+package kibana
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// errorLog makes an error log seen the given number of seconds after the
+// epoch.
+func errorLog(id, microservice, message, errorMessage string, seconds int) *KibanaErrorLog {
+	return &KibanaErrorLog{
+		ID: id,
+		Source: KibanaErrorLogSource{
+			Environment:  "prod",
+			HttpStatus:   500,
+			Message:      message,
+			Microservice: microservice,
+			ErrorMessage: errorMessage,
+			TimeStamp:    epoch.Add(time.Duration(seconds) * time.Second).Format(time.RFC3339),
+		},
+	}
+}
+
+// testClient is a client with the default configuration, which the given
+// function may change, and no distance cache.
+func testClient(t *testing.T, configure func(*config.Config)) *KibanaClient {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DistanceCachePath = ""
+	if configure != nil {
+		configure(cfg)
+	}
+	return NewKibanaClient(cfg)
+}
+
+// inTempDir points an output path at a file in a fresh directory for the
+// rest of the test.
+func inTempDir(t *testing.T, path *string) {
+	t.Helper()
+	old := *path
+	*path = filepath.Join(t.TempDir(), filepath.Base(old))
+	t.Cleanup(func() { *path = old })
+}
+
+func TestDistanceCacheOnlyForAnalyses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "distance-cache.bin")
+	c := testClient(t, func(cfg *config.Config) { cfg.DistanceCachePath = path })
+	if _, err := c.similarityOptions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.analysisOptions("levenshtein", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.cache != nil {
+		t.Fatal("configuring similarity opened the distance cache")
+	}
+
+	logs := KibanaErrorLogs{
+		errorLog("a", "auth", "failed", "connection refused to db-1", 0),
+		errorLog("b", "auth", "failed", "connection refused to db-2", 60),
+		errorLog("c", "orders", "failed", "timeout reading order 17", 120),
+		errorLog("d", "orders", "failed", "timeout reading order 18", 180),
+		errorLog("e", "billing", "failed", "invoice not found", 240),
+	}
+	dir := t.TempDir()
+	if _, err := c.analyse(&logs, filepath.Join(dir, "model.json"), filepath.Join(dir, "coordinates.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("analysis did not save the distance cache: %s", err)
+	}
+}
@@ -0,0 +1,170 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+)
+
+// KibanaWatchNoise measures how much one watch fires and how little each
+// fire tells. Flaps counts the executions whose condition differed from
+// the one before, and FlapRate their share of the chances to, so a watch
+// alternating between met and not met every time scores one. Linked counts
+// the fires whose watcher error log is a real log rather than a stand in,
+// and ClusterShare is the share of those in the watch's most common
+// cluster, DominantCluster, which is -1 when none of them is clustered.
+// MeanTimeBetweenFires is in seconds.
+type KibanaWatchNoise struct {
+	WatchID              string  `json:"watchId"`
+	Executions           int     `json:"executions"`
+	Fires                int     `json:"fires"`
+	FiresPerDay          float64 `json:"firesPerDay"`
+	MeanTimeBetweenFires float64 `json:"meanTimeBetweenFires"`
+	Flaps                int     `json:"flaps"`
+	FlapRate             float64 `json:"flapRate"`
+	Linked               int     `json:"linked"`
+	LinkedShare          float64 `json:"linkedShare"`
+	DominantCluster      int     `json:"dominantCluster"`
+	ClusterShare         float64 `json:"clusterShare"`
+	Noise                float64 `json:"noise"`
+}
+
+// KibanaWatcherNoise ranks the watches noisiest first by
+// FiresPerDay × (1 + FlapRate + (1 - LinkedShare) + ClusterShare), so a
+// watch which fires often counts for more the more it flaps, the fewer of
+// its fires lead to a log and the more they repeat one kind of error.
+// Without the full execution History only fires are known and no watch
+// flaps.
+type KibanaWatcherNoise struct {
+	From    string             `json:"from"`
+	To      string             `json:"to"`
+	Days    float64            `json:"days"`
+	History bool               `json:"history"`
+	Watches []KibanaWatchNoise `json:"watches"`
+}
+
+// linkedLog reports whether a watcher error log is a real log, since a
+// fire with none found stands in with its own ID as the correlation ID.
+func linkedLog(l *KibanaErrorLog) bool {
+	return l.Source.CorrelationId != l.ID
+}
+
+// watcherNoise measures every watch from the full execution history, got
+// by history, or from the fires of the alerts analysis when it cannot be
+// had, with the watcher error logs of that analysis linking fires to logs
+// and clusters.
+func watcherNoise(logs KibanaErrorLogs, history func() (*KibanaWatcherLogs, error)) (*KibanaWatcherNoise, error) {
+	executions, err := history()
+	if err == nil {
+		return measureNoise(executions, logs, true)
+	}
+	log.Printf("continuing without the execution history, so flapping is unknown: %s", err)
+	if executions, err = readWatcherExecutions(AlertsExecutionsOutputPath); err != nil {
+		return nil, err
+	}
+	return measureNoise(executions, logs, false)
+}
+
+// measureNoise measures every watch from its executions, which are the full
+// history when history is set and only the fires otherwise.
+func measureNoise(executions *KibanaWatcherLogs, logs KibanaErrorLogs, history bool) (*KibanaWatcherNoise, error) {
+	result := &KibanaWatcherNoise{History: history, Watches: []KibanaWatchNoise{}}
+	fires, err := watcherFires(executions)
+	if err != nil {
+		return nil, err
+	}
+	if len(fires) == 0 {
+		return result, nil
+	}
+	from, to := fires[0].time, fires[len(fires)-1].time
+	result.From = from.Format(time.RFC3339)
+	result.To = to.Format(time.RFC3339)
+	result.Days = math.Max(to.Sub(from).Hours()/24, 1)
+
+	byID := make(map[string]*KibanaErrorLog, len(logs))
+	for _, l := range logs {
+		byID[l.ID] = l
+	}
+	byWatch := map[string][]watcherFire{}
+	for _, f := range fires {
+		byWatch[f.execution.Source.WatchId] = append(byWatch[f.execution.Source.WatchId], f)
+	}
+	// Without the history every execution is a fire.
+	met := func(f watcherFire) bool {
+		return f.execution.Source.Result.Condition.Met || !result.History
+	}
+	log.Printf("measuring the noise of %d watches over %.1f days...", len(byWatch), result.Days)
+	for watch, executions := range byWatch {
+		w := KibanaWatchNoise{WatchID: watch, Executions: len(executions), DominantCluster: cluster.Noise}
+		var first, last time.Time
+		clusters := map[int]int{}
+		for i, e := range executions {
+			if i > 0 && met(e) != met(executions[i-1]) {
+				w.Flaps++
+			}
+			if !met(e) {
+				continue
+			}
+			if w.Fires == 0 {
+				first = e.time
+			}
+			last = e.time
+			w.Fires++
+			if l, ok := byID[e.execution.ID]; ok && linkedLog(l) {
+				w.Linked++
+				if l.Cluster.ID != cluster.Noise {
+					clusters[l.Cluster.ID]++
+				}
+			}
+		}
+		if w.Executions > 1 {
+			w.FlapRate = float64(w.Flaps) / float64(w.Executions-1)
+		}
+		if w.Fires > 1 {
+			w.MeanTimeBetweenFires = last.Sub(first).Seconds() / float64(w.Fires-1)
+		}
+		w.FiresPerDay = float64(w.Fires) / result.Days
+		w.LinkedShare = share(w.Linked, w.Fires)
+		for id, n := range clusters {
+			if n > clusters[w.DominantCluster] || (n == clusters[w.DominantCluster] && id < w.DominantCluster) {
+				w.DominantCluster = id
+			}
+		}
+		w.ClusterShare = share(clusters[w.DominantCluster], w.Linked)
+		if w.Fires > 0 {
+			w.Noise = w.FiresPerDay * (1 + w.FlapRate + (1 - w.LinkedShare) + w.ClusterShare)
+		}
+		result.Watches = append(result.Watches, w)
+	}
+	sort.Slice(result.Watches, func(a, b int) bool {
+		wa, wb := result.Watches[a], result.Watches[b]
+		if wa.Noise != wb.Noise {
+			return wa.Noise > wb.Noise
+		}
+		return wa.WatchID < wb.WatchID
+	})
+	return result, nil
+}
+
+// FindWatcherNoise ranks the watches by noise using the alerts analysis and
+// the execution history it saved.
+func (c *KibanaClient) FindWatcherNoise() (*KibanaWatcherNoise, error) {
+	logs, err := readLogs(AlertsCoordinatesOutputPath)
+	if err != nil {
+		return nil, err
+	}
+	noise, err := watcherNoise(logs, func() (*KibanaWatcherLogs, error) {
+		return readWatcherExecutions(AlertsExecutionHistoryOutputPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := output(noise, AlertsNoiseOutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write watcher noise: %s", err)
+	}
+	return noise, nil
+}
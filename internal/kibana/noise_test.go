@@ -0,0 +1,151 @@
+package kibana
+
+import (
+	"math"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+func TestMeasureNoise(t *testing.T) {
+	execution := func(id, watch string, hours int, met bool) *KibanaWatcherLog {
+		e := fire(id, watch, hours*3600)
+		e.Source.Result.Condition.Met = met
+		return e
+	}
+	executions := KibanaWatcherLogs{
+		// Flaps on every execution over the two days.
+		execution("a1", "flapping", 0, true),
+		execution("a2", "flapping", 12, false),
+		execution("a3", "flapping", 24, true),
+		execution("a4", "flapping", 36, false),
+		execution("a5", "flapping", 48, true),
+		// Fires hourly, mostly on one cluster of logs.
+		execution("b1", "steady", 1, true),
+		execution("b2", "steady", 2, true),
+		execution("b3", "steady", 3, true),
+		execution("b4", "steady", 4, true),
+		execution("c1", "quiet", 5, false),
+	}
+	watcherLog := func(id string, clusterID int, linked bool) *KibanaErrorLog {
+		l := errorLog(id, "inbound", "FailedSigning", "failed", 0)
+		l.Source.CorrelationId = "correlation-" + id
+		if !linked {
+			l.Source.CorrelationId = id
+		}
+		l.Cluster.ID = clusterID
+		return l
+	}
+	logs := KibanaErrorLogs{
+		watcherLog("b1", 2, true),
+		watcherLog("b2", 2, true),
+		watcherLog("b3", 3, true),
+		watcherLog("b4", cluster.Noise, false),
+	}
+
+	result, err := measureNoise(&executions, logs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Days != 2 || !result.History || result.From != executions[0].Source.Result.ExecutionTime || result.To != executions[4].Source.Result.ExecutionTime {
+		t.Errorf("got %g days from %s to %s", result.Days, result.From, result.To)
+	}
+	want := []KibanaWatchNoise{
+		{
+			WatchID: "flapping", Executions: 5, Fires: 3, FiresPerDay: 1.5, MeanTimeBetweenFires: 86400,
+			Flaps: 4, FlapRate: 1, DominantCluster: cluster.Noise, Noise: 1.5 * 3,
+		},
+		{
+			WatchID: "steady", Executions: 4, Fires: 4, FiresPerDay: 2, MeanTimeBetweenFires: 3600,
+			Linked: 3, LinkedShare: 0.75, DominantCluster: 2, ClusterShare: 2.0 / 3, Noise: 2 * (1 + 0.25 + 2.0/3),
+		},
+		{WatchID: "quiet", Executions: 1, DominantCluster: cluster.Noise},
+	}
+	if len(result.Watches) != len(want) {
+		t.Fatalf("got %+v, want %d watches", result.Watches, len(want))
+	}
+	for i, w := range want {
+		g := result.Watches[i]
+		if g.Noise = math.Round(g.Noise*1e9) / 1e9; g.Noise != math.Round(w.Noise*1e9)/1e9 {
+			t.Errorf("%s: got noise %g, want %g", w.WatchID, g.Noise, w.Noise)
+		}
+		g.Noise, g.ClusterShare, w.ClusterShare = w.Noise, math.Round(g.ClusterShare*1e9), math.Round(w.ClusterShare*1e9)
+		if g != w {
+			t.Errorf("watch %d: got %+v, want %+v", i, g, w)
+		}
+	}
+
+	// Without the history every execution is a fire and nothing flaps.
+	result, err = measureNoise(&executions, logs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range result.Watches {
+		if w.Fires != w.Executions || w.Flaps != 0 || result.History {
+			t.Errorf("without history: got %+v", w)
+		}
+	}
+
+	result, err = measureNoise(&KibanaWatcherLogs{}, logs, true)
+	if err != nil || len(result.Watches) != 0 {
+		t.Errorf("no executions: got %+v, %v", result, err)
+	}
+}
+
+func TestFindWatcherNoise(t *testing.T) {
+	history := KibanaWatcherLogs{
+		fire("a1", "flapping", 0),
+		fire("a2", "flapping", 3600),
+		fire("a3", "flapping", 7200),
+	}
+	history[1].Source.Result.Condition.Met = false
+	fires := KibanaWatcherLogs{history[0], history[2]}
+	tests := []struct {
+		name    string
+		history bool
+		fires   bool
+		flaps   int
+		fails   bool
+	}{
+		{"saved history", true, true, 2, false},
+		{"fires alone", false, true, 0, false},
+		{"neither", false, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []*string{&AlertsCoordinatesOutputPath, &AlertsExecutionHistoryOutputPath, &AlertsExecutionsOutputPath, &AlertsNoiseOutputPath} {
+				inTempDir(t, path)
+			}
+			if err := output(KibanaErrorLogs{}, AlertsCoordinatesOutputPath); err != nil {
+				t.Fatal(err)
+			}
+			if tt.history {
+				if err := output(history, AlertsExecutionHistoryOutputPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.fires {
+				if err := output(fires, AlertsExecutionsOutputPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Kibana cannot be reached, so the ranking must come from the
+			// saved files alone.
+			c := testClient(t, func(cfg *config.Config) { cfg.KibanaURL = "http://127.0.0.1:1/" })
+			noise, err := c.FindWatcherNoise()
+			if tt.fails {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if noise.History != tt.history || len(noise.Watches) != 1 || noise.Watches[0].Flaps != tt.flaps {
+				t.Errorf("got history %t and %+v, want history %t and %d flaps", noise.History, noise.Watches, tt.history, tt.flaps)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package kibana
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+var ErrorsNoveltyOutputPath = "errors-novelty-output.json"
+
+// KibanaNovelPattern is a group of new logs which are close to each other
+// but further than the novelty threshold from every reference log. Novelty
+// is the smallest distance from any of its logs to a reference log, and
+// Nearest the reference log that comes closest. Coordinate places its
+// medoid into the saved embedding when there is one.
+type KibanaNovelPattern struct {
+	KibanaCluster
+	Novelty        float64               `json:"novelty"`
+	NearestID      string                `json:"nearestId"`
+	NearestMessage string                `json:"nearestMessage"`
+	NearestCluster int                   `json:"nearestCluster"`
+	Coordinate     similarity.Coordinate `json:"coordinate,omitempty"`
+	IDs            []string              `json:"ids"`
+}
+
+// KibanaNovelty ranks the new error patterns of a batch of logs against a
+// reference dataset, largest first, and gives the distance from each new
+// log to its nearest reference log.
+type KibanaNovelty struct {
+	Metric    string               `json:"metric"`
+	Threshold float64              `json:"threshold"`
+	Reference int                  `json:"reference"`
+	Batch     int                  `json:"batch"`
+	Novel     int                  `json:"novel"`
+	Patterns  []KibanaNovelPattern `json:"patterns"`
+	Distances map[string]float64   `json:"distances"`
+}
+
+// readLogs loads logs from either a coordinates file or a plain list of
+// logs such as the message output.
+func readLogs(path string) (KibanaErrorLogs, error) {
+	analysis, err := readAnalysis(path)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.Logs, nil
+}
+
+// FindNovelErrors compares the logs in batchPath, or fresh logs from kibana
+// when it is empty, with the reference logs in referencePath and reports
+// the patterns never seen before.
+func (c *KibanaClient) FindNovelErrors(referencePath, batchPath string) (*KibanaNovelty, error) {
+	reference, err := readAnalysis(referencePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(reference.Logs) == 0 {
+		return nil, fmt.Errorf("no reference logs in %s to compare with", referencePath)
+	}
+	var batch KibanaErrorLogs
+	if batchPath != "" {
+		if batch, err = readLogs(batchPath); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Println("fetching logs from kibana...")
+		logs, err := c.GetErrorsForMessageKeywords(ErrorKeywords)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get logs: %s", err)
+		}
+		batch = *logs
+	}
+	novelty, err := c.novelty(reference, batch, ErrorsModelOutputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := output(novelty, ErrorsNoveltyOutputPath); err != nil {
+		return nil, fmt.Errorf("failed to write novelty: %s", err)
+	}
+	return novelty, nil
+}
+
+// novelty measures the batch with the metric and weights the reference was
+// analysed with, fitted to the reference, so that distances mean what they
+// meant in its embedding.
+func (c *KibanaClient) novelty(analysis *KibanaAnalysis, batch KibanaErrorLogs, modelPath string) (*KibanaNovelty, error) {
+	threshold := c.config.NoveltyThreshold
+	reference := analysis.Logs
+	log.Printf("comparing %d logs with %d reference logs...", len(batch), len(reference))
+	metric := analysis.Metric
+	if metric == "" {
+		metric = c.config.SimilarityMetric
+	}
+	opts, err := c.analysisOptions(metric, analysis.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure similarity: %s", err)
+	}
+	referenceSpace, err := newSpace(reference, opts)
+	if err != nil {
+		return nil, err
+	}
+	// A metric fitted to a corpus keeps the reference's fit, so that the
+	// batch is scored on the reference's vocabulary rather than its own.
+	opts.Metric = similarity.Frozen(opts.Metric)
+	batchSpace, err := newSpace(batch, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]similarity.Comparable, batchSpace.Len())
+	for u := range items {
+		items[u] = &KibanaLogErrorComparable{batch[batchSpace.Item(u)]}
+	}
+	nearest, err := referenceSpace.Nearest(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare with reference logs: %s", err)
+	}
+
+	result := &KibanaNovelty{
+		Metric:    opts.Metric.Name(),
+		Threshold: threshold,
+		Reference: len(reference),
+		Batch:     len(batch),
+		Patterns:  []KibanaNovelPattern{},
+		Distances: map[string]float64{},
+	}
+	novel := KibanaErrorLogs{}
+	novelNearest := []similarity.Similar{}
+	for i, l := range batch {
+		n := nearest[batchSpace.UniqueOf(i)]
+		if n.Distance <= threshold {
+			continue
+		}
+		novel = append(novel, l)
+		novelNearest = append(novelNearest, n)
+		result.Distances[l.ID] = n.Distance
+	}
+	result.Novel = len(novel)
+	log.Printf("found %d novel logs...", len(novel))
+	if len(novel) == 0 {
+		return result, nil
+	}
+
+	space, err := newSpace(novel, opts)
+	if err != nil {
+		return nil, err
+	}
+	labels, patterns, err := c.groupNovel(space, novel, threshold)
+	if err != nil {
+		return nil, err
+	}
+	described := describeClusters(space, novel, patterns, func(i int) int { return labels[i] })
+	result.Patterns = make([]KibanaNovelPattern, patterns)
+	for p := range result.Patterns {
+		result.Patterns[p] = KibanaNovelPattern{KibanaCluster: described[p], IDs: []string{}}
+	}
+	medoids := make([]*KibanaErrorLog, patterns)
+	for i, l := range novel {
+		p := &result.Patterns[labels[i]]
+		p.IDs = append(p.IDs, l.ID)
+		if m := medoids[labels[i]]; m == nil || (m.Source.ErrorMessage != p.Medoid && l.Source.ErrorMessage == p.Medoid) {
+			medoids[labels[i]] = l
+		}
+		n := novelNearest[i]
+		if p.NearestID == "" || n.Distance < p.Novelty {
+			nearest := reference[referenceSpace.Item(n.Unique)]
+			p.Novelty = n.Distance
+			p.NearestID = nearest.ID
+			p.NearestMessage = nearest.Source.ErrorMessage
+			p.NearestCluster = nearest.Cluster.ID
+		}
+	}
+	c.placePatterns(result.Patterns, medoids, modelPath)
+	sort.SliceStable(result.Patterns, func(a, b int) bool {
+		if result.Patterns[a].Size != result.Patterns[b].Size {
+			return result.Patterns[a].Size > result.Patterns[b].Size
+		}
+		return result.Patterns[a].Novelty > result.Patterns[b].Novelty
+	})
+	for p := range result.Patterns {
+		result.Patterns[p].ID = p
+	}
+	return result, nil
+}
+
+// groupNovel joins novel logs closer to each other than the threshold with
+// single linkage. Above the classical limit the full distance matrix is
+// too large, so logs are grouped by their normalised message instead.
+func (c *KibanaClient) groupNovel(space *similarity.Space, logs KibanaErrorLogs, threshold float64) ([]int, int, error) {
+	labels := make([]int, len(logs))
+	if space.Len() > c.config.MDSClassicalLimit {
+		log.Printf("grouping %d novel logs by normalised message...", len(logs))
+		templates := map[string]int{}
+		for i, l := range logs {
+			t := similarity.Normalise(l.Source.ErrorMessage)
+			if _, ok := templates[t]; !ok {
+				templates[t] = len(templates)
+			}
+			labels[i] = templates[t]
+		}
+		return labels, len(templates), nil
+	}
+	log.Printf("grouping %d novel logs...", len(logs))
+	weights := make([]float64, space.Len())
+	for u := range weights {
+		weights[u] = space.Weight(u)
+	}
+	d, err := cluster.Agglomerate(space.DistanceMatrix(), weights, cluster.LinkageSingle)
+	if err != nil {
+		return nil, 0, err
+	}
+	unique, count := d.CutDistance(threshold)
+	for i := range logs {
+		labels[i] = unique[space.UniqueOf(i)]
+	}
+	return labels, count, nil
+}
+
+// placePatterns places the medoid of each pattern into the saved
+// embedding, if there is one.
+func (c *KibanaClient) placePatterns(patterns []KibanaNovelPattern, medoids []*KibanaErrorLog, modelPath string) {
+	modelFile, err := os.ReadFile(modelPath)
+	if err != nil {
+		return
+	}
+	var model similarity.Model
+	if err := json.Unmarshal(modelFile, &model); err != nil {
+		log.Printf("failed to unmarshal model, leaving patterns unplaced: %s", err)
+		return
+	}
+	items := make([]similarity.Comparable, len(patterns))
+	for p, l := range medoids {
+		items[p] = &KibanaLogErrorComparable{l}
+	}
+	coords, err := model.Place(items)
+	if err != nil {
+		log.Printf("failed to place patterns into saved model: %s", err)
+		return
+	}
+	for p := range patterns {
+		patterns[p].Coordinate = coords.RawRowView(p)
+	}
+}
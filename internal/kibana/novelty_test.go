@@ -0,0 +1,109 @@
+package kibana
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+func TestNovelty(t *testing.T) {
+	reference := KibanaErrorLogs{
+		errorLog("r1", "auth", "failed", "connection refused to db-1", 0),
+		errorLog("r2", "auth", "failed", "connection refused to db-2", 60),
+		errorLog("r3", "orders", "failed", "timeout reading order 17", 120),
+	}
+	batch := KibanaErrorLogs{
+		errorLog("b1", "auth", "failed", "connection refused to db-3", 180),
+		errorLog("b2", "billing", "failed", "invoice 42 could not be rendered", 240),
+		errorLog("b3", "billing", "failed", "invoice 43 could not be rendered", 300),
+		errorLog("b4", "orders", "failed", "disk quota exceeded on volume", 360),
+	}
+	tests := []struct {
+		name     string
+		analysis *KibanaAnalysis
+		novel    []string
+		patterns int
+	}{
+		{
+			"saved metric",
+			&KibanaAnalysis{Metric: similarity.MetricLevenshtein},
+			[]string{"b2", "b3", "b4"},
+			2,
+		},
+		{
+			// The configured metric compares messages, but the reference was
+			// analysed by microservice alone.
+			"saved weights",
+			&KibanaAnalysis{Metric: similarity.MetricLevenshtein, Weights: map[string]float64{"microservice": 1}},
+			[]string{"b2", "b3"},
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, nil)
+			tt.analysis.Logs = reference
+			novelty, err := c.novelty(tt.analysis, batch, filepath.Join(t.TempDir(), "model.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if novelty.Novel != len(tt.novel) || len(novelty.Distances) != len(tt.novel) {
+				t.Fatalf("got novel distances %v, want %v", novelty.Distances, tt.novel)
+			}
+			for _, id := range tt.novel {
+				if d, ok := novelty.Distances[id]; !ok || d <= c.config.NoveltyThreshold {
+					t.Errorf("%s: got distance %g, want novel", id, d)
+				}
+			}
+			if len(novelty.Patterns) != tt.patterns {
+				t.Fatalf("got %d patterns, want %d", len(novelty.Patterns), tt.patterns)
+			}
+			// Patterns come largest first, labelled with the reference log
+			// that comes closest.
+			first := novelty.Patterns[0]
+			if first.Size != 2 || first.NearestID == "" {
+				t.Errorf("got first pattern %+v, want the two invoice logs", first)
+			}
+		})
+	}
+}
+
+func TestNoveltyKeepsReferenceFit(t *testing.T) {
+	reference := KibanaErrorLogs{
+		errorLog("r1", "auth", "failed", "connection refused to db", 0),
+		errorLog("r2", "auth", "failed", "connection reset by db", 60),
+		errorLog("r3", "orders", "failed", "timeout reading order", 120),
+	}
+	// Every batch log shares "connection", which would weigh nothing were
+	// the metric fitted to the batch instead.
+	batch := KibanaErrorLogs{
+		errorLog("b1", "auth", "failed", "connection timeout to cache", 180),
+		errorLog("b2", "auth", "failed", "connection refused to queue", 240),
+		errorLog("b3", "auth", "failed", "connection dropped by proxy", 300),
+	}
+	c := testClient(t, func(cfg *config.Config) { cfg.NoveltyThreshold = 0 })
+	analysis := &KibanaAnalysis{Metric: similarity.MetricTFIDFCosine, Logs: reference}
+	novelty, err := c.novelty(analysis, batch, filepath.Join(t.TempDir(), "model.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &similarity.TFIDFCosine{}
+	corpus := make([]string, len(reference))
+	for i, l := range reference {
+		corpus[i] = l.Source.ErrorMessage
+	}
+	m.Fit(corpus)
+	for _, b := range batch {
+		want := 1.0
+		for _, r := range reference {
+			want = min(want, m.Distance(b.Source.ErrorMessage, r.Source.ErrorMessage))
+		}
+		if got := novelty.Distances[b.ID]; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: got distance %g, want %g", b.ID, got, want)
+		}
+	}
+}
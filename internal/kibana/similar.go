@@ -0,0 +1,131 @@
+package kibana
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/similarity"
+)
+
+// KibanaSimilarError is a historical error close to a query. Logs identical
+// under the metric are reported once, by the most recent of them, with how
+// many there were and when they were first and last seen.
+type KibanaSimilarError struct {
+	ID            string         `json:"id"`
+	Score         float64        `json:"score"`
+	Distance      float64        `json:"distance"`
+	ErrorMessage  string         `json:"errorMessage"`
+	Message       string         `json:"message"`
+	Microservice  string         `json:"microservice"`
+	TimeStamp     string         `json:"timestamp"`
+	Cluster       int            `json:"cluster"`
+	Count         int            `json:"count"`
+	Microservices map[string]int `json:"microservices"`
+	FirstSeen     string         `json:"firstSeen"`
+	LastSeen      string         `json:"lastSeen"`
+}
+
+type KibanaSimilarErrors struct {
+	Metric  string               `json:"metric"`
+	Query   string               `json:"query"`
+	ID      string               `json:"id,omitempty"`
+	Matches []KibanaSimilarError `json:"matches"`
+}
+
+// similarErrors finds the k errors most similar to the query log, leaving
+// the log itself out when it is one of the given logs.
+func similarErrors(space *similarity.Space, logs KibanaErrorLogs, query *KibanaErrorLog, k int) (*KibanaSimilarErrors, error) {
+	similar, err := space.Similar(&KibanaLogErrorComparable{query}, k+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &KibanaSimilarErrors{
+		Metric:  space.Metric().Name(),
+		Query:   query.Source.ErrorMessage,
+		ID:      query.ID,
+		Matches: []KibanaSimilarError{},
+	}
+	for _, s := range similar {
+		match := KibanaSimilarError{
+			Score:         1 - s.Distance,
+			Distance:      s.Distance,
+			Microservices: map[string]int{},
+		}
+		var latest, first, last time.Time
+		for _, i := range space.Members(s.Unique) {
+			l := logs[i]
+			if query.ID != "" && l.ID == query.ID {
+				continue
+			}
+			match.Count++
+			match.Microservices[l.Source.Microservice]++
+			t, err := time.Parse(time.RFC3339, l.Source.TimeStamp)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse time of log %s: %s", l.ID, err)
+			}
+			if match.ID == "" || t.After(latest) {
+				latest = t
+				match.ID = l.ID
+				match.ErrorMessage = l.Source.ErrorMessage
+				match.Message = l.Source.Message
+				match.Microservice = l.Source.Microservice
+				match.TimeStamp = l.Source.TimeStamp
+				match.Cluster = l.Cluster.ID
+			}
+			if first.IsZero() || t.Before(first) {
+				first = t
+				match.FirstSeen = l.Source.TimeStamp
+			}
+			if t.After(last) {
+				last = t
+				match.LastSeen = l.Source.TimeStamp
+			}
+		}
+		if match.Count > 0 && len(result.Matches) < k {
+			result.Matches = append(result.Matches, match)
+		}
+	}
+	return result, nil
+}
+
+// FindSimilarErrors returns the k analysed errors most similar to a log,
+// given by its ID, or else to a pasted error message, which is compared on
+// errorMessage alone whatever the configured weights.
+func (c *KibanaClient) FindSimilarErrors(message, id string, k int) (*KibanaSimilarErrors, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("number of similar errors must be at least 1, got %d", k)
+	}
+	logs, err := c.GetErrors()
+	if err != nil {
+		return nil, err
+	}
+	query := &KibanaErrorLog{Source: KibanaErrorLogSource{ErrorMessage: message}}
+	if id != "" {
+		query = nil
+		for _, l := range *logs {
+			if l.ID == id {
+				query = l
+				break
+			}
+		}
+		if query == nil {
+			return nil, fmt.Errorf("no analysed error with id '%s'", id)
+		}
+	}
+	opts, err := c.similarityOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure similarity: %s", err)
+	}
+	if id == "" {
+		// A pasted message has no other fields, which would only ever count
+		// against it, so it is compared on its text alone.
+		opts.Weights = nil
+	}
+	space, err := newSpace(*logs, opts)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("finding %d errors most similar to '%s'...", k, query.Source.ErrorMessage)
+	return similarErrors(space, *logs, query, k)
+}
@@ -0,0 +1,52 @@
+package kibana
+
+import (
+	"testing"
+
+	"github.com/atoscerebro/bms-analysis/internal/config"
+)
+
+func TestFindSimilarErrors(t *testing.T) {
+	inTempDir(t, &ErrorsCoordinatesOutputPath)
+	logs := KibanaErrorLogs{
+		errorLog("a", "inbound", "FailedSendingToSQS", "failed to send message to queue", 0),
+		errorLog("b", "inbound", "FailedSendingToSQS", "failed to send message to queue", 60),
+		errorLog("c", "outbound", "ErrorCallingSRTP", "failed to call srtp: timeout", 120),
+		errorLog("d", "outbound", "ErrorCallingSRTP", "failed to call srtp: refused", 180),
+	}
+	if err := output(&KibanaAnalysis{Logs: logs}, ErrorsCoordinatesOutputPath); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		weights  map[string]float64
+		message  string
+		id       string
+		first    string
+		distance float64
+		count    int
+	}{
+		{"pasted message", nil, "failed to call srtp: timeout", "", "c", 0, 1},
+		{"pasted message with weights", map[string]float64{"errorMessage": 1, "microservice": 1, "timestamp": 1}, "failed to send message to queue", "", "b", 0, 2},
+		{"log", nil, "", "d", "c", 7.0 / 28, 1},
+		{"log with weights", map[string]float64{"errorMessage": 1, "microservice": 1}, "", "a", "b", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, func(cfg *config.Config) {
+				cfg.SimilarityWeights = tt.weights
+			})
+			similar, err := c.FindSimilarErrors(tt.message, tt.id, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(similar.Matches) == 0 {
+				t.Fatal("got no matches")
+			}
+			first := similar.Matches[0]
+			if first.ID != tt.first || first.Distance != tt.distance || first.Count != tt.count {
+				t.Errorf("got %s at %g standing for %d, want %s at %g standing for %d", first.ID, first.Distance, first.Count, tt.first, tt.distance, tt.count)
+			}
+		})
+	}
+}
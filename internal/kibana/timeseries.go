@@ -0,0 +1,282 @@
+package kibana
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/atoscerebro/bms-analysis/internal/cluster"
+	"github.com/atoscerebro/bms-analysis/internal/timeseries"
+)
+
+const (
+	DimensionMessage      = "message"
+	DimensionMicroservice = "microservice"
+	DimensionCluster      = "cluster"
+)
+
+// maxTimeSeriesBuckets caps the buckets a time series may span, so that a
+// short interval over a long period is rejected rather than allocated.
+const maxTimeSeriesBuckets = 20000
+
+// clusterKey names a log's cluster in a series, with noise as outliers.
+func clusterKey(l *KibanaErrorLog) string {
+	if l.Cluster.ID == cluster.Noise {
+		return "outliers"
+	}
+	return strconv.Itoa(l.Cluster.ID)
+}
+
+// dimensions are the ways logs are split into series, each naming the key
+// of a log.
+var dimensions = []struct {
+	name string
+	key  func(l *KibanaErrorLog) string
+}{
+	{DimensionMessage, func(l *KibanaErrorLog) string { return l.Source.Message }},
+	{DimensionMicroservice, func(l *KibanaErrorLog) string { return l.Source.Microservice }},
+	{DimensionCluster, clusterKey},
+}
+
+// KibanaSeries is the number of logs in each bucket for one message code,
+// microservice or cluster, with the baseline median and robust z-score each
+// count was compared with, null for buckets with too little history to be
+// scored, and the buckets which spiked.
+type KibanaSeries struct {
+	Dimension string     `json:"dimension"`
+	Key       string     `json:"key"`
+	Total     int        `json:"total"`
+	Counts    []float64  `json:"counts"`
+	Baselines []*float64 `json:"baselines"`
+	Scores    []*float64 `json:"scores"`
+	Spikes    []int      `json:"spikes"`
+}
+
+type KibanaSpike struct {
+	Dimension string  `json:"dimension"`
+	Key       string  `json:"key"`
+	Start     string  `json:"start"`
+	Count     float64 `json:"count"`
+	Baseline  float64 `json:"baseline"`
+	Score     float64 `json:"score"`
+}
+
+// KibanaTimeSeries buckets logs by time, starting each bucket at the
+// matching entry of Buckets, and lists every spike highest score first.
+// Skipped counts the logs left out because their timestamp does not parse.
+type KibanaTimeSeries struct {
+	Interval  string         `json:"interval"`
+	Baseline  string         `json:"baseline"`
+	Window    int            `json:"window"`
+	Season    string         `json:"season,omitempty"`
+	Threshold float64        `json:"threshold"`
+	Skipped   int            `json:"skipped"`
+	Buckets   []string       `json:"buckets"`
+	Series    []KibanaSeries `json:"series"`
+	Spikes    []KibanaSpike  `json:"spikes"`
+}
+
+// timeSeries counts the logs in each interval per message code,
+// microservice and cluster and looks for spikes in every series. An empty
+// interval uses the configured one.
+func (c *KibanaClient) timeSeries(logs KibanaErrorLogs, interval string) (*KibanaTimeSeries, error) {
+	if interval == "" {
+		interval = c.config.TimeSeriesInterval
+	}
+	step, err := time.ParseDuration(interval)
+	if err != nil || step <= 0 {
+		return nil, fmt.Errorf("invalid time series interval '%s'", interval)
+	}
+	opts := timeseries.Options{
+		Baseline:  timeseries.Baseline(c.config.SpikeBaseline),
+		Window:    c.config.SpikeWindow,
+		Threshold: c.config.SpikeThreshold,
+		MinCount:  c.config.SpikeMinCount,
+	}
+	ts := &KibanaTimeSeries{
+		Interval:  step.String(),
+		Baseline:  string(opts.Baseline),
+		Window:    opts.Window,
+		Threshold: opts.Threshold,
+		Buckets:   []string{},
+		Series:    []KibanaSeries{},
+		Spikes:    []KibanaSpike{},
+	}
+	if opts.Baseline == timeseries.BaselineSeasonal {
+		season, err := time.ParseDuration(c.config.SpikeSeason)
+		if err != nil || season < step {
+			return nil, fmt.Errorf("invalid spike season '%s', expected a duration of at least the interval", c.config.SpikeSeason)
+		}
+		opts.Season = int(season / step)
+		ts.Season = season.String()
+	}
+
+	times := make([]time.Time, 0, len(logs))
+	counted := make(KibanaErrorLogs, 0, len(logs))
+	var first, last time.Time
+	for _, l := range logs {
+		t, err := time.Parse(time.RFC3339, l.Source.TimeStamp)
+		if err != nil {
+			ts.Skipped++
+			continue
+		}
+		t = t.UTC()
+		times = append(times, t)
+		counted = append(counted, l)
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	if ts.Skipped > 0 {
+		log.Printf("skipping %d logs with unreadable timestamps in the time series...", ts.Skipped)
+	}
+	if len(counted) == 0 {
+		return ts, nil
+	}
+	if n := int(last.Sub(first.Truncate(step))/step) + 1; n > maxTimeSeriesBuckets {
+		return nil, fmt.Errorf("time series interval '%s' gives %d buckets, more than the limit of %d", interval, n, maxTimeSeriesBuckets)
+	}
+	buckets := timeseries.Buckets(first, last, step)
+	for _, b := range buckets {
+		ts.Buckets = append(ts.Buckets, b.Format(time.RFC3339))
+	}
+	log.Printf("counting %d logs in %d buckets of %s...", len(counted), len(buckets), ts.Interval)
+
+	for _, d := range dimensions {
+		counts := map[string][]float64{}
+		for i, l := range counted {
+			key := d.key(l)
+			if counts[key] == nil {
+				counts[key] = make([]float64, len(buckets))
+			}
+			counts[key][timeseries.Index(times[i], buckets[0], step)]++
+		}
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			na, errA := strconv.Atoi(keys[a])
+			nb, errB := strconv.Atoi(keys[b])
+			if errA == nil && errB == nil {
+				return na < nb
+			}
+			return keys[a] < keys[b]
+		})
+		for _, key := range keys {
+			s := KibanaSeries{Dimension: d.name, Key: key, Counts: counts[key]}
+			baselines, scores, spikes, err := timeseries.Detect(s.Counts, opts)
+			if err != nil {
+				return nil, err
+			}
+			s.Baselines, s.Scores, s.Spikes = scored(baselines), scored(scores), spikes
+			for b, count := range s.Counts {
+				s.Total += int(count)
+				if slices.Contains(s.Spikes, b) {
+					ts.Spikes = append(ts.Spikes, KibanaSpike{
+						Dimension: d.name,
+						Key:       key,
+						Start:     ts.Buckets[b],
+						Count:     count,
+						Baseline:  baselines[b],
+						Score:     scores[b],
+					})
+				}
+			}
+			ts.Series = append(ts.Series, s)
+		}
+	}
+	sort.SliceStable(ts.Spikes, func(a, b int) bool {
+		return ts.Spikes[a].Score > ts.Spikes[b].Score
+	})
+	log.Printf("found %d spikes in %d series...", len(ts.Spikes), len(ts.Series))
+	return ts, nil
+}
+
+// scored leaves out the NaN of buckets which were not scored.
+func scored(values []float64) []*float64 {
+	out := make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			out[i] = &values[i]
+		}
+	}
+	return out
+}
+
+func formatScored(v *float64, prec int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', prec, 64)
+}
+
+// outputTimeSeries writes the time series as JSON and as CSV with one row
+// per series and bucket.
+func outputTimeSeries(ts *KibanaTimeSeries, jsonPath, csvPath string) error {
+	if err := output(ts, jsonPath); err != nil {
+		return err
+	}
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return fmt.Errorf("failed to write output: %s", err)
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.Write([]string{"dimension", "key", "start", "count", "baseline", "score", "spike"})
+	for _, s := range ts.Series {
+		for b, start := range ts.Buckets {
+			w.Write([]string{
+				s.Dimension,
+				s.Key,
+				start,
+				strconv.FormatFloat(s.Counts[b], 'f', -1, 64),
+				formatScored(s.Baselines[b], -1),
+				formatScored(s.Scores[b], 3),
+				strconv.FormatBool(slices.Contains(s.Spikes, b)),
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write output: %s", err)
+	}
+	return nil
+}
+
+// KibanaTimeSeriesLog is the part of a log its time series is counted
+// from, which the client sends for the analysis it has loaded.
+type KibanaTimeSeriesLog struct {
+	ID           string `json:"id"`
+	TimeStamp    string `json:"timestamp"`
+	Message      string `json:"message"`
+	Microservice string `json:"microservice"`
+	Cluster      int    `json:"cluster"`
+}
+
+// ErrorTimeSeries buckets the logs of a loaded analysis by the given
+// interval, or the configured one when it is empty.
+func (c *KibanaClient) ErrorTimeSeries(logs []KibanaTimeSeriesLog, interval string) (*KibanaTimeSeries, error) {
+	errorLogs := make(KibanaErrorLogs, len(logs))
+	for i, l := range logs {
+		errorLogs[i] = &KibanaErrorLog{
+			ID: l.ID,
+			Source: KibanaErrorLogSource{
+				Message:      l.Message,
+				Microservice: l.Microservice,
+				TimeStamp:    l.TimeStamp,
+			},
+			Cluster: KibanaLogCluster{ID: l.Cluster, Outlier: l.Cluster == cluster.Noise},
+		}
+	}
+	return c.timeSeries(errorLogs, interval)
+}
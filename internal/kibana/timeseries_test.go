@@ -0,0 +1,55 @@
+package kibana
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorTimeSeries(t *testing.T) {
+	logs := []KibanaTimeSeriesLog{
+		{ID: "a", TimeStamp: epoch.Format(time.RFC3339), Message: "FailedSendingToSQS", Microservice: "inbound", Cluster: 0},
+		{ID: "b", TimeStamp: epoch.Add(90 * time.Minute).Format(time.RFC3339), Message: "FailedSendingToSQS", Microservice: "outbound", Cluster: -1},
+		{ID: "c", TimeStamp: epoch.Add(30 * 24 * time.Hour).Format(time.RFC3339), Message: "ErrorCallingSRTP", Microservice: "outbound", Cluster: 0},
+	}
+	tests := []struct {
+		name     string
+		logs     []KibanaTimeSeriesLog
+		interval string
+		buckets  int
+		series   int
+		skipped  int
+		fails    bool
+	}{
+		{"hourly", logs, "1h", 30*24 + 1, 6, 0, false},
+		{"daily", logs, "24h", 31, 6, 0, false},
+		{"unreadable timestamp", append(logs, KibanaTimeSeriesLog{ID: "d", TimeStamp: "yesterday", Message: "ErrorCallingSRTP", Cluster: 0}), "24h", 31, 6, 1, false},
+		{"no logs", nil, "1ms", 0, 0, 0, false},
+		{"too many buckets", logs, "1ms", 0, 0, 0, true},
+		{"just over the limit", logs[:2], "270ms", 0, 0, 0, true},
+		{"invalid", logs, "hourly", 0, 0, 0, true},
+		{"negative", logs, "-1h", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := testClient(t, nil).ErrorTimeSeries(tt.logs, tt.interval)
+			if tt.fails {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ts.Buckets) != tt.buckets || len(ts.Series) != tt.series || ts.Skipped != tt.skipped {
+				t.Errorf("got %d buckets, %d series and %d skipped, want %d, %d and %d",
+					len(ts.Buckets), len(ts.Series), ts.Skipped, tt.buckets, tt.series, tt.skipped)
+			}
+			for _, s := range ts.Series {
+				if s.Dimension == DimensionCluster && s.Key == "outliers" && s.Total != 1 {
+					t.Errorf("got %d outliers, want 1", s.Total)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package parallel
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Range splits [0, n) into one contiguous block per CPU and calls fn on
+// each block concurrently, returning once every call has.
+func Range(n int, fn func(lo, hi int)) {
+	workers := runtime.NumCPU()
+	size := max((n+workers-1)/workers, 1)
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += size {
+		hi := min(lo+size, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(lo, hi)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,22 @@
+package parallel
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 1000} {
+		visits := make([]atomic.Int32, n)
+		Range(n, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				visits[i].Add(1)
+			}
+		})
+		for i := range visits {
+			if v := visits[i].Load(); v != 1 {
+				t.Errorf("n=%d: index %d visited %d times, want once", n, i, v)
+			}
+		}
+	}
+}
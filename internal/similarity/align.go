@@ -0,0 +1,149 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Align finds the rotation, reflection, uniform scale and translation which
+// best map coords onto reference in the least squares sense (orthogonal
+// Procrustes analysis). Both hold the coordinates of the same items in the
+// same order.
+func Align(coords, reference []Coordinate) (*Alignment, error) {
+	m := len(coords)
+	if m != len(reference) {
+		return nil, fmt.Errorf("got %d coordinates but %d references", m, len(reference))
+	}
+	if m == 0 {
+		return nil, fmt.Errorf("no shared items to align on")
+	}
+	dims := len(coords[0])
+	if m <= dims {
+		return nil, fmt.Errorf("need more than %d shared items to align, got %d", dims, m)
+	}
+	x := mat.NewDense(m, dims, nil)
+	y := mat.NewDense(m, dims, nil)
+	for i := range coords {
+		if len(coords[i]) != dims || len(reference[i]) != dims {
+			return nil, fmt.Errorf("cannot align coordinates of different dimensions")
+		}
+		x.SetRow(i, coords[i])
+		y.SetRow(i, reference[i])
+	}
+	xMean, yMean := columnMeans(x), columnMeans(y)
+	var xNorm, yNorm float64
+	for i := 0; i < m; i++ {
+		for a := 0; a < dims; a++ {
+			x.Set(i, a, x.At(i, a)-xMean[a])
+			y.Set(i, a, y.At(i, a)-yMean[a])
+			xNorm += x.At(i, a) * x.At(i, a)
+			yNorm += y.At(i, a) * y.At(i, a)
+		}
+	}
+	if xNorm == 0 || yNorm == 0 {
+		return nil, fmt.Errorf("cannot align coordinates without spread")
+	}
+
+	var cross mat.Dense
+	cross.Mul(x.T(), y)
+	var svd mat.SVD
+	if ok := svd.Factorize(&cross, mat.SVDFull); !ok {
+		return nil, fmt.Errorf("singular value decomposition failed")
+	}
+	var u, v, r mat.Dense
+	svd.UTo(&u)
+	svd.VTo(&v)
+	r.Mul(&u, v.T())
+	var trace float64
+	for _, sigma := range svd.Values(nil) {
+		trace += sigma
+	}
+
+	a := &Alignment{
+		Rotation:    make([][]float64, dims),
+		Scale:       trace / xNorm,
+		Translation: make(Coordinate, dims),
+		Shared:      m,
+	}
+	for i := range a.Rotation {
+		a.Rotation[i] = mat.Row(nil, i, &r)
+	}
+	for c := 0; c < dims; c++ {
+		a.Translation[c] = yMean[c]
+		for k := 0; k < dims; k++ {
+			a.Translation[c] -= a.Scale * xMean[k] * a.Rotation[k][c]
+		}
+	}
+
+	// The least squares residual has a closed form: |y|² - s²|x|².
+	sq := math.Max(yNorm-a.Scale*a.Scale*xNorm, 0)
+	a.Residual = math.Sqrt(sq / float64(m))
+	a.Disparity = sq / yNorm
+	return a, nil
+}
+
+func columnMeans(d *mat.Dense) []float64 {
+	m, dims := d.Dims()
+	means := make([]float64, dims)
+	for i := 0; i < m; i++ {
+		for a := range means {
+			means[a] += d.At(i, a) / float64(m)
+		}
+	}
+	return means
+}
+
+// Apply transforms a coordinate in place.
+func (a *Alignment) Apply(c Coordinate) {
+	out := make([]float64, len(c))
+	for col := range out {
+		out[col] = a.Translation[col]
+		for k, v := range c {
+			out[col] += a.Scale * v * a.Rotation[k][col]
+		}
+	}
+	copy(c, out)
+}
+
+// Align transforms the embedding of the space, and the coordinates of its
+// items, onto a reference run. The variance each axis explains is shared
+// out again in proportion to its spread after rotation.
+func (s *Space) Align(a *Alignment, coords []Coordinate) {
+	for _, c := range coords {
+		a.Apply(c)
+	}
+	n, dims := s.embedding.Dims()
+	spread := make([]float64, dims)
+	for i := 0; i < n; i++ {
+		a.Apply(s.embedding.RawRowView(i))
+	}
+	var total, explained, weight float64
+	means := make([]float64, dims)
+	for i := 0; i < n; i++ {
+		weight += s.counts[i]
+		for c := range means {
+			means[c] += s.counts[i] * s.embedding.At(i, c)
+		}
+	}
+	for c := range means {
+		means[c] /= weight
+	}
+	for i := 0; i < n; i++ {
+		for c := 0; c < dims; c++ {
+			d := s.embedding.At(i, c) - means[c]
+			spread[c] += s.counts[i] * d * d
+			total += s.counts[i] * d * d
+		}
+	}
+	for _, v := range s.projection.VarianceExplained {
+		explained += v
+	}
+	if total > 0 {
+		for c := range s.projection.VarianceExplained {
+			s.projection.VarianceExplained[c] = explained * spread[c] / total
+		}
+	}
+	s.projection.Alignment = a
+}
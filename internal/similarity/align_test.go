@@ -0,0 +1,95 @@
+package similarity
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		name        string
+		angle       float64
+		reflect     bool
+		scale       float64
+		translation Coordinate
+	}{
+		{"identity", 0, false, 1, Coordinate{0, 0}},
+		{"rotation", math.Pi / 3, false, 1, Coordinate{0, 0}},
+		{"scale and translation", 0, false, 2.5, Coordinate{3, -7}},
+		{"all", -2, false, 0.4, Coordinate{-1, 10}},
+		{"reflection", 1, true, 1.5, Coordinate{2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sin, cos := math.Sincos(tt.angle)
+			rotation := [][]float64{{cos, sin}, {-sin, cos}}
+			if tt.reflect {
+				rotation[1][0], rotation[1][1] = -rotation[1][0], -rotation[1][1]
+			}
+			rnd := rand.New(rand.NewSource(1))
+			coords := make([]Coordinate, 20)
+			reference := make([]Coordinate, len(coords))
+			for i := range coords {
+				coords[i] = Coordinate{rnd.NormFloat64(), rnd.NormFloat64()}
+				reference[i] = make(Coordinate, 2)
+				for c := range reference[i] {
+					reference[i][c] = tt.translation[c]
+					for k, v := range coords[i] {
+						reference[i][c] += tt.scale * v * rotation[k][c]
+					}
+				}
+			}
+
+			a, err := Align(coords, reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(a.Scale-tt.scale) > 1e-9 {
+				t.Errorf("scale: got %g, want %g", a.Scale, tt.scale)
+			}
+			for k := range rotation {
+				for c := range rotation[k] {
+					if math.Abs(a.Rotation[k][c]-rotation[k][c]) > 1e-9 {
+						t.Errorf("rotation: got %v, want %v", a.Rotation, rotation)
+					}
+				}
+			}
+			for c := range tt.translation {
+				if math.Abs(a.Translation[c]-tt.translation[c]) > 1e-9 {
+					t.Errorf("translation: got %v, want %v", a.Translation, tt.translation)
+				}
+			}
+			if a.Residual > 1e-6 || a.Disparity > 1e-9 {
+				t.Errorf("got residual %g and disparity %g, want zero", a.Residual, a.Disparity)
+			}
+			for i, c := range coords {
+				a.Apply(c)
+				for k := range c {
+					if math.Abs(c[k]-reference[i][k]) > 1e-9 {
+						t.Fatalf("applied %d: got %v, want %v", i, c, reference[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAlignErrors(t *testing.T) {
+	tests := []struct {
+		name              string
+		coords, reference []Coordinate
+	}{
+		{"mismatched", []Coordinate{{0, 0}}, []Coordinate{}},
+		{"empty", []Coordinate{}, []Coordinate{}},
+		{"too few", []Coordinate{{0, 0}, {1, 1}}, []Coordinate{{0, 0}, {1, 1}}},
+		{"no spread", []Coordinate{{1, 1}, {1, 1}, {1, 1}}, []Coordinate{{0, 0}, {1, 0}, {0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Align(tt.coords, tt.reference); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package similarity
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	cacheMagic   = "bmsdist1"
+	cacheShards  = 64
+	cacheRecord  = 8 + 8 + 8 + 4
+	cacheMaxName = 1 << 16
+)
+
+type cachePair [2]uint64
+
+type cacheEntry struct {
+	distance float64
+	used     uint32
+}
+
+type cacheShard struct {
+	mu      sync.Mutex
+	entries map[cachePair]cacheEntry
+}
+
+// metricCache holds the distances computed by one metric, split into
+// shards so that parallel workers rarely wait on each other.
+type metricCache struct {
+	shards [cacheShards]cacheShard
+}
+
+func newMetricCache() *metricCache {
+	m := &metricCache{}
+	for i := range m.shards {
+		m.shards[i].entries = map[cachePair]cacheEntry{}
+	}
+	return m
+}
+
+func (m *metricCache) shard(p cachePair) *cacheShard {
+	return &m.shards[(p[0]^p[1])%cacheShards]
+}
+
+// DistanceCache remembers the distance between pairs of strings across
+// runs, keyed by metric and the hashes of both strings, so a rerun only
+// compares pairs involving strings it has not seen before. Every run is a
+// generation, begun by BeginRun and ended by Save, and each entry records
+// the last generation which used it so that entries nobody needs any more
+// can be evicted. It holds at most maxEntries distances, so that memory
+// stays bounded during a run rather than only once it is saved; pairs seen
+// after that are computed but not kept.
+type DistanceCache struct {
+	path       string
+	maxEntries int
+	entries    atomic.Int64
+	generation atomic.Uint32
+	running    bool
+	mu         sync.Mutex
+	metrics    map[string]*metricCache
+	hits       atomic.Int64
+	misses     atomic.Int64
+	evicted    int
+}
+
+// CacheReport describes the size and effectiveness of a DistanceCache.
+type CacheReport struct {
+	Path       string         `json:"path"`
+	Generation uint32         `json:"generation"`
+	Entries    int            `json:"entries"`
+	Metrics    map[string]int `json:"metrics"`
+	Bytes      int64          `json:"bytes"`
+	Hits       int64          `json:"hits"`
+	Misses     int64          `json:"misses"`
+	Evicted    int            `json:"evicted"`
+}
+
+// OpenDistanceCache loads the cache saved at path, or starts an empty one
+// when there is no file yet, keeping at most maxEntries distances. A limit
+// of zero or less is ignored.
+func OpenDistanceCache(path string, maxEntries int) (*DistanceCache, error) {
+	c := &DistanceCache{
+		path:       path,
+		maxEntries: maxEntries,
+		metrics:    map[string]*metricCache{},
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open distance cache: %s", err)
+	}
+	defer f.Close()
+	if err := c.read(bufio.NewReader(f)); err != nil {
+		return nil, fmt.Errorf("failed to read distance cache: %s", err)
+	}
+	c.entries.Store(int64(c.len()))
+	return c, nil
+}
+
+// BeginRun starts the next generation, so that entries age by runs rather
+// than by how often the cache is opened, unless a run has begun and not yet
+// been saved. It resets the counts of the run's lookups and evictions.
+func (c *DistanceCache) BeginRun() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return
+	}
+	c.running = true
+	c.generation.Add(1)
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.evicted = 0
+}
+
+func (c *DistanceCache) read(r io.Reader) error {
+	header := make([]byte, len(cacheMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[:len(cacheMagic)]) != cacheMagic {
+		return fmt.Errorf("not a distance cache")
+	}
+	c.generation.Store(binary.LittleEndian.Uint32(header[len(cacheMagic):]))
+	metrics := binary.LittleEndian.Uint32(header[len(cacheMagic)+4:])
+	record := make([]byte, cacheRecord)
+	for ; metrics > 0; metrics-- {
+		var lengths [10]byte
+		if _, err := io.ReadFull(r, lengths[:]); err != nil {
+			return err
+		}
+		name := make([]byte, binary.LittleEndian.Uint16(lengths[:]))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return err
+		}
+		m := c.metric(string(name))
+		for count := binary.LittleEndian.Uint64(lengths[2:]); count > 0; count-- {
+			if _, err := io.ReadFull(r, record); err != nil {
+				return err
+			}
+			p := cachePair{binary.LittleEndian.Uint64(record), binary.LittleEndian.Uint64(record[8:])}
+			m.shard(p).entries[p] = cacheEntry{
+				distance: math.Float64frombits(binary.LittleEndian.Uint64(record[16:])),
+				used:     binary.LittleEndian.Uint32(record[24:]),
+			}
+		}
+	}
+	return nil
+}
+
+func (c *DistanceCache) metric(name string) *metricCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.metrics[name]
+	if !ok {
+		m = newMetricCache()
+		c.metrics[name] = m
+	}
+	return m
+}
+
+// Metric wraps m so that its distances are looked up in the cache before
+// being computed. Metrics fitted to a corpus depend on the whole dataset
+// rather than the two strings alone, so they are returned unwrapped.
+func (c *DistanceCache) Metric(m Metric) Metric {
+	if _, ok := m.(CorpusMetric); ok {
+		log.Printf("the %s metric depends on the dataset, so its distances are not cached...", m.Name())
+		return m
+	}
+	return &cachedMetric{Metric: m, cache: c, entries: c.metric(m.Name())}
+}
+
+type cachedMetric struct {
+	Metric
+	cache   *DistanceCache
+	entries *metricCache
+}
+
+// hashString is the 64-bit FNV-1a hash of s, computed without copying it.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// hashedMetric is a Metric which can take the hashes of both strings
+// alongside them, so that callers comparing the same strings many times
+// need hash each only once.
+type hashedMetric interface {
+	Metric
+	distanceHashed(a, b string, ha, hb uint64) float64
+}
+
+func (m *cachedMetric) Distance(a, b string) float64 {
+	return m.distanceHashed(a, b, hashString(a), hashString(b))
+}
+
+func (m *cachedMetric) distanceHashed(a, b string, ha, hb uint64) float64 {
+	if a == b {
+		return m.Metric.Distance(a, b)
+	}
+	p := cachePair{ha, hb}
+	if p[0] > p[1] {
+		p[0], p[1] = p[1], p[0]
+	}
+	shard := m.entries.shard(p)
+	shard.mu.Lock()
+	e, ok := shard.entries[p]
+	if ok {
+		e.used = m.cache.generation.Load()
+		shard.entries[p] = e
+	}
+	shard.mu.Unlock()
+	if ok {
+		m.cache.hits.Add(1)
+		return e.distance
+	}
+
+	m.cache.misses.Add(1)
+	dist := m.Metric.Distance(a, b)
+	if !m.cache.reserve() {
+		return dist
+	}
+	shard.mu.Lock()
+	if _, ok := shard.entries[p]; ok {
+		m.cache.entries.Add(-1)
+	}
+	shard.entries[p] = cacheEntry{distance: dist, used: m.cache.generation.Load()}
+	shard.mu.Unlock()
+	return dist
+}
+
+// reserve counts one more entry unless the cache is full.
+func (c *DistanceCache) reserve() bool {
+	if n := c.entries.Add(1); c.maxEntries > 0 && n > int64(c.maxEntries) {
+		c.entries.Add(-1)
+		return false
+	}
+	return true
+}
+
+// Evict drops entries which have gone unused for maxAge runs, then the
+// least recently used entries until at most maxEntries remain. A limit of
+// zero or less is ignored.
+func (c *DistanceCache) Evict(maxAge, maxEntries int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	before := c.len()
+	if maxAge > 0 {
+		c.drop(func(e cacheEntry) bool {
+			return int64(c.generation.Load())-int64(e.used) >= int64(maxAge)
+		})
+	}
+	if total := c.len(); maxEntries > 0 && total > maxEntries {
+		// Find the generation at which the oldest entries make up the
+		// excess, dropping everything older and only enough of it.
+		byGeneration := map[uint32]int{}
+		c.each(func(e cacheEntry) { byGeneration[e.used]++ })
+		generations := make([]uint32, 0, len(byGeneration))
+		for g := range byGeneration {
+			generations = append(generations, g)
+		}
+		sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+		excess := total - maxEntries
+		var cutoff uint32
+		for _, g := range generations {
+			cutoff = g
+			if byGeneration[g] >= excess {
+				break
+			}
+			excess -= byGeneration[g]
+		}
+		c.drop(func(e cacheEntry) bool {
+			if e.used < cutoff {
+				return true
+			}
+			if e.used == cutoff && excess > 0 {
+				excess--
+				return true
+			}
+			return false
+		})
+	}
+	evicted := before - c.len()
+	c.entries.Store(int64(c.len()))
+	c.evicted += evicted
+	return evicted
+}
+
+func (c *DistanceCache) len() int {
+	total := 0
+	for _, m := range c.metrics {
+		for i := range m.shards {
+			total += len(m.shards[i].entries)
+		}
+	}
+	return total
+}
+
+func (c *DistanceCache) each(fn func(cacheEntry)) {
+	for _, m := range c.metrics {
+		for i := range m.shards {
+			for _, e := range m.shards[i].entries {
+				fn(e)
+			}
+		}
+	}
+}
+
+func (c *DistanceCache) drop(fn func(cacheEntry) bool) {
+	for _, m := range c.metrics {
+		for i := range m.shards {
+			for p, e := range m.shards[i].entries {
+				if fn(e) {
+					delete(m.shards[i].entries, p)
+				}
+			}
+		}
+	}
+}
+
+// Save writes the cache back to its path, replacing the previous file only
+// once the new one is complete, and ends the run.
+func (c *DistanceCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create distance cache: %s", err)
+	}
+	w := bufio.NewWriter(f)
+	if err := c.write(w); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write distance cache: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write distance cache: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write distance cache: %s", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace distance cache: %s", err)
+	}
+	return nil
+}
+
+func (c *DistanceCache) write(w io.Writer) error {
+	header := make([]byte, len(cacheMagic)+8)
+	copy(header, cacheMagic)
+	binary.LittleEndian.PutUint32(header[len(cacheMagic):], c.generation.Load())
+	binary.LittleEndian.PutUint32(header[len(cacheMagic)+4:], uint32(len(c.metrics)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	record := make([]byte, cacheRecord)
+	for name, m := range c.metrics {
+		if len(name) >= cacheMaxName {
+			return fmt.Errorf("metric name '%s' is too long", name)
+		}
+		var lengths [10]byte
+		binary.LittleEndian.PutUint16(lengths[:], uint16(len(name)))
+		var count uint64
+		for i := range m.shards {
+			count += uint64(len(m.shards[i].entries))
+		}
+		binary.LittleEndian.PutUint64(lengths[2:], count)
+		if _, err := w.Write(lengths[:]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, name); err != nil {
+			return err
+		}
+		for i := range m.shards {
+			for p, e := range m.shards[i].entries {
+				binary.LittleEndian.PutUint64(record, p[0])
+				binary.LittleEndian.PutUint64(record[8:], p[1])
+				binary.LittleEndian.PutUint64(record[16:], math.Float64bits(e.distance))
+				binary.LittleEndian.PutUint32(record[24:], e.used)
+				if _, err := w.Write(record); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Report describes how many entries the cache holds per metric, how large
+// its file is, and how many lookups this run it answered.
+func (c *DistanceCache) Report() CacheReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := CacheReport{
+		Path:       c.path,
+		Generation: c.generation.Load(),
+		Metrics:    map[string]int{},
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Evicted:    c.evicted,
+	}
+	for name, m := range c.metrics {
+		for i := range m.shards {
+			report.Metrics[name] += len(m.shards[i].entries)
+		}
+		report.Entries += report.Metrics[name]
+	}
+	if info, err := os.Stat(c.path); err == nil {
+		report.Bytes = info.Size()
+	}
+	return report
+}
@@ -0,0 +1,120 @@
+package similarity
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashString(t *testing.T) {
+	for _, s := range []string{"", "a", "failed to call SRTP", "ünïcödé"} {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		if got, want := hashString(s), h.Sum64(); got != want {
+			t.Errorf("%q: got %x, want %x", s, got, want)
+		}
+	}
+}
+
+func TestCachedDistanceMatrix(t *testing.T) {
+	c, err := OpenDistanceCache(filepath.Join(t.TempDir(), "cache.bin"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := generate(40)
+	want, err := DistanceMatrix(items, Options{Metric: &Levenshtein{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		c.BeginRun()
+		got, err := DistanceMatrix(items, Options{Metric: c.Metric(&Levenshtein{})})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want.data {
+			if got.data[i] != want.data[i] {
+				t.Fatalf("run %d: distance %d is %g, want %g", run, i, got.data[i], want.data[i])
+			}
+		}
+		if err := c.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if r := c.Report(); run == 1 && r.Misses != 0 {
+			t.Errorf("second run missed %d of %d lookups", r.Misses, r.Hits+r.Misses)
+		}
+	}
+}
+
+func TestDistanceCacheRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.bin")
+	c, err := OpenDistanceCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Metric(&Levenshtein{})
+
+	// Each step begins a run, looks up its pairs, then saves and evicts
+	// entries unused for two runs when asked.
+	steps := []struct {
+		name       string
+		pairs      [][2]string
+		save       bool
+		generation uint32
+		hits       int64
+		entries    int
+	}{
+		{"first run", [][2]string{{"a", "b"}, {"a", "c"}}, true, 1, 0, 2},
+		{"second run", [][2]string{{"a", "b"}}, false, 2, 1, 2},
+		{"same run", [][2]string{{"a", "b"}}, true, 2, 2, 2},
+		{"third run evicts", [][2]string{{"a", "b"}}, true, 3, 1, 1},
+		{"fourth run", [][2]string{{"a", "b"}}, true, 4, 1, 1},
+	}
+	for _, s := range steps {
+		c.BeginRun()
+		for _, p := range s.pairs {
+			m.Distance(p[0], p[1])
+		}
+		if s.save {
+			c.Evict(2, 0)
+			if err := c.Save(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := c.Report()
+		if r.Generation != s.generation || r.Hits != s.hits || r.Entries != s.entries {
+			t.Errorf("%s: got generation %d, %d hits and %d entries, want %d, %d and %d",
+				s.name, r.Generation, r.Hits, r.Entries, s.generation, s.hits, s.entries)
+		}
+	}
+
+	reopened, err := OpenDistanceCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.BeginRun()
+	if r := reopened.Report(); r.Generation != 5 || r.Entries != 1 {
+		t.Errorf("reopened: got generation %d and %d entries, want 5 and 1", r.Generation, r.Entries)
+	}
+}
+
+func TestDistanceCacheLimit(t *testing.T) {
+	c, err := OpenDistanceCache(filepath.Join(t.TempDir(), "cache.bin"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BeginRun()
+	m := c.Metric(&Levenshtein{})
+	items := generate(10)
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			a, b := items[i].Metric(), items[j].Metric()
+			if got, want := m.Distance(a, b), (&Levenshtein{}).Distance(a, b); got != want {
+				t.Fatalf("%q and %q: got %g, want %g", a, b, got, want)
+			}
+		}
+	}
+	if r := c.Report(); r.Entries != 3 || r.Misses != 45 {
+		t.Errorf("got %d entries and %d misses, want 3 and 45", r.Entries, r.Misses)
+	}
+}
@@ -6,166 +6,401 @@ import (
 	"math"
 	"runtime"
 	"sync"
+	"sync/atomic"
 
-	"github.com/agnivade/levenshtein"
-	"github.com/atoscerebro/bms-analysis/pkg/ds"
 	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
 )
 
-type Coordinate struct {
-	X float64
-	Y float64
-}
-
 type Comparable interface {
 	Metric() string
 }
 
-func computeSimilarity(c1, c2 Comparable) float64 {
-	a := c1.Metric()
-	b := c2.Metric()
+const (
+	DefaultDims           = 2
+	DefaultLandmarks      = 300
+	DefaultClassicalLimit = 20000
+)
 
-	if a == b {
-		return 1.0
-	}
+type Options struct {
+	Metric  Metric
+	Weights Weights
+	// Landmarks is the number of landmarks used once the input is larger
+	// than ClassicalLimit, at which point classical MDS becomes too slow.
+	Landmarks      int
+	ClassicalLimit int
+	// Jitter scatters logs with identical metrics around their shared
+	// coordinate, as a fraction of the spread of the embedding.
+	Jitter float64
+	Seed   int64
+	// Dims is the number of axes to embed into, usually 2 or 3.
+	Dims int
+	// Projection is one of Projections. Perplexity and Iterations only
+	// apply to tsne, and Neighbours, MinDist and Epochs to umap.
+	Projection string
+	Perplexity float64
+	Iterations int
+	Neighbours int
+	MinDist    float64
+	Epochs     int
+	// DiagnosticNeighbours is the neighbourhood size trustworthiness and
+	// continuity are measured at, over DiagnosticSample unique items.
+	DiagnosticNeighbours int
+	DiagnosticSample     int
+	// KeepDistances keeps the distance matrix Embed computes, when the
+	// projection computes one, for DistanceMatrix to hand over.
+	KeepDistances bool
+	// LSH indexes items by MinHash signature, which lets t-SNE and UMAP
+	// start their neighbour search from items sharing a bucket, and with
+	// NearDuplicates above zero, collapses items whose estimated Jaccard
+	// similarity reaches it into one.
+	LSH            *LSHOptions
+	NearDuplicates float64
+}
 
-	maxLen := math.Max(float64(len(a)), float64(len(b)))
-	if maxLen == 0 {
-		return 1.0
-	}
+// distanceTileSize is the edge of the square blocks the upper triangle is
+// split into, small enough to balance well and large enough to keep each
+// worker on a cache-friendly run of items.
+const distanceTileSize = 64
+
+type tile struct {
+	rowLo, rowHi int
+	colLo, colHi int
+}
 
-	dist := float64(levenshtein.ComputeDistance(a, b))
-	return 1.0 - dist/maxLen
+func distanceTiles(n int) []tile {
+	tiles := []tile{}
+	for r := 0; r < n; r += distanceTileSize {
+		for c := r; c < n; c += distanceTileSize {
+			tiles = append(tiles, tile{
+				rowLo: r,
+				rowHi: min(r+distanceTileSize, n),
+				colLo: c,
+				colHi: min(c+distanceTileSize, n),
+			})
+		}
+	}
+	return tiles
 }
 
-func computeDistanceMatrix(c []Comparable) *mat.Dense {
-	n := len(c)
-	numCPU := runtime.NumCPU()
-	chunkSize := (len(c) + numCPU - 1) / numCPU
-	chunks := ds.SliceChunk(c, chunkSize)
-	computed := map[string]bool{}
-	totalComputed := 0
-	dist := mat.NewDense(n, n, nil)
-	mu := sync.Mutex{}
+// computeDistanceMatrix fills the upper triangle only. Workers claim tiles
+// through an atomic cursor and every tile owns a disjoint set of cells, so
+// nothing in the hot loop is shared or locked.
+func computeDistanceMatrix(n int, d *distancer) *SymMatrix {
+	dist := NewSymMatrix(n)
+	tiles := distanceTiles(n)
+	total := int64(n) * int64(n-1) / 2
+	step := max(total/10, 1)
+	var cursor, computed atomic.Int64
 
 	var wg sync.WaitGroup
-	for i := 0; i < len(chunks); i++ {
+	for w := 0; w < runtime.NumCPU(); w++ {
 		wg.Add(1)
-		go func(chunkI int) {
+		go func() {
 			defer wg.Done()
-			currChunk := chunks[chunkI]
-			baseI := chunkI * chunkSize
-			for j := 0; j < len(currChunk); j++ {
-				groupI := baseI + j
-				for k := 0; k < n; k++ {
-					key := fmt.Sprintf("%d-%d", groupI, k)
-					mu.Lock()
-					_, ok := computed[key]
-					mu.Unlock()
-					if ok {
-						continue
-					}
-					sim := computeSimilarity(c[groupI], c[k])
-					mu.Lock()
-					dist.Set(groupI, k, 1.0-sim)
-					dist.Set(k, groupI, 1.0-sim)
-					computedKeys := []string{key, fmt.Sprintf("%d-%d", k, groupI)}
-					for _, k := range computedKeys {
-						computed[k] = true
+			for {
+				t := int(cursor.Add(1) - 1)
+				if t >= len(tiles) {
+					return
+				}
+				tl := tiles[t]
+				pairs := int64(0)
+				for i := tl.rowLo; i < tl.rowHi; i++ {
+					for j := max(tl.colLo, i+1); j < tl.colHi; j++ {
+						dist.Set(i, j, d.distance(i, j))
+						pairs++
 					}
-					mu.Unlock()
 				}
-				totalComputed++
-				if totalComputed%(n/10) == 0 {
-					log.Printf("%d of %d records compared...", totalComputed, n)
+				after := computed.Add(pairs)
+				if after/step != (after-pairs)/step {
+					log.Printf("%d of %d pairs compared...", after, total)
 				}
 			}
-		}(i)
+		}()
 	}
 	wg.Wait()
 	return dist
 }
 
-func computeClassicalMDS(D *mat.Dense, dims int) (*mat.Dense, error) {
-	n, _ := D.Dims()
-
-	log.Printf("squaring distance matrix...")
-	D2 := mat.NewDense(n, n, nil)
-	for i := 0; i < n; i++ {
-		for j := 0; j < n; j++ {
-			d := D.At(i, j)
-			D2.Set(i, j, d*d)
-		}
+// DistanceMatrix computes every pairwise distance between the items.
+func DistanceMatrix(c []Comparable, opts Options) (*SymMatrix, error) {
+	dc, err := newDistancer(c, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare distances: %s", err)
 	}
+	return computeDistanceMatrix(len(c), dc), nil
+}
 
-	log.Printf("centering matrix...")
-	I := mat.NewDense(n, n, nil)
-	ones := mat.NewDense(n, n, nil)
-	for i := 0; i < n; i++ {
-		I.Set(i, i, 1)
-		for j := 0; j < n; j++ {
-			ones.Set(i, j, 1.0/float64(n))
+// computeClassicalMDS squares and double centres D in place into
+// B = -0.5·C·D²·C without ever forming the centring matrix, then keeps only
+// the top dims eigenpairs of B and turns D back into the distances, up to
+// rounding, so that they need not be computed again. Each row may carry a
+// multiplicity weight, which gives the same embedding as repeating that
+// row, by centring on weighted means and decomposing W^½·B·W^½ instead.
+// Alongside the coordinates, the variance explained and the negative
+// eigenvalue mass, it returns an estimate of the most bytes held at once by
+// D and the eigensolver, counted from their sizes.
+func computeClassicalMDS(D *SymMatrix, dims int, weights []float64) (*mat.Dense, []float64, float64, int, error) {
+	n := D.n
+	if n == 0 {
+		return &mat.Dense{}, make([]float64, dims), 0, 0, nil
+	}
+	if weights == nil {
+		weights = make([]float64, n)
+		for i := range weights {
+			weights[i] = 1
 		}
 	}
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
 
-	C := mat.NewDense(n, n, nil)
-	C.Sub(I, ones)
-
-	log.Printf("computing scale...")
-	// B = -0.5 * C * D2 * C
-	tmp := mat.NewDense(n, n, nil)
-	tmp.Mul(C, D2)
-	B := mat.NewDense(n, n, nil)
-	B.Mul(tmp, C)
-	B.Scale(-0.5, B)
+	log.Printf("squaring distance matrix...")
+	for i := range D.data {
+		D.data[i] *= D.data[i]
+	}
 
-	log.Printf("performing eigen decomposition...")
-	symB := mat.NewSymDense(n, nil)
+	log.Printf("double centering matrix...")
+	means := make([]float64, n)
 	for i := 0; i < n; i++ {
-		for j := 0; j <= i; j++ {
-			val := B.At(i, j)
-			symB.SetSym(i, j, val)
+		r := D.row(i)
+		for k, v := range r {
+			means[i] += weights[i+k] * v
+			if k > 0 {
+				means[i+k] += weights[i] * v
+			}
 		}
 	}
-	var eig mat.EigenSym
-	if ok := eig.Factorize(symB, true); !ok {
-		return nil, fmt.Errorf("eigen decomposition failed")
+	var grand float64
+	for i := range means {
+		means[i] /= total
+		grand += weights[i] * means[i]
 	}
-	eigVals := eig.Values(nil)
-	var eigVecs mat.Dense
-	eig.VectorsTo(&eigVecs)
+	grand /= total
+	roots := make([]float64, n)
+	for i, w := range weights {
+		roots[i] = math.Sqrt(w)
+	}
+	var trace float64
+	for i := 0; i < n; i++ {
+		r := D.row(i)
+		for k := range r {
+			r[k] = -0.5 * (r[k] - means[i] - means[i+k] + grand) * roots[i] * roots[i+k]
+		}
+		trace += r[0]
+	}
+
+	log.Printf("computing top %d eigenpairs...", dims)
+	eigVals, eigVecs, topBytes := topEigen(D, dims)
 
 	log.Printf("calculating coordinates from top eigenvectors...")
 	coords := mat.NewDense(n, dims, nil)
-	for i := 0; i < dims; i++ {
-		sqrtVal := math.Sqrt(eigVals[n-1-i])
+	explained := make([]float64, dims)
+	for i := 0; i < len(eigVals); i++ {
+		// Non-Euclidean distances can leave fewer positive eigenvalues than
+		// dimensions. Those axes carry no real spread, so they stay at zero
+		// rather than taking the square root of a negative number.
+		if eigVals[i] <= 0 {
+			log.Printf("eigenvalue %d is %.4g, leaving axis %d at zero...", i+1, eigVals[i], i+1)
+			continue
+		}
+		sqrtVal := math.Sqrt(eigVals[i])
 		for j := 0; j < n; j++ {
-			coords.Set(j, i, eigVecs.At(j, n-1-i)*sqrtVal)
+			coords.Set(j, i, eigVecs.At(j, i)*sqrtVal/roots[j])
+		}
+		if trace > 0 {
+			explained[i] = eigVals[i] / trace
 		}
 	}
-	return coords, nil
+
+	log.Printf("computing negative eigenvalues...")
+	negative, bottomBytes := bottomEigen(D, negativeEigenpairs)
+	// The eigenvectors and coordinates are still held while the negative
+	// eigenvalues are found.
+	estimate := D.Bytes() + 3*n*8 + max(topBytes, bottomBytes+2*n*dims*8)
+	log.Printf("memory: an estimated %.1f MiB held at once in matrices and the lanczos basis", float64(estimate)/(1<<20))
+
+	log.Printf("restoring distance matrix...")
+	for i := 0; i < n; i++ {
+		r := D.row(i)
+		r[0] = 0
+		for k := 1; k < len(r); k++ {
+			squared := -2*r[k]/(roots[i]*roots[i+k]) + means[i] + means[i+k] - grand
+			r[k] = math.Sqrt(max(squared, 0))
+		}
+	}
+	return coords, explained, negativeMass(negative, trace), estimate, nil
 }
 
 func formatCoordinates(d *mat.Dense) []Coordinate {
 	n, _ := d.Dims()
 	coords := make([]Coordinate, n)
 	for i := 0; i < n; i++ {
-		coords[i] = Coordinate{
-			X: d.At(i, 0),
-			Y: d.At(i, 1),
-		}
+		coords[i] = mat.Row(nil, i, d)
 	}
 	return coords
 }
 
-func Coordinates(c []Comparable) ([]Coordinate, error) {
-	log.Printf("computing distance matrix...")
-	d := computeDistanceMatrix(c)
-	log.Printf("computing classical mds...")
-	coords, err := computeClassicalMDS(d, 2)
+// principalAxes rotates a nonlinear embedding onto its principal axes in
+// place, so its first axis carries the most spread as it would for MDS, and
+// returns the share of the variance along each axis.
+func principalAxes(coords *mat.Dense) []float64 {
+	n, dims := coords.Dims()
+	explained := make([]float64, dims)
+	if n < 2 {
+		return explained
+	}
+	var cov mat.SymDense
+	stat.CovarianceMatrix(&cov, coords, nil)
+	var eig mat.EigenSym
+	if ok := eig.Factorize(&cov, true); !ok {
+		return explained
+	}
+	vals := eig.Values(nil)
+	var vecs mat.Dense
+	eig.VectorsTo(&vecs)
+
+	var total float64
+	for _, v := range vals {
+		total += math.Max(v, 0)
+	}
+	order := mat.NewDense(dims, dims, nil)
+	for a := 0; a < dims; a++ {
+		for r := 0; r < dims; r++ {
+			order.Set(r, a, vecs.At(r, dims-1-a))
+		}
+		if total > 0 {
+			explained[a] = math.Max(vals[dims-1-a], 0) / total
+		}
+	}
+	var rotated mat.Dense
+	rotated.Mul(coords, order)
+	coords.Copy(&rotated)
+	return explained
+}
+
+// embedMDS uses exact classical MDS while the distance matrix is affordable
+// and landmark MDS beyond that.
+func embedMDS(d *distancer, counts []float64, opts Options) (*mat.Dense, *SymMatrix, Projection, error) {
+	n := len(counts)
+	if n <= opts.ClassicalLimit {
+		log.Printf("computing distance matrix using %s metric...", d.metric.Name())
+		dist := computeDistanceMatrix(n, d)
+		log.Printf("computing classical mds...")
+		coords, explained, negative, estimate, err := computeClassicalMDS(dist, opts.Dims, counts)
+		return coords, dist, Projection{
+			Method:            ProjectionClassicalMDS,
+			VarianceExplained: explained,
+			EstimatedBytes:    estimate,
+			Diagnostics:       &Diagnostics{NegativeMass: negative},
+		}, err
+	}
+	log.Printf("computing landmark mds using %s metric...", d.metric.Name())
+	coords, explained, negative, err := computeLandmarkMDS(d, counts, opts.Landmarks, opts.Dims)
+	return coords, nil, Projection{
+		Method: ProjectionLandmarkMDS,
+		Parameters: map[string]float64{
+			"landmarks": float64(min(opts.Landmarks, n)),
+		},
+		VarianceExplained: explained,
+		Diagnostics:       &Diagnostics{NegativeMass: negative},
+	}, err
+}
+
+// embedTSNE reads distances from a precomputed matrix while it is
+// affordable, and computes them on demand beyond that. It returns the
+// matrix when there is one.
+func embedTSNE(d *distancer, n int, opts Options, candidates [][]int) (*mat.Dense, *SymMatrix, Projection) {
+	dist := d.distance
+	var matrix *SymMatrix
+	if n <= opts.ClassicalLimit {
+		log.Printf("computing distance matrix using %s metric...", d.metric.Name())
+		matrix = computeDistanceMatrix(n, d)
+		dist = matrix.At
+	}
+	method := ProjectionTSNE
+	if n > tsneExactLimit {
+		method = ProjectionBarnesHutTSNE
+	}
+	log.Printf("computing %s...", method)
+	coords := computeTSNE(dist, n, tsneOptions{
+		dims:       opts.Dims,
+		perplexity: opts.Perplexity,
+		iterations: opts.Iterations,
+		seed:       opts.Seed,
+		candidates: candidates,
+	})
+	return coords, matrix, Projection{
+		Method:            method,
+		VarianceExplained: principalAxes(coords),
+		Parameters: map[string]float64{
+			"perplexity": opts.Perplexity,
+			"iterations": float64(opts.Iterations),
+			"seed":       float64(opts.Seed),
+		},
+	}
+}
+
+// embedUMAP never builds the distance matrix, only a neighbour graph.
+func embedUMAP(d *distancer, n int, opts Options, candidates [][]int) (*mat.Dense, Projection) {
+	log.Printf("computing umap using %s metric...", d.metric.Name())
+	epochs := umapEpochs(n, opts.Epochs)
+	y := computeUMAP(d.distance, n, umapOptions{
+		dims:       opts.Dims,
+		neighbours: opts.Neighbours,
+		minDist:    opts.MinDist,
+		epochs:     epochs,
+		seed:       opts.Seed,
+		candidates: candidates,
+	})
+	coords := mat.NewDense(n, opts.Dims, y)
+	return coords, Projection{
+		Method:            ProjectionUMAP,
+		VarianceExplained: principalAxes(coords),
+		Parameters: map[string]float64{
+			"neighbours": float64(opts.Neighbours),
+			"minDist":    opts.MinDist,
+			"epochs":     float64(epochs),
+			"seed":       float64(opts.Seed),
+		},
+	}
+}
+
+func (o *Options) setDefaults() {
+	if o.Dims <= 0 {
+		o.Dims = DefaultDims
+	}
+	if o.Landmarks <= 0 {
+		o.Landmarks = DefaultLandmarks
+	}
+	if o.ClassicalLimit <= 0 {
+		o.ClassicalLimit = DefaultClassicalLimit
+	}
+	if o.Perplexity <= 0 {
+		o.Perplexity = DefaultPerplexity
+	}
+	if o.Iterations <= 0 {
+		o.Iterations = DefaultIterations
+	}
+	if o.Neighbours <= 0 {
+		o.Neighbours = DefaultNeighbours
+	}
+	if o.MinDist <= 0 {
+		o.MinDist = DefaultMinDist
+	}
+	if o.DiagnosticNeighbours <= 0 {
+		o.DiagnosticNeighbours = DefaultDiagnosticNeighbours
+	}
+	if o.DiagnosticSample <= 0 {
+		o.DiagnosticSample = DefaultDiagnosticSample
+	}
+}
+
+func Coordinates(c []Comparable, opts Options) ([]Coordinate, *Projection, error) {
+	s, err := NewSpace(c, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute mds: %s", err)
+		return nil, nil, err
 	}
-	log.Printf("formatting coodinates...")
-	return formatCoordinates(coords), nil
+	return s.Embed()
 }
@@ -0,0 +1,267 @@
+package similarity
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var benchSizes = []int{250, 500, 1000, 2000}
+
+var benchTemplates = []string{
+	"failed to call SRTP: Post \"https://srtp.internal/api/%d\": context deadline exceeded",
+	"received BESS failure response with status %d for correlation %x",
+	"unexpected error: runtime error: index out of range [%d] with length %d",
+	"failed to delete message %x from queue bms-inbound-%d",
+	"validation failed: field '%s' is required",
+}
+
+type message string
+
+func (m message) Metric() string {
+	return string(m)
+}
+
+// generate makes n synthetic error messages from a handful of templates.
+func generate(n int) []Comparable {
+	rnd := rand.New(rand.NewSource(1))
+	c := make([]Comparable, n)
+	for i := range c {
+		switch t := rnd.Intn(len(benchTemplates)); t {
+		case 4:
+			c[i] = message(fmt.Sprintf(benchTemplates[t], fmt.Sprintf("field%d", rnd.Intn(50))))
+		default:
+			c[i] = message(fmt.Sprintf(benchTemplates[t], rnd.Intn(100000), rnd.Int63()))
+		}
+	}
+	return c
+}
+
+// quiet silences progress logging for the rest of the benchmark.
+func quiet(b *testing.B) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(out) })
+}
+
+// legacyDistanceMatrix is the previous implementation, kept to measure the
+// speed-up against: a mutex-guarded map of computed pairs and both triangles.
+func legacyDistanceMatrix(c []Comparable, m Metric) [][]float64 {
+	n := len(c)
+	numCPU := runtime.NumCPU()
+	chunkSize := (n + numCPU - 1) / numCPU
+	computed := map[string]bool{}
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	mu := sync.Mutex{}
+
+	var wg sync.WaitGroup
+	for base := 0; base < n; base += chunkSize {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := base; i < min(base+chunkSize, n); i++ {
+				for k := 0; k < n; k++ {
+					key := fmt.Sprintf("%d-%d", i, k)
+					mu.Lock()
+					_, ok := computed[key]
+					mu.Unlock()
+					if ok {
+						continue
+					}
+					d := m.Distance(c[i].Metric(), c[k].Metric())
+					mu.Lock()
+					dist[i][k] = d
+					dist[k][i] = d
+					computed[key] = true
+					computed[fmt.Sprintf("%d-%d", k, i)] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return dist
+}
+
+func BenchmarkComputeDistanceMatrix(b *testing.B) {
+	quiet(b)
+	for _, name := range Metrics {
+		m, err := NewMetric(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, n := range benchSizes {
+			c := generate(n)
+			b.Run(fmt.Sprintf("%s/n=%d", name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := DistanceMatrix(c, Options{Metric: m}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLegacyDistanceMatrix(b *testing.B) {
+	quiet(b)
+	m, err := NewMetric(MetricLevenshtein)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, n := range benchSizes {
+		c := generate(n)
+		b.Run(fmt.Sprintf("%s/n=%d", MetricLevenshtein, n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				legacyDistanceMatrix(c, m)
+			}
+		})
+	}
+}
+
+func BenchmarkClassicalMDS(b *testing.B) {
+	quiet(b)
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			D, err := DistanceMatrix(generate(n), Options{Metric: &Levenshtein{}})
+			if err != nil {
+				b.Fatal(err)
+			}
+			d := NewSymMatrix(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				copy(d.data, D.data)
+				b.StartTimer()
+				if _, _, _, _, err := computeClassicalMDS(d, 2, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			copy(d.data, D.data)
+			var estimate int
+			peak := peakHeap(func() {
+				_, _, _, estimate, err = computeClassicalMDS(d, 2, nil)
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(d.Bytes())+float64(peak), "peak-heap-bytes")
+			b.ReportMetric(float64(estimate), "estimated-bytes")
+		})
+	}
+}
+
+// peakHeap runs fn and returns the most heap in use above what was in use
+// when it began, sampled every millisecond while it runs.
+func peakHeap(fn func()) uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	base, peak := m.HeapInuse, m.HeapInuse
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		var s runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&s)
+				peak = max(peak, s.HeapInuse)
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	runtime.ReadMemStats(&m)
+	return max(peak, m.HeapInuse) - base
+}
+
+func TestClassicalMDSEstimatedBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{"empty", 0},
+		{"single", 1},
+		{"small", 50},
+		{"large", 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := DistanceMatrix(generate(tt.n), Options{Metric: &Levenshtein{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			matrix := d.Bytes()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			coords, explained, _, estimate, err := computeClassicalMDS(d, 2, nil)
+			runtime.ReadMemStats(&after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows, _ := coords.Dims(); rows != tt.n {
+				t.Errorf("got %d rows, want %d", rows, tt.n)
+			}
+			if len(explained) != 2 {
+				t.Errorf("got %d axes explained, want 2", len(explained))
+			}
+			// The estimate counts the matrix and at least one Lanczos vector
+			// per wanted axis, but no more on top of the matrix than was
+			// allocated.
+			allocated := int(after.TotalAlloc - before.TotalAlloc)
+			if tt.n > 0 && (estimate < matrix+2*tt.n*8 || estimate > matrix+allocated) {
+				t.Errorf("got estimate of %d bytes, want between %d and %d", estimate, matrix+2*tt.n*8, matrix+allocated)
+			}
+			if tt.n == 0 && estimate != 0 {
+				t.Errorf("got estimate of %d bytes for no items", estimate)
+			}
+		})
+	}
+}
+
+func TestKeptDistanceMatrix(t *testing.T) {
+	for _, projection := range []string{ProjectionMDS, ProjectionTSNE} {
+		t.Run(projection, func(t *testing.T) {
+			opts := Options{Metric: &Levenshtein{}, Projection: projection, Iterations: 250, KeepDistances: true}
+			s, err := NewSpace(generate(60), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := s.Embed(); err != nil {
+				t.Fatal(err)
+			}
+			want := computeDistanceMatrix(s.Len(), s.d)
+			kept := s.DistanceMatrix()
+			for i := range want.data {
+				if math.Abs(kept.data[i]-want.data[i]) > 1e-6 {
+					t.Fatalf("distance %d is %g, want %g", i, kept.data[i], want.data[i])
+				}
+			}
+			// The kept matrix is handed over once, so a caller may change it.
+			if again := s.DistanceMatrix(); again == kept {
+				t.Error("handed over the kept matrix twice")
+			}
+		})
+	}
+}
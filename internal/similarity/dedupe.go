@@ -0,0 +1,89 @@
+package similarity
+
+import (
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// dedupe collapses items with identical keys. It returns the index of the
+// first occurrence of each unique item, the unique index of every item and
+// the multiplicity of each unique item.
+func dedupe(d *distancer, n int) ([]int, []int, []float64) {
+	seen := map[string]int{}
+	unique := []int{}
+	inverse := make([]int, n)
+	counts := []float64{}
+	for i := 0; i < n; i++ {
+		k := d.key(i)
+		u, ok := seen[k]
+		if !ok {
+			u = len(unique)
+			seen[k] = u
+			unique = append(unique, i)
+			counts = append(counts, 0)
+		}
+		inverse[i] = u
+		counts[u]++
+	}
+	return unique, inverse, counts
+}
+
+// fanOut copies the coordinates of each unique item back to every item it
+// stands for, keeping the input order. When jitter is positive, the copies
+// of repeated items are scattered uniformly within a disc whose radius is
+// that fraction of the largest standard deviation of the embedding, so
+// stacked points stay visible.
+func fanOut(coords *mat.Dense, inverse []int, counts []float64, jitter float64, seed int64) *mat.Dense {
+	_, dims := coords.Dims()
+	out := mat.NewDense(max(len(inverse), 1), dims, nil)
+	for i, u := range inverse {
+		out.SetRow(i, coords.RawRowView(u))
+	}
+	if jitter <= 0 || len(inverse) == 0 {
+		return out
+	}
+
+	radius := jitter * maxStdDev(out)
+	rnd := rand.New(rand.NewSource(seed))
+	offset := make([]float64, dims)
+	for i, u := range inverse {
+		if counts[u] < 2 {
+			continue
+		}
+		var norm float64
+		for a := range offset {
+			offset[a] = rnd.NormFloat64()
+			norm += offset[a] * offset[a]
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			continue
+		}
+		r := radius * math.Pow(rnd.Float64(), 1/float64(dims)) / norm
+		row := out.RawRowView(i)
+		for a := range row {
+			row[a] += r * offset[a]
+		}
+	}
+	return out
+}
+
+func maxStdDev(coords *mat.Dense) float64 {
+	n, dims := coords.Dims()
+	var s float64
+	for a := 0; a < dims; a++ {
+		var mean, sq float64
+		for i := 0; i < n; i++ {
+			mean += coords.At(i, a)
+		}
+		mean /= float64(n)
+		for i := 0; i < n; i++ {
+			v := coords.At(i, a) - mean
+			sq += v * v
+		}
+		s = math.Max(s, math.Sqrt(sq/float64(n)))
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package similarity
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	DefaultDiagnosticNeighbours = 10
+	DefaultDiagnosticSample     = 1000
+)
+
+// diagnose measures how faithfully the embedding keeps the distances of an
+// evenly spaced sample of unique items. Stress is weighted by multiplicity
+// like the embedding itself, while trustworthiness and continuity compare
+// neighbourhoods of unique items.
+func (s *Space) diagnose(coords *mat.Dense, diag *Diagnostics) {
+	n := s.Len()
+	m := min(n, s.opts.DiagnosticSample)
+	if m < 2 {
+		return
+	}
+	log.Printf("computing embedding diagnostics over %d unique records...", m)
+	sample := make([]int, m)
+	for i := range sample {
+		sample[i] = i * n / m
+	}
+	high := make([][]float64, m)
+	low := make([][]float64, m)
+	parallel.Range(m, func(lo, hi int) {
+		for a := lo; a < hi; a++ {
+			high[a] = make([]float64, m)
+			low[a] = make([]float64, m)
+			x := coords.RawRowView(sample[a])
+			for b := 0; b < m; b++ {
+				if a == b {
+					continue
+				}
+				high[a][b] = s.d.distance(sample[a], sample[b])
+				low[a][b] = euclidean(x, coords.RawRowView(sample[b]))
+			}
+		}
+	})
+
+	diag.Sample = m
+	diag.Stress = stress(high, low, func(a int) float64 { return s.counts[sample[a]] })
+
+	k := min(s.opts.DiagnosticNeighbours, (2*m-2)/3)
+	if k < 1 {
+		return
+	}
+	diag.Neighbours = k
+	diag.Trustworthiness = trustworthiness(high, low, k)
+	diag.Continuity = trustworthiness(low, high, k)
+}
+
+func euclidean(x, y []float64) float64 {
+	var sum float64
+	for i := range x {
+		d := x[i] - y[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// stress is Kruskal's stress-1 after scaling the embedded distances to best
+// fit the original ones, so it is comparable across projections whose axes
+// have arbitrary units. 0 is a perfect fit.
+func stress(high, low [][]float64, weight func(int) float64) float64 {
+	var cross, highSq, lowSq float64
+	for a := range high {
+		for b := a + 1; b < len(high); b++ {
+			w := weight(a) * weight(b)
+			cross += w * high[a][b] * low[a][b]
+			highSq += w * high[a][b] * high[a][b]
+			lowSq += w * low[a][b] * low[a][b]
+		}
+	}
+	if highSq == 0 || lowSq == 0 {
+		return 0
+	}
+	return math.Sqrt(max(0, 1-cross*cross/(highSq*lowSq)))
+}
+
+// trustworthiness penalises items among the k nearest in the embedding
+// which are not among the k nearest originally, by how far down the
+// original ranking they are. Swapping the arguments gives continuity, which
+// penalises original neighbours lost in the embedding. 1 keeps every
+// neighbourhood intact.
+func trustworthiness(high, low [][]float64, k int) float64 {
+	m := len(high)
+	penalties := make([]float64, m)
+	parallel.Range(m, func(lo, hi int) {
+		for a := lo; a < hi; a++ {
+			rank := make([]int, m)
+			for r, b := range ranked(high[a], a) {
+				rank[b] = r + 1
+			}
+			for _, b := range ranked(low[a], a)[:k] {
+				if rank[b] > k {
+					penalties[a] += float64(rank[b] - k)
+				}
+			}
+		}
+	})
+	var penalty float64
+	for _, p := range penalties {
+		penalty += p
+	}
+	return 1 - 2*penalty/float64(m*k*(2*m-3*k-1))
+}
+
+// ranked orders every item but self by increasing distance.
+func ranked(dist []float64, self int) []int {
+	order := make([]int, 0, len(dist)-1)
+	for b := range dist {
+		if b != self {
+			order = append(order, b)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return dist[order[i]] < dist[order[j]]
+	})
+	return order
+}
@@ -0,0 +1,155 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// pairwise measures every pair of points in the plane.
+func pairwise(points [][2]float64) [][]float64 {
+	d := make([][]float64, len(points))
+	for a := range d {
+		d[a] = make([]float64, len(points))
+		for b := range d[a] {
+			d[a][b] = math.Hypot(points[a][0]-points[b][0], points[a][1]-points[b][1])
+		}
+	}
+	return d
+}
+
+func TestStress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	points := make([][2]float64, 20)
+	scaled := make([][2]float64, len(points))
+	noisy := make([][2]float64, len(points))
+	for i := range points {
+		points[i] = [2]float64{rnd.NormFloat64(), rnd.NormFloat64()}
+		scaled[i] = [2]float64{3 * points[i][0], 3 * points[i][1]}
+		noisy[i] = [2]float64{points[i][0] + rnd.NormFloat64()*0.3, points[i][1] + rnd.NormFloat64()*0.3}
+	}
+	unweighted := func(int) float64 { return 1 }
+	high := pairwise(points)
+	if got := stress(high, pairwise(scaled), unweighted); got > 1e-6 {
+		t.Errorf("scaled copy: got stress %g, want 0", got)
+	}
+	got := stress(high, pairwise(noisy), unweighted)
+	if got <= 0 || got >= 1 {
+		t.Errorf("noisy copy: got stress %g, want within (0, 1)", got)
+	}
+	// Weighting the points the noise moved least lowers the stress.
+	if weighted := stress(high, pairwise(noisy), func(a int) float64 {
+		return 1 / (1e-3 + math.Hypot(noisy[a][0]-points[a][0], noisy[a][1]-points[a][1]))
+	}); weighted >= got {
+		t.Errorf("got weighted stress %g, want below %g", weighted, got)
+	}
+	if got := stress(high, pairwise(make([][2]float64, len(points))), unweighted); got != 0 {
+		t.Errorf("collapsed embedding: got stress %g, want 0 rather than NaN", got)
+	}
+}
+
+func TestTrustworthiness(t *testing.T) {
+	line := make([][2]float64, 30)
+	for i := range line {
+		line[i] = [2]float64{float64(i), 0}
+	}
+	// Folding the line back on itself brings far apart points together.
+	folded := make([][2]float64, len(line))
+	for i := range folded {
+		folded[i] = [2]float64{float64(i % 15), float64(i/15) * 0.1}
+	}
+	high := pairwise(line)
+	for _, k := range []int{1, 5, 10} {
+		if got := trustworthiness(high, high, k); math.Abs(got-1) > 1e-12 {
+			t.Errorf("k=%d identity: got trustworthiness %g, want 1", k, got)
+		}
+		low := pairwise(folded)
+		trust, cont := trustworthiness(high, low, k), trustworthiness(low, high, k)
+		if trust >= 1 || trust < 0 {
+			t.Errorf("k=%d folded: got trustworthiness %g, want within [0, 1)", k, trust)
+		}
+		if cont > 1 || cont < 0 {
+			t.Errorf("k=%d folded: got continuity %g, want within [0, 1]", k, cont)
+		}
+	}
+}
+
+func TestNegativeMass(t *testing.T) {
+	tests := []struct {
+		name  string
+		vals  []float64
+		trace float64
+		want  float64
+	}{
+		{"euclidean", []float64{0, 1e-20}, 10, 0},
+		{"some negative", []float64{-1, -2}, 4, 3.0 / 10},
+		{"empty", nil, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := negativeMass(tt.vals, tt.trace); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: got %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddingDiagnostics(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	planarItems := make([]Comparable, 50)
+	for i := range planarItems {
+		planarItems[i] = message(fmt.Sprintf("%g %g", rnd.NormFloat64()*4, rnd.NormFloat64()))
+	}
+	tests := []struct {
+		name      string
+		items     []Comparable
+		metric    Metric
+		euclidean bool
+	}{
+		{"planar", planarItems, planar{}, true},
+		// Levenshtein distances are far from Euclidean, so some eigenvalues
+		// are negative and the top ones must not be square rooted blindly.
+		{"levenshtein", generate(80), &Levenshtein{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpace(tt.items, Options{Metric: tt.metric, Projection: ProjectionMDS, DiagnosticNeighbours: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			coords, proj, err := s.Embed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range coords {
+				for _, v := range c {
+					if math.IsNaN(v) || math.IsInf(v, 0) {
+						t.Fatalf("item %d: got coordinate %v", i, c)
+					}
+				}
+			}
+			d := proj.Diagnostics
+			if d == nil {
+				t.Fatal("got no diagnostics")
+			}
+			if d.Sample != s.Len() || d.Neighbours != 5 {
+				t.Errorf("got sample %d with %d neighbours, want %d with 5", d.Sample, d.Neighbours, s.Len())
+			}
+			var explained float64
+			for _, v := range proj.VarianceExplained {
+				explained += v
+				if v < 0 || v > 1 {
+					t.Errorf("got variance explained %v", proj.VarianceExplained)
+				}
+			}
+			if tt.euclidean {
+				if d.Stress > 1e-6 || d.NegativeMass > 1e-6 || math.Abs(d.Trustworthiness-1) > 1e-9 || math.Abs(d.Continuity-1) > 1e-9 || math.Abs(explained-1) > 1e-6 {
+					t.Errorf("got %+v explaining %g of a planar embedding, want a perfect fit", d, explained)
+				}
+				return
+			}
+			if d.NegativeMass <= 0 || d.Stress <= 0 || d.Stress >= 1 || d.Trustworthiness <= 0.5 || d.Trustworthiness > 1 {
+				t.Errorf("got %+v for levenshtein distances", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package similarity
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// maxLanczosFloats caps the Krylov basis at 128MiB.
+	maxLanczosFloats = 16 * 1024 * 1024
+
+	// negativeEigenpairs is how many of the most negative eigenvalues are
+	// found to measure how far distances are from Euclidean.
+	negativeEigenpairs = 50
+)
+
+// topEigen returns the k algebraically largest eigenvalues of a, in
+// descending order, along with their eigenvectors as columns. It uses
+// Lanczos iteration with full reorthogonalisation, growing the Krylov
+// subspace until the wanted Ritz pairs have converged, so only a handful of
+// n-length vectors are held alongside the matrix. It also returns the most
+// bytes any attempt held on top of the matrix.
+func topEigen(a *SymMatrix, k int) ([]float64, *mat.Dense, int) {
+	n := a.n
+	k = min(k, n)
+	steps := min(n, max(2*k+20, 40))
+	peak := 0
+	for {
+		vals, vecs, converged, bytes := lanczos(a, k, steps)
+		peak = max(peak, bytes)
+		if converged || steps == n {
+			return vals, vecs, peak
+		}
+		if min(n, steps*2)*n > maxLanczosFloats {
+			log.Printf("lanczos did not fully converge in %d steps, using best estimate", steps)
+			return vals, vecs, peak
+		}
+		steps = min(n, steps*2)
+	}
+}
+
+// bottomEigen returns the k algebraically smallest eigenvalues of a in
+// ascending order, and the most bytes held finding them on top of a. It
+// negates a in place to find them and restores it.
+func bottomEigen(a *SymMatrix, k int) ([]float64, int) {
+	floats.Scale(-1, a.data)
+	vals, _, peak := topEigen(a, k)
+	floats.Scale(-1, a.data)
+	floats.Scale(-1, vals)
+	return vals, peak
+}
+
+// negativeMass is the share of the absolute eigenvalue mass which is
+// negative, the usual measure of how far distances are from Euclidean. The
+// positive eigenvalues sum to the trace plus the negative mass, so only the
+// negative ones are needed; when only the largest of them are known, it is
+// a lower bound.
+func negativeMass(vals []float64, trace float64) float64 {
+	var negative float64
+	for _, v := range vals {
+		if v < 0 {
+			negative -= v
+		}
+	}
+	if trace+2*negative <= 0 {
+		return 0
+	}
+	return negative / (trace + 2*negative)
+}
+
+// lanczos runs the given number of steps and returns the top k Ritz pairs,
+// whether they converged and the bytes held by the basis, the tridiagonal
+// matrix, its eigenvectors and the Ritz vectors.
+func lanczos(a *SymMatrix, k, steps int) ([]float64, *mat.Dense, bool, int) {
+	n := a.n
+	rnd := rand.New(rand.NewSource(1))
+	basis := make([][]float64, 0, steps)
+	alpha := make([]float64, 0, steps)
+	beta := make([]float64, 0, steps)
+
+	q := randomUnit(rnd, n, basis)
+	w := make([]float64, n)
+	var lastBeta float64
+	for j := 0; j < steps; j++ {
+		basis = append(basis, q)
+		a.mulVec(w, q)
+		alpha = append(alpha, floats.Dot(w, q))
+		// Orthogonalising against the whole basis twice keeps the Ritz
+		// values free of spurious copies without any restarts.
+		for pass := 0; pass < 2; pass++ {
+			for _, v := range basis {
+				floats.AddScaled(w, -floats.Dot(w, v), v)
+			}
+		}
+		b := floats.Norm(w, 2)
+		lastBeta = b
+		if j == steps-1 {
+			break
+		}
+		if b < 1e-10*math.Max(1, math.Abs(alpha[j])) {
+			// The subspace is invariant, so carry on from a fresh direction.
+			beta = append(beta, 0)
+			q = randomUnit(rnd, n, basis)
+			if q == nil {
+				break
+			}
+			continue
+		}
+		beta = append(beta, b)
+		q = make([]float64, n)
+		floats.ScaleTo(q, 1/b, w)
+	}
+
+	m := len(basis)
+	T := mat.NewSymDense(m, nil)
+	for i := 0; i < m; i++ {
+		T.SetSym(i, i, alpha[i])
+		if i+1 < m {
+			T.SetSym(i, i+1, beta[i])
+		}
+	}
+	var eig mat.EigenSym
+	eig.Factorize(T, true)
+	ritzVals := eig.Values(nil)
+	var ritzVecs mat.Dense
+	eig.VectorsTo(&ritzVecs)
+
+	k = min(k, m)
+	bytes := 8 * (len(basis)*n + 2*m*m + n*k + 2*n)
+	vals := make([]float64, k)
+	vecs := mat.NewDense(n, k, nil)
+	converged := true
+	scale := math.Max(math.Abs(ritzVals[0]), math.Abs(ritzVals[m-1]))
+	for c := 0; c < k; c++ {
+		col := m - 1 - c
+		vals[c] = ritzVals[col]
+		if math.Abs(lastBeta*ritzVecs.At(m-1, col)) > 1e-8*math.Max(scale, 1e-12) {
+			converged = false
+		}
+		for i, v := range basis {
+			s := ritzVecs.At(i, col)
+			for r := 0; r < n; r++ {
+				vecs.Set(r, c, vecs.At(r, c)+s*v[r])
+			}
+		}
+	}
+	return vals, vecs, converged, bytes
+}
+
+// randomUnit returns a random unit vector orthogonal to the basis, or nil if
+// the basis already spans the space.
+func randomUnit(rnd *rand.Rand, n int, basis [][]float64) []float64 {
+	if len(basis) >= n {
+		return nil
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		q := make([]float64, n)
+		for i := range q {
+			q[i] = rnd.Float64() - 0.5
+		}
+		for pass := 0; pass < 2; pass++ {
+			for _, v := range basis {
+				floats.AddScaled(q, -floats.Dot(q, v), v)
+			}
+		}
+		norm := floats.Norm(q, 2)
+		if norm > 1e-8 {
+			floats.Scale(1/norm, q)
+			return q
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package similarity
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+func randomSym(rnd *rand.Rand, n int) (*SymMatrix, *mat.SymDense) {
+	a := NewSymMatrix(n)
+	dense := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			v := rnd.NormFloat64()
+			a.Set(i, j, v)
+			dense.SetSym(i, j, v)
+		}
+	}
+	return a, dense
+}
+
+func TestTopEigen(t *testing.T) {
+	tests := []struct {
+		name string
+		n, k int
+	}{
+		{"small", 5, 2},
+		{"all", 8, 8},
+		{"medium", 60, 5},
+		{"large", 200, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(int64(tt.n)))
+			a, dense := randomSym(rnd, tt.n)
+			var eig mat.EigenSym
+			if !eig.Factorize(dense, false) {
+				t.Fatal("reference factorisation failed")
+			}
+			want := eig.Values(nil)
+
+			vals, vecs, _ := topEigen(a, tt.k)
+			if len(vals) != tt.k {
+				t.Fatalf("got %d eigenvalues, want %d", len(vals), tt.k)
+			}
+			av := make([]float64, tt.n)
+			for c, v := range vals {
+				if w := want[tt.n-1-c]; math.Abs(v-w) > 1e-6*math.Max(1, math.Abs(w)) {
+					t.Errorf("eigenvalue %d: got %g, want %g", c, v, w)
+				}
+				vec := mat.Col(nil, c, vecs)
+				a.mulVec(av, vec)
+				floats.AddScaled(av, -v, vec)
+				if r := floats.Norm(av, 2); r > 1e-5 {
+					t.Errorf("eigenvector %d: residual %g", c, r)
+				}
+			}
+
+			bottom, _ := bottomEigen(a, tt.k)
+			for c, v := range bottom {
+				if w := want[c]; math.Abs(v-w) > 1e-6*math.Max(1, math.Abs(w)) {
+					t.Errorf("smallest eigenvalue %d: got %g, want %g", c, v, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package similarity
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FeatureKind string
+
+const (
+	FeatureText        FeatureKind = "text"
+	FeatureCategorical FeatureKind = "categorical"
+	FeatureNumeric     FeatureKind = "numeric"
+	FeatureTime        FeatureKind = "time"
+)
+
+// Feature is one typed field of an item. Err is why the field could not be
+// read, which only fails a comparison that weights it.
+type Feature struct {
+	Name   string      `json:"name"`
+	Kind   FeatureKind `json:"kind"`
+	Text   string      `json:"text,omitempty"`
+	Number float64     `json:"number,omitempty"`
+	Time   time.Time   `json:"time,omitempty"`
+	Err    error       `json:"-"`
+}
+
+// Featured is a Comparable which can also be compared on several typed
+// fields. A field which cannot be read carries its own Err rather than
+// failing the others.
+type Featured interface {
+	Comparable
+	Features() []Feature
+}
+
+// Weights maps feature names to their share of the combined distance. An
+// empty set of weights compares on Metric alone.
+type Weights map[string]float64
+
+// distancer computes the distance between two items by index, holding
+// everything which only needs to be derived once per dataset.
+type distancer struct {
+	metric   Metric
+	texts    []string
+	names    []string
+	weights  []float64
+	kinds    []FeatureKind
+	features [][]Feature
+	scales   []float64
+	// hashed is the metric when it can take precomputed hashes, with
+	// hashes holding one per item for texts, or one per feature of each
+	// item, filled in for text features.
+	hashed hashedMetric
+	hashes []uint64
+}
+
+func newDistancer(c []Comparable, opts Options) (*distancer, error) {
+	m := opts.Metric
+	if m == nil {
+		m = &Levenshtein{}
+	}
+	d := &distancer{
+		metric: m,
+		texts:  make([]string, len(c)),
+	}
+	for i := range c {
+		d.texts[i] = c[i].Metric()
+	}
+
+	corpus := d.texts
+	if len(opts.Weights) > 0 {
+		if err := d.fitFeatures(c, opts.Weights); err != nil {
+			return nil, err
+		}
+		corpus = []string{}
+		for _, fs := range d.features {
+			for k, f := range fs {
+				if d.kinds[k] == FeatureText {
+					corpus = append(corpus, f.Text)
+				}
+			}
+		}
+	}
+	if cm, ok := m.(CorpusMetric); ok {
+		log.Printf("fitting %s metric...", m.Name())
+		cm.Fit(corpus)
+	}
+	d.hashTexts()
+	return d, nil
+}
+
+// stride is the number of hashes kept per item.
+func (d *distancer) stride() int {
+	if d.features == nil {
+		return 1
+	}
+	return len(d.names)
+}
+
+// hashTexts hashes each distinct text compared by the metric once, when it
+// can look distances up by hash, rather than on every comparison.
+func (d *distancer) hashTexts() {
+	d.hashed, _ = d.metric.(hashedMetric)
+	d.hashes = nil
+	if d.hashed == nil {
+		return
+	}
+	seen := map[string]uint64{}
+	hash := func(s string) uint64 {
+		h, ok := seen[s]
+		if !ok {
+			h = hashString(s)
+			seen[s] = h
+		}
+		return h
+	}
+	stride := d.stride()
+	d.hashes = make([]uint64, len(d.texts)*stride)
+	for i := range d.texts {
+		if d.features == nil {
+			d.hashes[i] = hash(d.texts[i])
+			continue
+		}
+		for k, f := range d.features[i] {
+			if d.kinds[k] == FeatureText {
+				d.hashes[i*stride+k] = hash(f.Text)
+			}
+		}
+	}
+}
+
+// textDistance compares two texts, the h-th hashes of their items.
+func (d *distancer) textDistance(a, b string, ha, hb int) float64 {
+	if d.hashed == nil {
+		return d.metric.Distance(a, b)
+	}
+	return d.hashed.distanceHashed(a, b, d.hashes[ha], d.hashes[hb])
+}
+
+func (d *distancer) fitFeatures(c []Comparable, weights Weights) error {
+	for name, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("weight for feature '%s' must not be negative", name)
+		}
+		if w > 0 {
+			d.names = append(d.names, name)
+		}
+	}
+	if len(d.names) == 0 {
+		return fmt.Errorf("feature weights must not all be zero")
+	}
+	slices.Sort(d.names)
+	d.weights = make([]float64, len(d.names))
+	for k, name := range d.names {
+		d.weights[k] = weights[name]
+	}
+	d.kinds = make([]FeatureKind, len(d.names))
+	features, err := d.extractFeatures(c)
+	if err != nil {
+		return err
+	}
+	d.features = features
+
+	d.scales = make([]float64, len(d.names))
+	for k := range d.names {
+		if d.kinds[k] != FeatureNumeric && d.kinds[k] != FeatureTime {
+			continue
+		}
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i := range d.features {
+			v := featureValue(d.features[i][k])
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+		if len(d.features) > 0 {
+			d.scales[k] = hi - lo
+		}
+	}
+	return nil
+}
+
+// extractFeatures picks out the weighted features of each item, in the
+// order of d.names, and records their kinds.
+func (d *distancer) extractFeatures(c []Comparable) ([][]Feature, error) {
+	features := make([][]Feature, len(c))
+	for i := range c {
+		f, ok := c[i].(Featured)
+		if !ok {
+			return nil, fmt.Errorf("weights were given but item %d has no features", i)
+		}
+		all := f.Features()
+		byName := map[string]Feature{}
+		for _, feature := range all {
+			byName[feature.Name] = feature
+		}
+		features[i] = make([]Feature, len(d.names))
+		for k, name := range d.names {
+			feature, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("item %d has no feature named '%s'", i, name)
+			}
+			if feature.Err != nil {
+				return nil, fmt.Errorf("failed to get feature '%s' of item %d: %s", name, i, feature.Err)
+			}
+			features[i][k] = feature
+			d.kinds[k] = feature.Kind
+		}
+	}
+	return features, nil
+}
+
+// extend returns a distancer over d's items followed by the given ones,
+// measured with the metric, weights and scales already fitted to d.
+func (d *distancer) extend(c []Comparable) (*distancer, error) {
+	e := *d
+	e.texts = append(slices.Clip(d.texts), make([]string, len(c))...)
+	for i := range c {
+		e.texts[len(d.texts)+i] = c[i].Metric()
+	}
+	if d.features != nil {
+		e.kinds = slices.Clone(d.kinds)
+		features, err := e.extractFeatures(c)
+		if err != nil {
+			return nil, err
+		}
+		e.features = append(slices.Clip(d.features), features...)
+	}
+	e.hashTexts()
+	return &e, nil
+}
+
+func featureValue(f Feature) float64 {
+	if f.Kind == FeatureTime {
+		return float64(f.Time.UnixMilli())
+	}
+	return f.Number
+}
+
+func (d *distancer) distance(i, j int) float64 {
+	if d.features == nil {
+		return d.textDistance(d.texts[i], d.texts[j], i, j)
+	}
+	stride := d.stride()
+	var total, weight float64
+	for k, w := range d.weights {
+		a := d.features[i][k]
+		b := d.features[j][k]
+		var dist float64
+		switch d.kinds[k] {
+		case FeatureText:
+			dist = d.textDistance(a.Text, b.Text, i*stride+k, j*stride+k)
+		case FeatureCategorical:
+			if a.Text != b.Text {
+				dist = 1
+			}
+		case FeatureNumeric, FeatureTime:
+			if d.scales[k] > 0 {
+				dist = math.Min(1, math.Abs(featureValue(a)-featureValue(b))/d.scales[k])
+			}
+		}
+		total += w * dist
+		weight += w
+	}
+	if weight == 0 {
+		return 0
+	}
+	return total / weight
+}
+
+// key identifies everything the distance between two items depends on, so
+// items with equal keys are always at distance zero from each other.
+func (d *distancer) key(i int) string {
+	if d.features == nil {
+		return d.texts[i]
+	}
+	var b strings.Builder
+	for k, f := range d.features[i] {
+		switch d.kinds[k] {
+		case FeatureText, FeatureCategorical:
+			b.WriteString(strconv.Quote(f.Text))
+		default:
+			b.WriteString(strconv.FormatFloat(featureValue(f), 'g', -1, 64))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// subset returns a distancer over the given items which keeps the scales
+// fitted to the whole dataset.
+func (d *distancer) subset(idx []int) *distancer {
+	s := *d
+	s.texts = make([]string, len(idx))
+	for i, j := range idx {
+		s.texts[i] = d.texts[j]
+	}
+	if d.features != nil {
+		s.features = make([][]Feature, len(idx))
+		for i, j := range idx {
+			s.features[i] = d.features[j]
+		}
+	}
+	if d.hashes != nil {
+		stride := d.stride()
+		s.hashes = make([]uint64, len(idx)*stride)
+		for i, j := range idx {
+			copy(s.hashes[i*stride:(i+1)*stride], d.hashes[j*stride:(j+1)*stride])
+		}
+	}
+	return &s
+}
@@ -0,0 +1,96 @@
+package similarity
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// record is an item compared on an error message, a service, a status code
+// and a time, which may fail to read.
+type record struct {
+	text    string
+	service string
+	status  float64
+	at      time.Time
+	err     error
+}
+
+func (r record) Metric() string {
+	return r.text
+}
+
+func (r record) Features() []Feature {
+	return []Feature{
+		{Name: "text", Kind: FeatureText, Text: r.text},
+		{Name: "service", Kind: FeatureCategorical, Text: r.service},
+		{Name: "status", Kind: FeatureNumeric, Number: r.status},
+		{Name: "time", Kind: FeatureTime, Time: r.at, Err: r.err},
+	}
+}
+
+func TestWeightedDistance(t *testing.T) {
+	epoch := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := []Comparable{
+		record{"abcd", "a", 500, epoch, nil},
+		record{"abcd", "b", 500, epoch.Add(time.Hour), nil},
+		record{"abce", "a", 400, epoch.Add(2 * time.Hour), nil},
+	}
+	tests := []struct {
+		name    string
+		weights Weights
+		want    [3]float64 // distances 0-1, 0-2 and 1-2
+	}{
+		{"text", Weights{"text": 1}, [3]float64{0, 0.25, 0.25}},
+		{"service", Weights{"service": 1}, [3]float64{1, 0, 1}},
+		{"status", Weights{"status": 1}, [3]float64{0, 1, 1}},
+		{"time", Weights{"time": 1}, [3]float64{0.5, 1, 0.5}},
+		{"combined", Weights{"text": 2, "service": 1, "time": 1}, [3]float64{0.375, 0.375, 0.5}},
+		{"zero weight ignored", Weights{"service": 1, "status": 0}, [3]float64{1, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDistancer(items, Options{Metric: &Levenshtein{}, Weights: tt.weights})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for p, pair := range [3][2]int{{0, 1}, {0, 2}, {1, 2}} {
+				if got := d.distance(pair[0], pair[1]); math.Abs(got-tt.want[p]) > 1e-9 {
+					t.Errorf("distance %d-%d: got %g, want %g", pair[0], pair[1], got, tt.want[p])
+				}
+				if got := d.distance(pair[1], pair[0]); math.Abs(got-tt.want[p]) > 1e-9 {
+					t.Errorf("distance %d-%d: got %g, want %g", pair[1], pair[0], got, tt.want[p])
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedDistanceErrors(t *testing.T) {
+	unreadable := []Comparable{
+		record{"abcd", "a", 500, time.Time{}, errors.New("no time")},
+		record{"abce", "b", 500, time.Time{}, nil},
+	}
+	tests := []struct {
+		name    string
+		items   []Comparable
+		weights Weights
+		fails   bool
+	}{
+		{"unweighted unreadable feature", unreadable, Weights{"text": 1, "service": 1}, false},
+		{"weighted unreadable feature", unreadable, Weights{"text": 1, "time": 1}, true},
+		{"unknown feature", unreadable, Weights{"missing": 1}, true},
+		{"negative weight", unreadable, Weights{"text": -1}, true},
+		{"all zero", unreadable, Weights{"text": 0}, true},
+		{"no features", []Comparable{message("abcd")}, Weights{"text": 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newDistancer(tt.items, Options{Weights: tt.weights})
+			if (err != nil) != tt.fails {
+				t.Errorf("got error %v, want failure %t", err, tt.fails)
+			}
+		})
+	}
+}
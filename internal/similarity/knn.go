@@ -0,0 +1,198 @@
+package similarity
+
+import (
+	"log"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+const (
+	// exactKNNLimit is the largest input whose neighbours are found by
+	// comparing every pair rather than by NN-descent.
+	exactKNNLimit = 2000
+
+	nnDescentIterations = 10
+	nnDescentDelta      = 0.001
+	nnDescentBatch      = 4096
+)
+
+type neighbour struct {
+	j     int
+	d     float64
+	fresh bool
+}
+
+// knnGraph holds the k nearest neighbours of every item in ascending order
+// of distance.
+type knnGraph struct {
+	k         int
+	neighbors [][]neighbour
+}
+
+// insert adds j to the neighbours of i if it is closer than the furthest
+// one, and reports whether it did.
+func (g *knnGraph) insert(i, j int, d float64) bool {
+	nb := g.neighbors[i]
+	if len(nb) == g.k && d >= nb[len(nb)-1].d {
+		return false
+	}
+	for _, v := range nb {
+		if v.j == j {
+			return false
+		}
+	}
+	pos := sort.Search(len(nb), func(m int) bool {
+		return nb[m].d > d
+	})
+	if len(nb) < g.k {
+		nb = append(nb, neighbour{})
+	}
+	copy(nb[pos+1:], nb[pos:len(nb)-1])
+	nb[pos] = neighbour{j: j, d: d, fresh: true}
+	g.neighbors[i] = nb
+	return true
+}
+
+// computeKNN finds the k nearest neighbours of every item without holding
+// more than n·k distances, exactly for small inputs and with NN-descent
+// (Dong, Charikar & Li, 2011) otherwise. NN-descent starts from any
+// candidate neighbours given, such as those sharing an LSH bucket, topped
+// up with random items.
+func computeKNN(dist func(i, j int) float64, n, k int, seed int64, candidates [][]int) *knnGraph {
+	k = min(k, n-1)
+	g := &knnGraph{
+		k:         k,
+		neighbors: make([][]neighbour, n),
+	}
+	if k <= 0 {
+		return g
+	}
+	if n <= exactKNNLimit {
+		parallel.Range(n, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				g.neighbors[i] = make([]neighbour, 0, k)
+				for j := 0; j < n; j++ {
+					if j != i {
+						g.insert(i, j, dist(i, j))
+					}
+				}
+			}
+		})
+		return g
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	initial := make([][]int, n)
+	for i := range initial {
+		initial[i] = make([]int, 0, k)
+		if candidates != nil {
+			for _, j := range candidates[i][:min(k, len(candidates[i]))] {
+				if j != i && !slices.Contains(initial[i], j) {
+					initial[i] = append(initial[i], j)
+				}
+			}
+		}
+		for len(initial[i]) < k {
+			j := rnd.Intn(n)
+			if j != i && !slices.Contains(initial[i], j) {
+				initial[i] = append(initial[i], j)
+			}
+		}
+	}
+	parallel.Range(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			g.neighbors[i] = make([]neighbour, 0, k)
+			for _, j := range initial[i] {
+				g.insert(i, j, dist(i, j))
+			}
+		}
+	})
+
+	for iter := 0; iter < nnDescentIterations; iter++ {
+		updates := g.localJoin(dist)
+		log.Printf("nn-descent iteration %d made %d updates...", iter+1, updates)
+		if float64(updates) <= nnDescentDelta*float64(n*k) {
+			break
+		}
+	}
+	return g
+}
+
+type proposal struct {
+	p, q int
+	d    float64
+}
+
+// localJoin compares every pair of neighbours, and reverse neighbours, of
+// each item where at least one is new since the last join. Distances are
+// computed in parallel a batch at a time and applied in a fixed order, so
+// the graph is reproducible.
+func (g *knnGraph) localJoin(dist func(i, j int) float64) int {
+	n := len(g.neighbors)
+	fresh := make([][]int, n)
+	stale := make([][]int, n)
+	for i, nb := range g.neighbors {
+		for m := range nb {
+			if nb[m].fresh {
+				fresh[i] = append(fresh[i], nb[m].j)
+				nb[m].fresh = false
+			} else {
+				stale[i] = append(stale[i], nb[m].j)
+			}
+		}
+	}
+	freshCandidates := make([][]int, n)
+	staleCandidates := make([][]int, n)
+	for i := 0; i < n; i++ {
+		freshCandidates[i] = append(freshCandidates[i], fresh[i]...)
+		staleCandidates[i] = append(staleCandidates[i], stale[i]...)
+	}
+	for i := 0; i < n; i++ {
+		for _, j := range fresh[i] {
+			if len(freshCandidates[j]) < 2*g.k && !slices.Contains(freshCandidates[j], i) {
+				freshCandidates[j] = append(freshCandidates[j], i)
+			}
+		}
+		for _, j := range stale[i] {
+			if len(staleCandidates[j]) < 2*g.k && !slices.Contains(staleCandidates[j], i) {
+				staleCandidates[j] = append(staleCandidates[j], i)
+			}
+		}
+	}
+
+	updates := 0
+	for lo := 0; lo < n; lo += nnDescentBatch {
+		hi := min(lo+nnDescentBatch, n)
+		batch := make([][]proposal, hi-lo)
+		parallel.Range(hi-lo, func(blo, bhi int) {
+			for b := blo; b < bhi; b++ {
+				u := lo + b
+				fc := freshCandidates[u]
+				for x, p := range fc {
+					for _, q := range fc[x+1:] {
+						batch[b] = append(batch[b], proposal{p, q, dist(p, q)})
+					}
+					for _, q := range staleCandidates[u] {
+						if p != q {
+							batch[b] = append(batch[b], proposal{p, q, dist(p, q)})
+						}
+					}
+				}
+			}
+		})
+		for _, props := range batch {
+			for _, pr := range props {
+				if g.insert(pr.p, pr.q, pr.d) {
+					updates++
+				}
+				if g.insert(pr.q, pr.p, pr.d) {
+					updates++
+				}
+			}
+		}
+	}
+	return updates
+}
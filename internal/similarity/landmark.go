@@ -0,0 +1,152 @@
+package similarity
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+	"gonum.org/v1/gonum/mat"
+)
+
+// selectLandmarks picks k landmarks with the MaxMin heuristic, each one being
+// the item furthest from all those already chosen. It returns the landmark
+// indices along with their k×n distance matrix, which is the only distance
+// data landmark MDS needs.
+func selectLandmarks(d *distancer, n, k int) ([]int, *mat.Dense) {
+	landmarks := make([]int, 0, k)
+	dist := mat.NewDense(k, n, nil)
+	nearest := make([]float64, n)
+	for i := range nearest {
+		nearest[i] = math.Inf(1)
+	}
+
+	next := 0
+	for l := 0; l < k; l++ {
+		landmarks = append(landmarks, next)
+		row := dist.RawRowView(l)
+		parallel.Range(n, func(lo, hi int) {
+			for j := lo; j < hi; j++ {
+				row[j] = d.distance(next, j)
+				nearest[j] = math.Min(nearest[j], row[j])
+			}
+		})
+		for j := range nearest {
+			if nearest[j] > nearest[next] {
+				next = j
+			}
+		}
+		if (l+1)%max(k/10, 1) == 0 {
+			log.Printf("%d of %d landmarks selected...", l+1, k)
+		}
+	}
+	return landmarks, dist
+}
+
+// computeLandmarkMDS embeds the k landmarks with classical MDS, then places
+// every item by distance-based triangulation against them (de Silva &
+// Tenenbaum, 2004). Each landmark is weighted by the counts of the items
+// nearest to it, and the landmarks are centred on their weighted means as
+// classical MDS centres weighted rows, so duplicates pull the embedding as
+// they would if every copy were present.
+func computeLandmarkMDS(d *distancer, counts []float64, k, dims int) (*mat.Dense, []float64, float64, error) {
+	n := len(counts)
+	k = min(k, n)
+	if k <= dims {
+		return nil, nil, 0, fmt.Errorf("need more than %d landmarks, got %d", dims, k)
+	}
+
+	log.Printf("selecting %d landmarks...", k)
+	landmarks, dist := selectLandmarks(d, n, k)
+
+	weights := make([]float64, k)
+	var total float64
+	for j, c := range counts {
+		nearest := 0
+		for i := 1; i < k; i++ {
+			if dist.At(i, j) < dist.At(nearest, j) {
+				nearest = i
+			}
+		}
+		weights[nearest] += c
+		total += c
+	}
+	roots := make([]float64, k)
+	for i, w := range weights {
+		roots[i] = math.Sqrt(w)
+	}
+
+	log.Printf("embedding landmarks...")
+	sq := mat.NewDense(k, k, nil)
+	for i := 0; i < k; i++ {
+		for j := 0; j < k; j++ {
+			v := dist.At(i, landmarks[j])
+			sq.Set(i, j, v*v)
+		}
+	}
+	means := make([]float64, k)
+	var grand float64
+	for i := 0; i < k; i++ {
+		for j := 0; j < k; j++ {
+			means[i] += weights[j] * sq.At(i, j)
+		}
+		means[i] /= total
+		grand += weights[i] * means[i]
+	}
+	grand /= total
+	// Decomposing W^½·B·W^½ rather than B gives the landmarks the weight
+	// of the items they stand for.
+	B := mat.NewSymDense(k, nil)
+	var trace float64
+	for i := 0; i < k; i++ {
+		for j := 0; j <= i; j++ {
+			B.SetSym(i, j, -0.5*roots[i]*roots[j]*(sq.At(i, j)-means[i]-means[j]+grand))
+		}
+		trace += B.At(i, i)
+	}
+	var eig mat.EigenSym
+	if ok := eig.Factorize(B, true); !ok {
+		return nil, nil, 0, fmt.Errorf("eigen decomposition failed")
+	}
+	eigVals := eig.Values(nil)
+	var eigVecs mat.Dense
+	eig.VectorsTo(&eigVecs)
+
+	// Rows of the pseudo-inverse transpose of the landmark coordinates.
+	pinv := mat.NewDense(dims, k, nil)
+	explained := make([]float64, dims)
+	for a := 0; a < dims; a++ {
+		// Axes without meaningful variance would be scaled up by the
+		// reciprocal of a rounding error, so they are left at zero.
+		val := eigVals[k-1-a]
+		if val <= 1e-10*eigVals[k-1] {
+			continue
+		}
+		if trace > 0 {
+			explained[a] = val / trace
+		}
+		for i := 0; i < k; i++ {
+			pinv.Set(a, i, roots[i]*eigVecs.At(i, k-1-a)/math.Sqrt(val))
+		}
+	}
+
+	log.Printf("triangulating %d records against landmarks...", n)
+	coords := mat.NewDense(n, dims, nil)
+	parallel.Range(n, func(lo, hi int) {
+		delta := make([]float64, k)
+		for j := lo; j < hi; j++ {
+			for i := 0; i < k; i++ {
+				v := dist.At(i, j)
+				delta[i] = v*v - means[i]
+			}
+			for a := 0; a < dims; a++ {
+				var x float64
+				for i := 0; i < k; i++ {
+					x += pinv.At(a, i) * delta[i]
+				}
+				coords.Set(j, a, -0.5*x)
+			}
+		}
+	})
+	return coords, explained, negativeMass(eigVals, trace), nil
+}
@@ -0,0 +1,85 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// planar measures points written as "x y".
+type planar struct{}
+
+func (planar) Name() string {
+	return "planar"
+}
+
+func (planar) Distance(a, b string) float64 {
+	var ax, ay, bx, by float64
+	fmt.Sscan(a, &ax, &ay)
+	fmt.Sscan(b, &bx, &by)
+	return math.Hypot(ax-bx, ay-by)
+}
+
+func TestLandmarkMDS(t *testing.T) {
+	tests := []struct {
+		name     string
+		n, k     int
+		weighted bool
+		centred  bool
+	}{
+		{"all landmarks", 30, 30, false, true},
+		{"all landmarks weighted", 30, 30, true, true},
+		{"some landmarks", 60, 20, false, false},
+		{"some landmarks weighted", 60, 20, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(int64(tt.n + tt.k)))
+			items := make([]Comparable, tt.n)
+			points := make([][2]float64, tt.n)
+			counts := make([]float64, tt.n)
+			for i := range items {
+				points[i] = [2]float64{rnd.NormFloat64() * 5, rnd.NormFloat64()}
+				items[i] = message(fmt.Sprintf("%g %g", points[i][0], points[i][1]))
+				counts[i] = 1
+				if tt.weighted {
+					counts[i] = float64(1 + rnd.Intn(20))
+				}
+			}
+			d, err := newDistancer(items, Options{Metric: planar{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			coords, _, _, err := computeLandmarkMDS(d, counts, tt.k, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.n; i++ {
+				for j := i + 1; j < tt.n; j++ {
+					got := math.Hypot(coords.At(i, 0)-coords.At(j, 0), coords.At(i, 1)-coords.At(j, 1))
+					want := math.Hypot(points[i][0]-points[j][0], points[i][1]-points[j][1])
+					if math.Abs(got-want) > 1e-6 {
+						t.Fatalf("distance %d-%d: got %g, want %g", i, j, got, want)
+					}
+				}
+			}
+			if !tt.centred {
+				return
+			}
+			var total float64
+			mean := make([]float64, 2)
+			for i, c := range counts {
+				total += c
+				for a := range mean {
+					mean[a] += c * coords.At(i, a)
+				}
+			}
+			for a := range mean {
+				if m := mean[a] / total; math.Abs(m) > 1e-6 {
+					t.Errorf("axis %d: weighted mean %g, want 0", a, m)
+				}
+			}
+		})
+	}
+}
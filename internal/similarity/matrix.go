@@ -0,0 +1,111 @@
+package similarity
+
+import (
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SymMatrix is a symmetric matrix which only stores its upper triangle,
+// halving the memory of a dense n×n matrix. It satisfies mat.Symmetric.
+type SymMatrix struct {
+	n    int
+	data []float64
+}
+
+func NewSymMatrix(n int) *SymMatrix {
+	return &SymMatrix{
+		n:    n,
+		data: make([]float64, n*(n+1)/2),
+	}
+}
+
+func (m *SymMatrix) index(i, j int) int {
+	if i > j {
+		i, j = j, i
+	}
+	return i*m.n - i*(i-1)/2 + j - i
+}
+
+func (m *SymMatrix) At(i, j int) float64 {
+	return m.data[m.index(i, j)]
+}
+
+func (m *SymMatrix) Set(i, j int, v float64) {
+	m.data[m.index(i, j)] = v
+}
+
+// row returns the upper triangle of row i, from the diagonal onwards.
+func (m *SymMatrix) row(i int) []float64 {
+	start := m.index(i, i)
+	return m.data[start : start+m.n-i]
+}
+
+func (m *SymMatrix) Dims() (int, int) {
+	return m.n, m.n
+}
+
+func (m *SymMatrix) T() mat.Matrix {
+	return m
+}
+
+func (m *SymMatrix) SymmetricDim() int {
+	return m.n
+}
+
+func (m *SymMatrix) Bytes() int {
+	return len(m.data) * 8
+}
+
+// balancedRows splits the rows of an n×n upper triangle into at most parts
+// contiguous blocks holding roughly the same number of elements. The
+// returned slice holds the boundaries, so block p is rows[p] to rows[p+1].
+func balancedRows(n, parts int) []int {
+	total := n * (n + 1) / 2
+	per := max((total+parts-1)/parts, 1)
+	rows := []int{0}
+	count := 0
+	for i := 0; i < n; i++ {
+		count += n - i
+		if count >= per && i+1 < n {
+			rows = append(rows, i+1)
+			count = 0
+		}
+	}
+	return append(rows, n)
+}
+
+// mulVec sets y = m·x, splitting the upper triangle across a worker per CPU
+// with a private accumulator each so no writes are shared.
+func (m *SymMatrix) mulVec(y, x []float64) {
+	rows := balancedRows(m.n, runtime.NumCPU())
+	partials := make([][]float64, len(rows)-1)
+	var wg sync.WaitGroup
+	for p := range partials {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acc := make([]float64, m.n)
+			for i := rows[p]; i < rows[p+1]; i++ {
+				r := m.row(i)
+				xi := x[i]
+				sum := r[0] * xi
+				for k := 1; k < len(r); k++ {
+					j := i + k
+					sum += r[k] * x[j]
+					acc[j] += r[k] * xi
+				}
+				acc[i] += sum
+			}
+			partials[p] = acc
+		}()
+	}
+	wg.Wait()
+	clear(y)
+	for _, acc := range partials {
+		for i, v := range acc {
+			y[i] += v
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/agnivade/levenshtein"
+)
+
+// Metric is a normalised distance between two strings, where 0 is identical
+// and 1 is completely dissimilar.
+type Metric interface {
+	Name() string
+	Distance(a, b string) float64
+}
+
+// CorpusMetric is a Metric which needs to see every string in the dataset
+// before it can compare any of them.
+type CorpusMetric interface {
+	Metric
+	Fit(corpus []string)
+}
+
+// Frozen returns a metric fitted to a corpus as a plain Metric, so that
+// spaces built with it compare their strings with what it was fitted to
+// rather than fitting it again. Other metrics are returned as they are.
+func Frozen(m Metric) Metric {
+	if _, ok := m.(CorpusMetric); ok {
+		return frozenMetric{m}
+	}
+	return m
+}
+
+type frozenMetric struct {
+	Metric
+}
+
+const (
+	MetricLevenshtein = "levenshtein"
+	MetricJaroWinkler = "jaro-winkler"
+	MetricJaccard     = "jaccard"
+	MetricNGramCosine = "ngram-cosine"
+	MetricTFIDFCosine = "tfidf-cosine"
+)
+
+var Metrics = []string{
+	MetricLevenshtein,
+	MetricJaroWinkler,
+	MetricJaccard,
+	MetricNGramCosine,
+	MetricTFIDFCosine,
+}
+
+func NewMetric(name string) (Metric, error) {
+	switch name {
+	case MetricLevenshtein, "":
+		return &Levenshtein{}, nil
+	case MetricJaroWinkler:
+		return &JaroWinkler{}, nil
+	case MetricJaccard:
+		return &TokenJaccard{}, nil
+	case MetricNGramCosine:
+		return &NGramCosine{N: 3}, nil
+	case MetricTFIDFCosine:
+		return &TFIDFCosine{}, nil
+	}
+	return nil, fmt.Errorf("unknown metric '%s', expected one of %s", name, strings.Join(Metrics, ", "))
+}
+
+type Levenshtein struct{}
+
+func (m *Levenshtein) Name() string {
+	return MetricLevenshtein
+}
+
+func (m *Levenshtein) Distance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	maxLen := math.Max(float64(utf8.RuneCountInString(a)), float64(utf8.RuneCountInString(b)))
+	if maxLen == 0 {
+		return 0
+	}
+	return float64(levenshtein.ComputeDistance(a, b)) / maxLen
+}
+
+type JaroWinkler struct{}
+
+func (m *JaroWinkler) Name() string {
+	return MetricJaroWinkler
+}
+
+func (m *JaroWinkler) Distance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 1
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	window = max(window, 0)
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo := max(0, i-window)
+		hi := min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if matchedB[j] || ra[i] != rb[j] {
+				continue
+			}
+			matchedA[i] = true
+			matchedB[j] = true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 1
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m64 := float64(matches)
+	jaro := (m64/float64(len(ra)) + m64/float64(len(rb)) + (m64-float64(transpositions)/2)/m64) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return 1 - (jaro + float64(prefix)*0.1*(1-jaro))
+}
+
+type TokenJaccard struct{}
+
+func (m *TokenJaccard) Name() string {
+	return MetricJaccard
+}
+
+func (m *TokenJaccard) Distance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	ta := tokenSet(a)
+	tb := tokenSet(b)
+	if len(ta) == 0 && len(tb) == 0 {
+		return 0
+	}
+	intersection := 0
+	for t := range ta {
+		if tb[t] {
+			intersection++
+		}
+	}
+	union := len(ta) + len(tb) - intersection
+	return 1 - float64(intersection)/float64(union)
+}
+
+type NGramCosine struct {
+	N int
+}
+
+func (m *NGramCosine) Name() string {
+	return MetricNGramCosine
+}
+
+func (m *NGramCosine) Distance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	return cosineDistance(ngramCounts(a, m.N), ngramCounts(b, m.N))
+}
+
+type TFIDFCosine struct {
+	idf     map[string]float64
+	vectors map[string]map[string]float64
+	docs    int
+}
+
+func (m *TFIDFCosine) Name() string {
+	return MetricTFIDFCosine
+}
+
+// Fit builds the inverse document frequencies from the corpus and caches the
+// weighted vector of every string, so Distance is safe to call concurrently
+// once it returns.
+func (m *TFIDFCosine) Fit(corpus []string) {
+	df := map[string]int{}
+	seen := map[string]bool{}
+	for _, doc := range corpus {
+		if seen[doc] {
+			continue
+		}
+		seen[doc] = true
+		for t := range tokenSet(doc) {
+			df[t]++
+		}
+	}
+	m.docs = len(seen)
+	m.idf = make(map[string]float64, len(df))
+	for t, n := range df {
+		m.idf[t] = math.Log(float64(1+m.docs)/float64(1+n)) + 1
+	}
+	m.vectors = make(map[string]map[string]float64, len(seen))
+	for doc := range seen {
+		m.vectors[doc] = m.vector(doc)
+	}
+}
+
+func (m *TFIDFCosine) vector(doc string) map[string]float64 {
+	v := map[string]float64{}
+	for _, t := range tokens(doc) {
+		v[t]++
+	}
+	for t, tf := range v {
+		idf, ok := m.idf[t]
+		if !ok {
+			idf = math.Log(float64(1+m.docs)) + 1
+		}
+		v[t] = tf * idf
+	}
+	return v
+}
+
+func (m *TFIDFCosine) lookup(doc string) map[string]float64 {
+	if v, ok := m.vectors[doc]; ok {
+		return v
+	}
+	return m.vector(doc)
+}
+
+func (m *TFIDFCosine) Distance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	return cosineDistance(m.lookup(a), m.lookup(b))
+}
+
+// Tokens splits s into lower case runs of letters and digits, the same way
+// the token based metrics do.
+func Tokens(s string) []string {
+	return tokens(s)
+}
+
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func tokenSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range tokens(s) {
+		set[t] = true
+	}
+	return set
+}
+
+func ngramCounts(s string, n int) map[string]float64 {
+	counts := map[string]float64{}
+	r := []rune(strings.ToLower(s))
+	if len(r) == 0 {
+		return counts
+	}
+	if len(r) <= n {
+		counts[string(r)]++
+		return counts
+	}
+	for i := 0; i+n <= len(r); i++ {
+		counts[string(r[i:i+n])]++
+	}
+	return counts
+}
+
+func cosineDistance(a, b map[string]float64) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for k, va := range a {
+		na += va * va
+		if vb, ok := b[k]; ok {
+			dot += va * vb
+		}
+	}
+	for _, vb := range b {
+		nb += vb * vb
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	sim := dot / (math.Sqrt(na) * math.Sqrt(nb))
+	return math.Max(0, math.Min(1, 1-sim))
+}
@@ -0,0 +1,117 @@
+package similarity
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMetricDistance(t *testing.T) {
+	tests := []struct {
+		metric string
+		a, b   string
+		want   float64
+	}{
+		{MetricLevenshtein, "kitten", "sitting", 3.0 / 7},
+		{MetricLevenshtein, "héllo", "hello", 1.0 / 5},
+		{MetricLevenshtein, "", "", 0},
+		{MetricLevenshtein, "abc", "", 1},
+		{MetricJaroWinkler, "MARTHA", "MARHTA", 1 - 0.961111111},
+		{MetricJaroWinkler, "DIXON", "DICKSONX", 1 - 0.813333333},
+		// Three characters out of order are one and a half transpositions.
+		{MetricJaroWinkler, "ABCDEF", "BCADEF", 1 - 0.916666667},
+		{MetricJaroWinkler, "abc", "xyz", 1},
+		{MetricJaroWinkler, "abc", "", 1},
+		{MetricJaccard, "failed to read A", "Failed to write a", 1 - 3.0/5},
+		{MetricJaccard, "a, b, c", "c b a", 0},
+		{MetricJaccard, "", "", 0},
+		{MetricNGramCosine, "abcd", "abcd", 0},
+		{MetricNGramCosine, "abcd", "wxyz", 1},
+		{MetricNGramCosine, "abcd", "ABCD", 0},
+		{MetricNGramCosine, "abcd", "abce", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric+" "+tt.a+" "+tt.b, func(t *testing.T) {
+			m, err := NewMetric(tt.metric)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Distance(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+			if got := m.Distance(tt.b, tt.a); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("reversed: got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricProperties(t *testing.T) {
+	corpus := []string{
+		"connection refused to db-1:5432",
+		"connection refused to db-2:5432",
+		"timeout reading order 17 from queue",
+		"Timeout reading order 18 from queue",
+		"invoice not found",
+		"",
+		"ünïcödé message",
+	}
+	for _, name := range Metrics {
+		t.Run(name, func(t *testing.T) {
+			m, err := NewMetric(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Name() != name {
+				t.Errorf("got name %q", m.Name())
+			}
+			if fit, ok := m.(CorpusMetric); ok {
+				fit.Fit(corpus)
+			}
+			for _, a := range corpus {
+				if d := m.Distance(a, a); d != 0 {
+					t.Errorf("%q from itself: got %g, want 0", a, d)
+				}
+				for _, b := range corpus {
+					d := m.Distance(a, b)
+					if d < 0 || d > 1 || math.IsNaN(d) {
+						t.Errorf("%q from %q: got %g, want within [0, 1]", a, b, d)
+					}
+					if r := m.Distance(b, a); math.Abs(r-d) > 1e-12 {
+						t.Errorf("%q from %q: got %g one way and %g the other", a, b, d, r)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTFIDFCosineWeighsRareTokens(t *testing.T) {
+	m := &TFIDFCosine{}
+	m.Fit([]string{
+		"error alpha",
+		"error beta",
+		"error gamma",
+		"error delta",
+		"warning alpha",
+	})
+	// Sharing the rare token alpha counts for more than sharing the common
+	// token error.
+	if rare, common := m.Distance("error alpha", "warning alpha"), m.Distance("error alpha", "error beta"); rare >= common {
+		t.Errorf("got %g sharing a rare token and %g sharing a common one", rare, common)
+	}
+	// Strings outside the corpus are still compared, with unseen tokens
+	// treated as the rarest.
+	if d := m.Distance("error alpha", "error epsilon"); d <= 0 || d >= 1 {
+		t.Errorf("got %g for a string outside the corpus", d)
+	}
+}
+
+func TestNewMetricUnknown(t *testing.T) {
+	if _, err := NewMetric("hamming"); err == nil {
+		t.Error("got no error for an unknown metric")
+	}
+	m, err := NewMetric("")
+	if err != nil || m.Name() != MetricLevenshtein {
+		t.Errorf("got %v, %v for the default metric, want levenshtein", m, err)
+	}
+}
@@ -0,0 +1,318 @@
+package similarity
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+const (
+	DefaultMinHashes = 128
+	DefaultBands     = 32
+	DefaultShingle   = 2
+
+	// lshBucketLimit caps how many members of one bucket are compared with
+	// each other, so a handful of huge buckets cannot turn candidate
+	// generation back into an all-pairs comparison.
+	lshBucketLimit = 500
+)
+
+// LSHOptions configures MinHash signatures and how they are split into
+// bands. Items whose signatures agree on every row of at least one band
+// become candidates, so with r = Hashes/Bands rows per band, pairs above a
+// Jaccard similarity of roughly (1/Bands)^(1/r) are likely to be found.
+type LSHOptions struct {
+	Hashes  int
+	Bands   int
+	Shingle int
+	Seed    int64
+}
+
+func (o *LSHOptions) setDefaults() {
+	if o.Hashes <= 0 {
+		o.Hashes = DefaultMinHashes
+	}
+	if o.Bands <= 0 || o.Bands > o.Hashes {
+		o.Bands = min(DefaultBands, o.Hashes)
+	}
+	o.Hashes -= o.Hashes % o.Bands
+	if o.Shingle <= 0 {
+		o.Shingle = DefaultShingle
+	}
+}
+
+// Match is an indexed item with its estimated Jaccard similarity to a
+// query.
+type Match struct {
+	Index   int
+	Jaccard float64
+}
+
+// CandidatePair is two indexed items which share an LSH bucket, with their
+// estimated Jaccard similarity.
+type CandidatePair struct {
+	A, B    int
+	Jaccard float64
+}
+
+// LSHIndex holds the MinHash signature of every item's shingled, normalised
+// text, bucketed band by band. Items with identical signatures are stored
+// once, so repeats of the same template never crowd a bucket.
+type LSHIndex struct {
+	opts       LSHOptions
+	seeds      []uint64
+	signatures [][]uint64
+	classes    [][]int
+	classOf    []int
+	buckets    []map[uint64][]int
+}
+
+func NewLSHIndex(texts []string, opts LSHOptions) *LSHIndex {
+	opts.setDefaults()
+	x := &LSHIndex{
+		opts:    opts,
+		seeds:   make([]uint64, opts.Hashes),
+		classOf: make([]int, len(texts)),
+		buckets: make([]map[uint64][]int, opts.Bands),
+	}
+	rnd := rand.New(rand.NewSource(opts.Seed))
+	for i := range x.seeds {
+		x.seeds[i] = rnd.Uint64()
+	}
+	for b := range x.buckets {
+		x.buckets[b] = map[uint64][]int{}
+	}
+
+	log.Printf("computing minhash signatures of %d records...", len(texts))
+	signatures := make([][]uint64, len(texts))
+	parallel.Range(len(texts), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			signatures[i] = x.Signature(texts[i])
+		}
+	})
+	seen := map[uint64]int{}
+	for i, sig := range signatures {
+		key := x.bandKey(sig, 0, len(sig))
+		c, ok := seen[key]
+		if !ok {
+			c = len(x.classes)
+			seen[key] = c
+			x.classes = append(x.classes, nil)
+			x.signatures = append(x.signatures, sig)
+			for b := range x.buckets {
+				k := x.band(sig, b)
+				x.buckets[b][k] = append(x.buckets[b][k], c)
+			}
+		}
+		x.classes[c] = append(x.classes[c], i)
+		x.classOf[i] = c
+	}
+	log.Printf("indexed %d distinct signatures...", len(x.classes))
+	return x
+}
+
+// shingles hashes every run of Shingle consecutive tokens of the
+// normalised text. Texts shorter than that are a single shingle.
+func (x *LSHIndex) shingles(text string) []uint64 {
+	t := tokens(Normalise(text))
+	n := x.opts.Shingle
+	if len(t) < n {
+		n = len(t)
+	}
+	out := make([]uint64, 0, len(t)-n+1)
+	for i := 0; i+n <= len(t); i++ {
+		out = append(out, hashString(strings.Join(t[i:i+n], " ")))
+	}
+	return out
+}
+
+// splitmix64 scrambles x so that each seed acts as an independent hash.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Signature is the minimum of each seeded hash over the text's shingles.
+func (x *LSHIndex) Signature(text string) []uint64 {
+	sig := make([]uint64, len(x.seeds))
+	for h := range sig {
+		sig[h] = ^uint64(0)
+	}
+	for _, s := range x.shingles(text) {
+		for h, seed := range x.seeds {
+			if v := splitmix64(s ^ seed); v < sig[h] {
+				sig[h] = v
+			}
+		}
+	}
+	return sig
+}
+
+func (x *LSHIndex) bandKey(sig []uint64, lo, hi int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range sig[lo:hi] {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+func (x *LSHIndex) band(sig []uint64, b int) uint64 {
+	rows := len(sig) / x.opts.Bands
+	return x.bandKey(sig, b*rows, (b+1)*rows)
+}
+
+// estimate is the share of rows on which two signatures agree, an unbiased
+// estimate of the Jaccard similarity of their shingle sets.
+func estimate(a, b []uint64) float64 {
+	agree := 0
+	for h := range a {
+		if a[h] == b[h] {
+			agree++
+		}
+	}
+	return float64(agree) / float64(len(a))
+}
+
+// Len is the number of indexed items.
+func (x *LSHIndex) Len() int {
+	return len(x.classOf)
+}
+
+// Jaccard estimates the Jaccard similarity of indexed items i and j.
+func (x *LSHIndex) Jaccard(i, j int) float64 {
+	return estimate(x.signatures[x.classOf[i]], x.signatures[x.classOf[j]])
+}
+
+// candidates lists the distinct signatures sharing a bucket with sig.
+func (x *LSHIndex) candidates(sig []uint64) []int {
+	seen := map[int]bool{}
+	out := []int{}
+	for b := range x.buckets {
+		members := x.buckets[b][x.band(sig, b)]
+		for _, c := range members[:min(len(members), lshBucketLimit)] {
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// Query returns up to k indexed items most similar to text by estimated
+// Jaccard similarity, among those sharing a bucket with it.
+func (x *LSHIndex) Query(text string, k int) []Match {
+	return x.query(x.Signature(text), k, -1)
+}
+
+// Neighbours returns up to k indexed items most similar to item i by
+// estimated Jaccard similarity, among those sharing a bucket with it.
+func (x *LSHIndex) Neighbours(i, k int) []Match {
+	return x.query(x.signatures[x.classOf[i]], k, i)
+}
+
+func (x *LSHIndex) query(sig []uint64, k, self int) []Match {
+	classes := []Match{}
+	for _, c := range x.candidates(sig) {
+		classes = append(classes, Match{Index: c, Jaccard: estimate(sig, x.signatures[c])})
+	}
+	sort.SliceStable(classes, func(a, b int) bool {
+		return classes[a].Jaccard > classes[b].Jaccard
+	})
+	matches := []Match{}
+	for _, c := range classes {
+		for _, i := range x.classes[c.Index] {
+			if len(matches) == k {
+				return matches
+			}
+			if i != self {
+				matches = append(matches, Match{Index: i, Jaccard: c.Jaccard})
+			}
+		}
+	}
+	return matches
+}
+
+// CandidatePairs lists every pair of distinct signatures sharing a bucket
+// whose estimated Jaccard similarity is at least threshold, each given by
+// the first item with that signature. Items with identical signatures are
+// not paired with each other; Groups gathers them.
+func (x *LSHIndex) CandidatePairs(threshold float64) []CandidatePair {
+	pairs := []CandidatePair{}
+	seen := map[[2]int]bool{}
+	for _, buckets := range x.buckets {
+		for _, members := range buckets {
+			members = members[:min(len(members), lshBucketLimit)]
+			for a, ca := range members {
+				for _, cb := range members[a+1:] {
+					p := [2]int{min(ca, cb), max(ca, cb)}
+					if seen[p] {
+						continue
+					}
+					seen[p] = true
+					if j := estimate(x.signatures[p[0]], x.signatures[p[1]]); j >= threshold {
+						pairs = append(pairs, CandidatePair{A: x.classes[p[0]][0], B: x.classes[p[1]][0], Jaccard: j})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		if pairs[a].Jaccard != pairs[b].Jaccard {
+			return pairs[a].Jaccard > pairs[b].Jaccard
+		}
+		if pairs[a].A != pairs[b].A {
+			return pairs[a].A < pairs[b].A
+		}
+		return pairs[a].B < pairs[b].B
+	})
+	return pairs
+}
+
+// Groups joins items connected by candidate pairs at or above threshold,
+// along with items sharing a signature, and returns each group's items in
+// ascending order, largest group first.
+func (x *LSHIndex) Groups(threshold float64) [][]int {
+	parent := make([]int, len(x.classes))
+	for c := range parent {
+		parent[c] = c
+	}
+	find := func(c int) int {
+		for parent[c] != c {
+			parent[c] = parent[parent[c]]
+			c = parent[c]
+		}
+		return c
+	}
+	for _, p := range x.CandidatePairs(threshold) {
+		a, b := find(x.classOf[p.A]), find(x.classOf[p.B])
+		if a != b {
+			parent[max(a, b)] = min(a, b)
+		}
+	}
+	byRoot := map[int]int{}
+	groups := [][]int{}
+	for i, c := range x.classOf {
+		root := find(c)
+		g, ok := byRoot[root]
+		if !ok {
+			g = len(groups)
+			byRoot[root] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	sort.SliceStable(groups, func(a, b int) bool {
+		return len(groups[a]) > len(groups[b])
+	})
+	return groups
+}
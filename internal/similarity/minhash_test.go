@@ -0,0 +1,142 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Order 12345 not found", "order <num> not found"},
+		{"request 3f2b1c9e-8a7d-4e6f-b5c4-123456789abc failed", "request <uuid> failed"},
+		{"at 2026-01-01T10:00:00.123Z retrying", "at <time> retrying"},
+		{"dial tcp 10.0.12.7:5432: connection refused", "dial tcp <ip>: connection refused"},
+		{"message 0x1f3a9 and deadbeef01 dropped", "message <hex> and <hex> dropped"},
+		{"took 1.5   seconds", "took <num> seconds"},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalise(tt.in); got != tt.want {
+			t.Errorf("Normalise(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMinHashEstimate(t *testing.T) {
+	x := NewLSHIndex(nil, LSHOptions{Hashes: 512, Bands: 64, Shingle: 1, Seed: 1})
+	rnd := rand.New(rand.NewSource(2))
+	words := make([]string, 60)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%c%c", 'a'+rune(i/26), 'a'+rune(i%26))
+	}
+	for trial := 0; trial < 20; trial++ {
+		a := words[:20+rnd.Intn(20)]
+		b := words[rnd.Intn(20) : 20+rnd.Intn(40)]
+		sa, sb := map[uint64]bool{}, map[uint64]bool{}
+		text := func(w []string, set map[uint64]bool) string {
+			s := strings.Join(w, " ")
+			for _, h := range x.shingles(s) {
+				set[h] = true
+			}
+			return s
+		}
+		ta, tb := text(a, sa), text(b, sb)
+		shared := 0
+		for h := range sa {
+			if sb[h] {
+				shared++
+			}
+		}
+		want := float64(shared) / float64(len(sa)+len(sb)-shared)
+		if got := estimate(x.Signature(ta), x.Signature(tb)); math.Abs(got-want) > 0.1 {
+			t.Errorf("trial %d: got estimate %.3f, want %.3f", trial, got, want)
+		}
+	}
+}
+
+func TestLSHIndex(t *testing.T) {
+	texts := []string{
+		"failed to delete message 8812 from queue bms-inbound-3",
+		"failed to delete message 9120 from queue bms-inbound-7",
+		"received BESS failure response with status 502 for correlation 3f2b1c9e-8a7d-4e6f-b5c4-123456789abc",
+		"received BESS failure response with status 503 for correlation 00000000-8a7d-4e6f-b5c4-123456789abc",
+		"validation failed: field 'name' is required when the request is submitted by the portal",
+		"validation failed: field 'email' is required when the request is submitted by the portal",
+		"unexpected error: runtime error: index out of range",
+	}
+	x := NewLSHIndex(texts, LSHOptions{Seed: 1})
+	if x.Len() != len(texts) {
+		t.Fatalf("got %d indexed items, want %d", x.Len(), len(texts))
+	}
+	// Identifiers are normalised away, so these are the same template.
+	for _, pair := range [][2]int{{0, 1}, {2, 3}} {
+		if j := x.Jaccard(pair[0], pair[1]); j != 1 {
+			t.Errorf("items %d and %d: got jaccard %g, want 1", pair[0], pair[1], j)
+		}
+	}
+	if j := x.Jaccard(0, 6); j > 0.2 {
+		t.Errorf("unrelated items: got jaccard %g", j)
+	}
+
+	groups := x.Groups(0.6)
+	want := [][]int{{0, 1}, {2, 3}, {4, 5}, {6}}
+	if len(groups) != len(want) {
+		t.Fatalf("got groups %v, want %v", groups, want)
+	}
+	for _, g := range want {
+		if !slices.ContainsFunc(groups, func(h []int) bool { return slices.Equal(g, h) }) {
+			t.Errorf("got groups %v, want %v", groups, want)
+		}
+	}
+
+	// Pairs of distinct signatures only: the validation messages differ in
+	// a field name.
+	pairs := x.CandidatePairs(0.6)
+	if len(pairs) != 1 || pairs[0].A != 4 || pairs[0].B != 5 || pairs[0].Jaccard < 0.6 || pairs[0].Jaccard >= 1 {
+		t.Errorf("got candidate pairs %+v, want 4 and 5 alone", pairs)
+	}
+
+	matches := x.Query("failed to delete message 1 from queue bms-inbound-1", 3)
+	if len(matches) < 2 || matches[0].Jaccard != 1 || matches[1].Jaccard != 1 || !slices.Contains([]int{0, 1}, matches[0].Index) {
+		t.Errorf("got matches %+v, want items 0 and 1 first", matches)
+	}
+	for _, m := range x.Neighbours(0, 5) {
+		if m.Index == 0 {
+			t.Error("item 0 is its own neighbour")
+		}
+	}
+	if n := x.Neighbours(0, 1); len(n) != 1 || n[0].Index != 1 {
+		t.Errorf("got neighbours %+v of item 0, want item 1", n)
+	}
+
+	again := NewLSHIndex(texts, LSHOptions{Seed: 1})
+	for i := range texts {
+		if !slices.Equal(x.Signature(texts[i]), again.Signature(texts[i])) {
+			t.Errorf("item %d: got different signatures with the same seed", i)
+		}
+	}
+}
+
+func TestLSHOptionsDefaults(t *testing.T) {
+	tests := []struct {
+		in, want LSHOptions
+	}{
+		{LSHOptions{}, LSHOptions{Hashes: DefaultMinHashes, Bands: DefaultBands, Shingle: DefaultShingle}},
+		// Hashes are trimmed to a whole number of rows per band.
+		{LSHOptions{Hashes: 100, Bands: 32, Shingle: 3}, LSHOptions{Hashes: 96, Bands: 32, Shingle: 3}},
+		{LSHOptions{Hashes: 16, Bands: 64}, LSHOptions{Hashes: 16, Bands: 16, Shingle: DefaultShingle}},
+	}
+	for _, tt := range tests {
+		got := tt.in
+		got.setDefaults()
+		if got != tt.want {
+			t.Errorf("%+v: got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
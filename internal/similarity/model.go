@@ -0,0 +1,310 @@
+package similarity
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Placement is how a saved model places new items into its embedding.
+// MDS embeddings triangulate against landmark distances, while nonlinear
+// embeddings interpolate between the nearest reference items.
+const (
+	PlacementTriangulation = "triangulation"
+	PlacementNeighbours    = "neighbours"
+
+	// modelNeighbourLimit caps the reference items a neighbour model keeps,
+	// and so the comparisons needed to place each new item.
+	modelNeighbourLimit = 5000
+)
+
+// MetricFit is the fitted state of a corpus metric.
+type MetricFit struct {
+	IDF  map[string]float64 `json:"idf"`
+	Docs int                `json:"docs"`
+}
+
+// Reference is an item of the original dataset and where it was embedded.
+type Reference struct {
+	Text       string     `json:"text"`
+	Features   []Feature  `json:"features,omitempty"`
+	Coordinate Coordinate `json:"coordinate"`
+}
+
+// Model holds everything needed to place new items into a saved embedding
+// without recomputing it: how distances were measured, the reference items
+// and, for triangulation, the pseudo-inverse of their centred coordinates.
+// References are kept as embedded, before any alignment to a reference run,
+// and Alignment carries placed items over to the aligned coordinates.
+type Model struct {
+	Metric     string        `json:"metric"`
+	Fit        *MetricFit    `json:"fit,omitempty"`
+	Features   []string      `json:"features,omitempty"`
+	Weights    []float64     `json:"weights,omitempty"`
+	Kinds      []FeatureKind `json:"kinds,omitempty"`
+	Scales     []float64     `json:"scales,omitempty"`
+	Projection Projection    `json:"projection"`
+	Placement  string        `json:"placement"`
+	References []Reference   `json:"references"`
+	Centre     Coordinate    `json:"centre,omitempty"`
+	Inverse    [][]float64   `json:"inverse,omitempty"`
+	Norms      []float64     `json:"norms,omitempty"`
+	Neighbours int           `json:"neighbours,omitempty"`
+	Alignment  *Alignment    `json:"alignment,omitempty"`
+}
+
+// Model saves the embedding of the space so later items can be placed into
+// it, and so must run before the space is aligned. MDS embeddings keep as
+// many reference items as landmarks to triangulate against; nonlinear
+// embeddings keep up to modelNeighbourLimit.
+func (s *Space) Model() (*Model, error) {
+	if s.embedding == nil {
+		return nil, fmt.Errorf("space has not been embedded")
+	}
+	n := s.Len()
+	m := &Model{
+		Metric:     s.d.metric.Name(),
+		Features:   s.d.names,
+		Weights:    s.d.weights,
+		Kinds:      s.d.kinds,
+		Scales:     s.d.scales,
+		Projection: *s.projection,
+	}
+	if t, ok := s.d.metric.(*TFIDFCosine); ok {
+		m.Fit = &MetricFit{IDF: t.idf, Docs: t.docs}
+	}
+
+	// References are spread evenly over the unique items rather than
+	// chosen by MaxMin, which favours outliers and so describes the bulk
+	// of the embedding poorly.
+	k := min(n, modelNeighbourLimit)
+	switch s.projection.Method {
+	case ProjectionClassicalMDS, ProjectionLandmarkMDS:
+		m.Placement = PlacementTriangulation
+		k = min(n, s.opts.Landmarks)
+	default:
+		m.Placement = PlacementNeighbours
+		m.Neighbours = s.opts.Neighbours
+	}
+	refs := make([]int, k)
+	for i := range refs {
+		refs[i] = i * n / k
+	}
+	for _, i := range refs {
+		r := Reference{
+			Text:       s.d.texts[i],
+			Coordinate: mat.Row(nil, i, s.embedding),
+		}
+		if s.d.features != nil {
+			r.Features = s.d.features[i]
+		}
+		m.References = append(m.References, r)
+	}
+	if m.Placement == PlacementTriangulation {
+		if err := m.fitTriangulation(s.d.subset(refs)); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// fitTriangulation prepares distance-based triangulation (de Silva &
+// Tenenbaum, 2004) against the references. A new item at squared distances
+// δ from them is placed at centre - ½·C⁺(δ - μ), where C holds the centred
+// reference coordinates and μ the mean squared distance from each
+// reference to the others. μ comes from the metric rather than the
+// embedding, so the variance the embedding leaves out cancels.
+func (m *Model) fitTriangulation(d *distancer) error {
+	k := len(m.References)
+	dims := m.Projection.Dims
+	if k <= dims {
+		return fmt.Errorf("need more than %d references to triangulate, got %d", dims, k)
+	}
+	m.Centre = make(Coordinate, dims)
+	for _, r := range m.References {
+		for a := range m.Centre {
+			m.Centre[a] += r.Coordinate[a] / float64(k)
+		}
+	}
+	c := mat.NewDense(k, dims, nil)
+	for i, r := range m.References {
+		for a := 0; a < dims; a++ {
+			c.Set(i, a, r.Coordinate[a]-m.Centre[a])
+		}
+	}
+	m.Norms = make([]float64, k)
+	parallel.Range(k, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			for j := 0; j < k; j++ {
+				v := d.distance(i, j)
+				m.Norms[i] += v * v / float64(k)
+			}
+		}
+	})
+
+	var svd mat.SVD
+	if ok := svd.Factorize(c, mat.SVDThin); !ok {
+		return fmt.Errorf("singular value decomposition failed")
+	}
+	values := svd.Values(nil)
+	var u, v mat.Dense
+	svd.UTo(&u)
+	svd.VTo(&v)
+	m.Inverse = make([][]float64, dims)
+	for a := range m.Inverse {
+		m.Inverse[a] = make([]float64, k)
+		for s, sigma := range values {
+			// As with landmark MDS, axes without spread are left at zero.
+			if sigma <= 1e-10*values[0] {
+				continue
+			}
+			for i := 0; i < k; i++ {
+				m.Inverse[a][i] += v.At(a, s) * u.At(i, s) / sigma
+			}
+		}
+	}
+	return nil
+}
+
+// distancer rebuilds the reference items measured exactly as they were
+// when the model was saved.
+func (m *Model) distancer() (*distancer, error) {
+	metric, err := NewMetric(m.Metric)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := metric.(*TFIDFCosine); ok && m.Fit != nil {
+		t.idf = m.Fit.IDF
+		t.docs = m.Fit.Docs
+	}
+	d := &distancer{
+		metric:  metric,
+		texts:   make([]string, len(m.References)),
+		names:   m.Features,
+		weights: m.Weights,
+		kinds:   m.Kinds,
+		scales:  m.Scales,
+	}
+	for i, r := range m.References {
+		d.texts[i] = r.Text
+	}
+	if len(m.Features) > 0 {
+		d.features = make([][]Feature, len(m.References))
+		for i, r := range m.References {
+			d.features[i] = r.Features
+		}
+	}
+	return d, nil
+}
+
+// Place embeds new items into the saved embedding.
+func (m *Model) Place(c []Comparable) (*mat.Dense, error) {
+	ref, err := m.distancer()
+	if err != nil {
+		return nil, err
+	}
+	d, err := ref.extend(c)
+	if err != nil {
+		return nil, err
+	}
+	k := len(m.References)
+	if len(c) == 0 {
+		return &mat.Dense{}, nil
+	}
+	coords := mat.NewDense(len(c), m.Projection.Dims, nil)
+	if k == 0 {
+		return coords, nil
+	}
+
+	log.Printf("placing %d records against %d references by %s...", len(c), k, m.Placement)
+	parallel.Range(len(c), func(lo, hi int) {
+		dist := make([]float64, k)
+		for i := lo; i < hi; i++ {
+			for j := range dist {
+				dist[j] = d.distance(k+i, j)
+			}
+			switch m.Placement {
+			case PlacementTriangulation:
+				m.triangulate(dist, coords.RawRowView(i))
+			default:
+				m.interpolate(dist, coords.RawRowView(i))
+			}
+			if m.Alignment != nil {
+				m.Alignment.Apply(coords.RawRowView(i))
+			}
+		}
+	})
+	return coords, nil
+}
+
+func (m *Model) triangulate(dist, x []float64) {
+	for a := range x {
+		var sum float64
+		for j, v := range dist {
+			sum += m.Inverse[a][j] * (v*v - m.Norms[j])
+		}
+		x[a] = m.Centre[a] - 0.5*sum
+	}
+}
+
+// interpolate averages the coordinates of the nearest references, weighted
+// by inverse distance, landing exactly on any reference at distance zero.
+func (m *Model) interpolate(dist, x []float64) {
+	order := make([]int, len(dist))
+	for j := range order {
+		order[j] = j
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return dist[order[a]] < dist[order[b]]
+	})
+	clear(x)
+	if dist[order[0]] == 0 {
+		copy(x, m.References[order[0]].Coordinate)
+		return
+	}
+	var total float64
+	for _, j := range order[:min(max(m.Neighbours, 1), len(order))] {
+		w := 1 / dist[j]
+		total += w
+		for a := range x {
+			x[a] += w * m.References[j].Coordinate[a]
+		}
+	}
+	for a := range x {
+		x[a] /= total
+	}
+}
+
+// Project places the unique items of the space into a saved embedding
+// instead of computing a new one, and returns the coordinates of every item
+// in input order.
+func (s *Space) Project(m *Model) ([]Coordinate, *Projection, error) {
+	items := make([]Comparable, s.Len())
+	for i, u := range s.unique {
+		items[i] = s.items[u]
+	}
+	if len(items) == 0 {
+		return []Coordinate{}, &m.Projection, nil
+	}
+	coords, err := m.Place(items)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to place records: %s", err)
+	}
+	proj := m.Projection
+	proj.EstimatedBytes = 0
+	proj.Parameters = map[string]float64{}
+	for k, v := range m.Projection.Parameters {
+		proj.Parameters[k] = v
+	}
+	proj.Parameters["references"] = float64(len(m.References))
+	if m.Alignment != nil {
+		proj.Alignment = m.Alignment
+	}
+	if m.Projection.Diagnostics != nil {
+		proj.Diagnostics = &Diagnostics{NegativeMass: m.Projection.Diagnostics.NegativeMass}
+	}
+	return s.finish(coords, proj)
+}
@@ -0,0 +1,231 @@
+package similarity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestModelPlacesAlignedReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"mds", Options{Metric: &Levenshtein{}, Projection: ProjectionMDS}},
+		{"tsne", Options{Metric: &Levenshtein{}, Projection: ProjectionTSNE, Perplexity: 5, Iterations: 100}},
+		{"umap", Options{Metric: &Levenshtein{}, Projection: ProjectionUMAP, Neighbours: 5, Epochs: 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpace(generate(40), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			coords, _, err := s.Embed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := s.Model()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Align to a rotated, scaled and shifted copy, so the aligned
+			// coordinates are far from those the model was fitted to.
+			sin, cos := math.Sincos(1)
+			reference := make([]Coordinate, len(coords))
+			for i, c := range coords {
+				reference[i] = Coordinate{
+					5*(c[0]*cos-c[1]*sin) + 10,
+					5*(c[0]*sin+c[1]*cos) - 3,
+				}
+			}
+			a, err := Align(coords, reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Align(a, coords)
+			m.Alignment = a
+
+			saved, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Model
+			if err := json.Unmarshal(saved, &loaded); err != nil {
+				t.Fatal(err)
+			}
+			items := make([]Comparable, s.Len())
+			for u := range items {
+				items[u] = s.items[s.Item(u)]
+			}
+			placed, err := loaded.Place(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for u, want := range s.Embedding() {
+				for a := range want {
+					if got := placed.At(u, a); math.Abs(got-want[a]) > 1e-6*math.Max(1, math.Abs(want[a])) {
+						t.Fatalf("reference %d: got %v, want %v", u, placed.RawRowView(u), want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestModelPlacesNewItems(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	point := func() (message, [2]float64) {
+		p := [2]float64{rnd.NormFloat64() * 5, rnd.NormFloat64() * 2}
+		return message(fmt.Sprintf("%g %g", p[0], p[1])), p
+	}
+	items := make([]Comparable, 60)
+	points := make([][2]float64, len(items))
+	for i := range items {
+		items[i], points[i] = point()
+	}
+	fresh := make([]message, 10)
+	truth := make([][2]float64, len(fresh))
+	for i := range fresh {
+		fresh[i], truth[i] = point()
+	}
+	tests := []struct {
+		name      string
+		opts      Options
+		placement string
+	}{
+		{"classical", Options{Metric: planar{}, Projection: ProjectionMDS, Landmarks: 20}, PlacementTriangulation},
+		{"landmark", Options{Metric: planar{}, Projection: ProjectionMDS, Landmarks: 20, ClassicalLimit: 30}, PlacementTriangulation},
+		{"umap", Options{Metric: planar{}, Projection: ProjectionUMAP, Neighbours: 5, Epochs: 50}, PlacementNeighbours},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpace(items, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := s.Embed(); err != nil {
+				t.Fatal(err)
+			}
+			m, err := s.Model()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Placement != tt.placement {
+				t.Fatalf("got placement %s, want %s", m.Placement, tt.placement)
+			}
+			embedded := s.Embedding()
+			// The planar metric is not one a saved model can rebuild, so
+			// items are placed from their distances to the references.
+			place := func(text string) []float64 {
+				dist := make([]float64, len(m.References))
+				for j, r := range m.References {
+					dist[j] = planar{}.Distance(text, r.Text)
+				}
+				x := make([]float64, m.Projection.Dims)
+				if m.Placement == PlacementTriangulation {
+					m.triangulate(dist, x)
+				} else {
+					m.interpolate(dist, x)
+				}
+				return x
+			}
+
+			// A copy of an item lands on it, every item being a reference of
+			// a neighbour model this small.
+			for i := range items {
+				got, want := place(items[i].Metric()), embedded[s.UniqueOf(i)]
+				for a := range want {
+					if math.Abs(got[a]-want[a]) > 1e-6*math.Max(1, math.Abs(want[a])) {
+						t.Fatalf("copy of item %d: got %v, want %v", i, got, want)
+					}
+				}
+			}
+
+			if tt.placement != PlacementTriangulation {
+				return
+			}
+			// The points are planar, so MDS recovers them up to rotation and
+			// triangulation places new points exactly.
+			for i := range fresh {
+				x := place(string(fresh[i]))
+				for j, p := range points {
+					want := math.Hypot(truth[i][0]-p[0], truth[i][1]-p[1])
+					c := embedded[s.UniqueOf(j)]
+					if got := math.Hypot(x[0]-c[0], x[1]-c[1]); math.Abs(got-want) > 1e-6*math.Max(1, want) {
+						t.Fatalf("new point %d: got distance %g to item %d, want %g", i, got, j, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestModelPlacesNothing(t *testing.T) {
+	s, err := NewSpace(generate(20), Options{Metric: &Levenshtein{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Embed(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	placed, err := m.Place(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := placed.Dims(); rows != 0 {
+		t.Errorf("got %d rows for no items", rows)
+	}
+}
+
+func TestProjectIntoModel(t *testing.T) {
+	items := generate(40)
+	s, err := NewSpace(items, Options{Metric: &Levenshtein{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	coords, _, err := s.Embed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same items projected into the model land where they were.
+	again, err := NewSpace(items, Options{Metric: &Levenshtein{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected, proj, err := again.Project(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projected) != len(items) {
+		t.Fatalf("got %d coordinates, want %d", len(projected), len(items))
+	}
+	for i := range items {
+		for a := range coords[i] {
+			if math.Abs(projected[i][a]-coords[i][a]) > 1e-6*math.Max(1, math.Abs(coords[i][a])) {
+				t.Fatalf("item %d: got %v, want %v", i, projected[i], coords[i])
+			}
+		}
+	}
+	if proj.Method != m.Projection.Method || proj.Parameters["references"] != float64(len(m.References)) {
+		t.Errorf("got projection %+v", proj)
+	}
+	if proj.EstimatedBytes != 0 {
+		t.Errorf("got estimate of %d bytes for placed items, which run no MDS", proj.EstimatedBytes)
+	}
+	if _, ok := m.Projection.Parameters["references"]; ok {
+		t.Error("projecting changed the model's parameters")
+	}
+}
@@ -0,0 +1,29 @@
+package similarity
+
+import (
+	"regexp"
+	"strings"
+)
+
+var normalisers = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[t ]\d{2}:\d{2}:\d{2}(\.\d+)?(z|[+-]\d{2}:?\d{2})?\b`), "<time>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b(0x)?[0-9a-f]*\d[0-9a-f]*[a-f][0-9a-f]*\b|\b(0x)?[0-9a-f]*[a-f][0-9a-f]*\d[0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<num>"},
+}
+
+// Normalise reduces a message to its template by lower casing it,
+// replacing the parts which vary between occurrences of the same error,
+// such as identifiers, timestamps, addresses and numbers, with placeholders
+// and collapsing whitespace.
+func Normalise(s string) string {
+	s = strings.ToLower(s)
+	for _, n := range normalisers {
+		s = n.pattern.ReplaceAllString(s, n.placeholder)
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
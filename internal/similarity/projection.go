@@ -0,0 +1,83 @@
+package similarity
+
+import "encoding/json"
+
+// Coordinate is a position along each axis of the embedding.
+type Coordinate []float64
+
+// UnmarshalJSON also reads the X/Y objects of files written before
+// coordinates could have any number of dimensions.
+func (c *Coordinate) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var legacy struct{ X, Y float64 }
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		*c = Coordinate{legacy.X, legacy.Y}
+		return nil
+	}
+	var values []float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*c = values
+	return nil
+}
+
+const (
+	ProjectionMDS  = "mds"
+	ProjectionTSNE = "tsne"
+	ProjectionUMAP = "umap"
+
+	ProjectionClassicalMDS  = "classical-mds"
+	ProjectionLandmarkMDS   = "landmark-mds"
+	ProjectionBarnesHutTSNE = "barnes-hut-tsne"
+)
+
+var Projections = []string{
+	ProjectionMDS,
+	ProjectionTSNE,
+	ProjectionUMAP,
+}
+
+// Projection records how a set of coordinates was produced, and the share
+// of the variance each of its axes explains. EstimatedBytes is the most
+// memory classical MDS held at once in its distance matrix and eigensolver,
+// counted from their sizes rather than measured.
+type Projection struct {
+	Method            string             `json:"method"`
+	Parameters        map[string]float64 `json:"parameters,omitempty"`
+	Dims              int                `json:"dims"`
+	VarianceExplained []float64          `json:"varianceExplained"`
+	EstimatedBytes    int                `json:"estimatedBytes,omitempty"`
+	Alignment         *Alignment         `json:"alignment,omitempty"`
+	Diagnostics       *Diagnostics       `json:"diagnostics,omitempty"`
+}
+
+// Alignment is the similarity transform x·s·R + t which best matches a set
+// of coordinates to a reference run over the items they share. Residual is
+// the root mean square distance left between shared items, and Disparity
+// the share of the reference's spread it amounts to.
+type Alignment struct {
+	Rotation    [][]float64 `json:"rotation"`
+	Scale       float64     `json:"scale"`
+	Translation Coordinate  `json:"translation"`
+	Shared      int         `json:"shared"`
+	Residual    float64     `json:"residual"`
+	Disparity   float64     `json:"disparity"`
+}
+
+// Diagnostics measure how much structure the embedding keeps. Stress is
+// the scale invariant Kruskal stress-1 between original and embedded
+// distances, and Trustworthiness and Continuity how well neighbourhoods of
+// the given number of neighbours survive, all over a sample of unique
+// items. NegativeMass is the share of eigenvalue mass that is negative,
+// which is zero for Euclidean distances and only known for mds.
+type Diagnostics struct {
+	Stress          float64 `json:"stress"`
+	Trustworthiness float64 `json:"trustworthiness"`
+	Continuity      float64 `json:"continuity"`
+	Neighbours      int     `json:"neighbours"`
+	Sample          int     `json:"sample"`
+	NegativeMass    float64 `json:"negativeMass"`
+}
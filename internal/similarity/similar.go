@@ -0,0 +1,71 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+// Similar is a unique item and its distance to a query.
+type Similar struct {
+	Unique   int
+	Distance float64
+}
+
+// Similar compares the query with every unique item of the space under its
+// metric, weights and scales, and returns the k closest, nearest first.
+func (s *Space) Similar(query Comparable, k int) ([]Similar, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("number of similar items must be at least 1, got %d", k)
+	}
+	d, err := s.d.extend([]Comparable{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %s", err)
+	}
+	q := s.Len()
+	out := make([]Similar, s.Len())
+	parallel.Range(s.Len(), func(lo, hi int) {
+		for u := lo; u < hi; u++ {
+			out[u] = Similar{Unique: u, Distance: d.distance(q, u)}
+		}
+	})
+	sort.SliceStable(out, func(a, b int) bool {
+		return out[a].Distance < out[b].Distance
+	})
+	return out[:min(k, len(out))], nil
+}
+
+// Nearest finds the closest unique item of the space to each of the given
+// items, comparing it with every one of them.
+func (s *Space) Nearest(c []Comparable) ([]Similar, error) {
+	d, err := s.d.extend(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare items: %s", err)
+	}
+	n := s.Len()
+	out := make([]Similar, len(c))
+	parallel.Range(len(c), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			out[i] = Similar{Unique: -1, Distance: math.Inf(1)}
+			for u := 0; u < n && out[i].Distance > 0; u++ {
+				if dist := d.distance(n+i, u); dist < out[i].Distance {
+					out[i] = Similar{Unique: u, Distance: dist}
+				}
+			}
+		}
+	})
+	return out, nil
+}
+
+// Members lists every item unique item u stands for, in input order.
+func (s *Space) Members(u int) []int {
+	members := []int{}
+	for i, v := range s.inverse {
+		if v == u {
+			members = append(members, i)
+		}
+	}
+	return members
+}
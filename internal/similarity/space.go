@@ -0,0 +1,244 @@
+package similarity
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Space holds the unique items of a dataset, how many copies of each there
+// are and the distances between them. Everything downstream of the
+// similarity metric works on unique items and fans back out to every item.
+// MDS and clustering weigh each unique item by its copies, while t-SNE and
+// UMAP place each once however many copies it has.
+type Space struct {
+	opts       Options
+	items      []Comparable
+	d          *distancer
+	unique     []int
+	inverse    []int
+	counts     []float64
+	embedding  *mat.Dense
+	projection *Projection
+	distances  *SymMatrix
+
+	// lsh indexes the exactly unique items before any near duplicates were
+	// collapsed, with lshOf mapping each item to its entry and lshItems each
+	// entry to its first item.
+	lsh      *LSHIndex
+	lshOf    []int
+	lshItems []int
+}
+
+func NewSpace(c []Comparable, opts Options) (*Space, error) {
+	opts.setDefaults()
+	dc, err := newDistancer(c, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare distances: %s", err)
+	}
+	unique, inverse, counts := dedupe(dc, len(c))
+	log.Printf("collapsed %d records into %d unique records...", len(c), len(unique))
+	s := &Space{
+		opts:    opts,
+		items:   c,
+		unique:  unique,
+		inverse: inverse,
+		counts:  counts,
+	}
+	if opts.LSH != nil {
+		keys := make([]string, len(unique))
+		for u, i := range unique {
+			keys[u] = dc.key(i)
+		}
+		s.lsh = NewLSHIndex(keys, *opts.LSH)
+		s.lshOf = inverse
+		s.lshItems = unique
+		if opts.NearDuplicates > 0 {
+			s.collapse(s.lsh.Groups(opts.NearDuplicates))
+			log.Printf("collapsed near duplicates into %d unique records...", len(s.unique))
+		}
+	}
+	s.d = dc.subset(s.unique)
+	return s, nil
+}
+
+// collapse merges each group of unique items into one, which stands for
+// all of their items and keeps the most common of them as its own.
+func (s *Space) collapse(groups [][]int) {
+	unique := make([]int, len(groups))
+	counts := make([]float64, len(groups))
+	merged := make([]int, len(s.unique))
+	for g, members := range groups {
+		best := members[0]
+		for _, u := range members {
+			merged[u] = g
+			counts[g] += s.counts[u]
+			if s.counts[u] > s.counts[best] {
+				best = u
+			}
+		}
+		unique[g] = s.unique[best]
+	}
+	inverse := make([]int, len(s.inverse))
+	for i, u := range s.inverse {
+		inverse[i] = merged[u]
+	}
+	s.unique, s.inverse, s.counts = unique, inverse, counts
+}
+
+// NearDuplicates groups the items whose MinHash signatures make them near
+// duplicates at the given estimated Jaccard similarity, and lists candidate
+// pairs of distinct items at or above it. It needs Options.LSH.
+func (s *Space) NearDuplicates(threshold float64) ([][]int, []CandidatePair) {
+	if s.lsh == nil {
+		return nil, nil
+	}
+	entries := make([][]int, s.lsh.Len())
+	for i, e := range s.lshOf {
+		entries[e] = append(entries[e], i)
+	}
+	groups := [][]int{}
+	for _, g := range s.lsh.Groups(threshold) {
+		items := []int{}
+		for _, e := range g {
+			items = append(items, entries[e]...)
+		}
+		slices.Sort(items)
+		groups = append(groups, items)
+	}
+	slices.SortStableFunc(groups, func(a, b []int) int {
+		return len(b) - len(a)
+	})
+	pairs := s.lsh.CandidatePairs(threshold)
+	for p := range pairs {
+		pairs[p].A = s.lshItems[pairs[p].A]
+		pairs[p].B = s.lshItems[pairs[p].B]
+	}
+	return groups, pairs
+}
+
+// lshNeighbours proposes up to k neighbours of each unique item from the
+// LSH index, or nil without one.
+func (s *Space) lshNeighbours(k int) [][]int {
+	if s.lsh == nil {
+		return nil
+	}
+	out := make([][]int, s.Len())
+	parallel.Range(s.Len(), func(lo, hi int) {
+		for u := lo; u < hi; u++ {
+			for _, m := range s.lsh.Neighbours(s.lshOf[s.unique[u]], 2*k) {
+				v := s.inverse[s.lshItems[m.Index]]
+				if v != u && !slices.Contains(out[u], v) {
+					out[u] = append(out[u], v)
+				}
+				if len(out[u]) == k {
+					break
+				}
+			}
+		}
+	})
+	return out
+}
+
+// Len is the number of unique items.
+func (s *Space) Len() int {
+	return len(s.unique)
+}
+
+// Distance is the distance between unique items i and j.
+func (s *Space) Distance(i, j int) float64 {
+	return s.d.distance(i, j)
+}
+
+// Weight is the number of items unique item i stands for.
+func (s *Space) Weight(i int) float64 {
+	return s.counts[i]
+}
+
+// Item is the index of the first item unique item i stands for.
+func (s *Space) Item(i int) int {
+	return s.unique[i]
+}
+
+// UniqueOf is the unique item which stands for the given item.
+func (s *Space) UniqueOf(item int) int {
+	return s.inverse[item]
+}
+
+func (s *Space) Metric() Metric {
+	return s.d.metric
+}
+
+// Embedding returns the coordinates of each unique item once Embed has run.
+func (s *Space) Embedding() []Coordinate {
+	if s.embedding == nil {
+		return nil
+	}
+	return formatCoordinates(s.embedding)
+}
+
+// Embed projects the unique items and returns the coordinates of every item
+// in input order.
+func (s *Space) Embed() ([]Coordinate, *Projection, error) {
+	opts := s.opts
+	if len(s.inverse) == 0 {
+		return []Coordinate{}, &Projection{Method: opts.Projection, Dims: opts.Dims}, nil
+	}
+
+	var coords *mat.Dense
+	var distances *SymMatrix
+	var proj Projection
+	var err error
+	switch opts.Projection {
+	case ProjectionMDS, "":
+		if coords, distances, proj, err = embedMDS(s.d, s.counts, opts); err != nil {
+			return nil, nil, fmt.Errorf("failed to compute mds: %s", err)
+		}
+	case ProjectionTSNE:
+		coords, distances, proj = embedTSNE(s.d, s.Len(), opts, s.lshNeighbours(tsneNeighbours(opts.Perplexity)))
+	case ProjectionUMAP:
+		coords, proj = embedUMAP(s.d, s.Len(), opts, s.lshNeighbours(opts.Neighbours))
+	default:
+		return nil, nil, fmt.Errorf("unknown projection '%s', expected one of %s", opts.Projection, strings.Join(Projections, ", "))
+	}
+	if opts.KeepDistances {
+		s.distances = distances
+	}
+	proj.Dims = opts.Dims
+	if opts.Jitter > 0 {
+		if proj.Parameters == nil {
+			proj.Parameters = map[string]float64{}
+		}
+		proj.Parameters["jitter"] = opts.Jitter
+	}
+	return s.finish(coords, proj)
+}
+
+// finish diagnoses and keeps the embedding of the unique items and fans it
+// out to every item.
+func (s *Space) finish(coords *mat.Dense, proj Projection) ([]Coordinate, *Projection, error) {
+	if proj.Diagnostics == nil {
+		proj.Diagnostics = &Diagnostics{}
+	}
+	s.diagnose(coords, proj.Diagnostics)
+	s.embedding = coords
+	s.projection = &proj
+	out := fanOut(coords, s.inverse, s.counts, s.opts.Jitter, s.opts.Seed)
+	log.Printf("formatting coodinates...")
+	return formatCoordinates(out), &proj, nil
+}
+
+// DistanceMatrix computes the distance between every pair of unique items,
+// or hands over the matrix Embed kept, the first time it is called, rather
+// than computing it again. Callers may change it.
+func (s *Space) DistanceMatrix() *SymMatrix {
+	if d := s.distances; d != nil {
+		s.distances = nil
+		return d
+	}
+	return computeDistanceMatrix(s.Len(), s.d)
+}
@@ -0,0 +1,141 @@
+package similarity
+
+import "math"
+
+// spTree is the space-partitioning tree Barnes-Hut t-SNE uses to summarise
+// distant groups of points by their centre of mass. Each node splits its
+// cell into 2^dims children, so it is a quadtree in 2D and an octree in 3D.
+type spTree struct {
+	dims     int
+	centre   []float64
+	half     float64
+	mass     []float64
+	count    int
+	point    int
+	children []*spTree
+}
+
+// minCellHalf stops identical points from splitting the tree forever; they
+// simply share a leaf.
+const minCellHalf = 1e-9
+
+func newSPTree(y []float64, n, dims int) *spTree {
+	lo := make([]float64, dims)
+	hi := make([]float64, dims)
+	for a := 0; a < dims; a++ {
+		lo[a] = math.Inf(1)
+		hi[a] = math.Inf(-1)
+	}
+	for i := 0; i < n; i++ {
+		for a := 0; a < dims; a++ {
+			lo[a] = math.Min(lo[a], y[i*dims+a])
+			hi[a] = math.Max(hi[a], y[i*dims+a])
+		}
+	}
+	centre := make([]float64, dims)
+	var half float64
+	for a := 0; a < dims; a++ {
+		centre[a] = (lo[a] + hi[a]) / 2
+		half = math.Max(half, (hi[a]-lo[a])/2)
+	}
+	t := &spTree{
+		dims:   dims,
+		centre: centre,
+		half:   half*(1+1e-6) + minCellHalf,
+		mass:   make([]float64, dims),
+		point:  -1,
+	}
+	for i := 0; i < n; i++ {
+		t.insert(y, i)
+	}
+	return t
+}
+
+func (t *spTree) insert(y []float64, i int) {
+	p := y[i*t.dims : (i+1)*t.dims]
+	for a := range t.mass {
+		t.mass[a] = (t.mass[a]*float64(t.count) + p[a]) / float64(t.count+1)
+	}
+	t.count++
+
+	if t.children == nil {
+		if t.count == 1 {
+			t.point = i
+			return
+		}
+		if t.half < minCellHalf {
+			return
+		}
+		t.children = make([]*spTree, 1<<t.dims)
+		if t.point >= 0 {
+			prev := t.point
+			t.point = -1
+			t.child(y, prev).insert(y, prev)
+		}
+	}
+	t.child(y, i).insert(y, i)
+}
+
+func (t *spTree) child(y []float64, i int) *spTree {
+	p := y[i*t.dims : (i+1)*t.dims]
+	idx := 0
+	for a := 0; a < t.dims; a++ {
+		if p[a] > t.centre[a] {
+			idx |= 1 << a
+		}
+	}
+	if t.children[idx] == nil {
+		half := t.half / 2
+		centre := make([]float64, t.dims)
+		for a := 0; a < t.dims; a++ {
+			if idx&(1<<a) != 0 {
+				centre[a] = t.centre[a] + half
+			} else {
+				centre[a] = t.centre[a] - half
+			}
+		}
+		t.children[idx] = &spTree{
+			dims:   t.dims,
+			centre: centre,
+			half:   half,
+			mass:   make([]float64, t.dims),
+			point:  -1,
+		}
+	}
+	return t.children[idx]
+}
+
+// repulsion accumulates the unnormalised t-SNE repulsive force on point i
+// into force and returns its contribution to the normalisation term Z.
+func (t *spTree) repulsion(y []float64, i int, theta float64, force []float64) float64 {
+	if t.count == 0 {
+		return 0
+	}
+	p := y[i*t.dims : (i+1)*t.dims]
+	var d2 float64
+	for a := 0; a < t.dims; a++ {
+		diff := p[a] - t.mass[a]
+		d2 += diff * diff
+	}
+	if t.children == nil && d2 == 0 {
+		// Only a leaf holding i itself, and any points identical to it, can
+		// sit at zero distance. They add to Z but exert no force.
+		return float64(t.count - 1)
+	}
+	if t.children == nil || (2*t.half)*(2*t.half) < theta*theta*d2 {
+		count := float64(t.count)
+		q := 1 / (1 + d2)
+		mult := count * q * q
+		for a := 0; a < t.dims; a++ {
+			force[a] += mult * (p[a] - t.mass[a])
+		}
+		return count * q
+	}
+	var z float64
+	for _, c := range t.children {
+		if c != nil {
+			z += c.repulsion(y, i, theta, force)
+		}
+	}
+	return z
+}
@@ -0,0 +1,319 @@
+package similarity
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	DefaultPerplexity = 30
+	DefaultIterations = 1000
+
+	// tsneExactLimit is the largest input optimised with the exact O(n²)
+	// gradient, beyond which Barnes-Hut approximation takes over.
+	tsneExactLimit = 1000
+	tsneTheta      = 0.5
+
+	exaggeration          = 12.0
+	exaggerationIters     = 250
+	initialMomentum       = 0.5
+	finalMomentum         = 0.8
+	minGain               = 0.01
+	perplexityTolerance   = 1e-5
+	perplexitySearchLimit = 200
+)
+
+type tsneOptions struct {
+	dims       int
+	perplexity float64
+	iterations int
+	seed       int64
+	// candidates optionally proposes likely neighbours of each item, from
+	// which larger inputs start NN-descent rather than from random ones.
+	candidates [][]int
+}
+
+// tsneNeighbours is how many neighbours of each item larger inputs keep.
+func tsneNeighbours(perplexity float64) int {
+	return int(3 * perplexity)
+}
+
+// neighbourAffinities holds the sparse, symmetrised input affinities P.
+type neighbourAffinities struct {
+	rows [][]int
+	vals [][]float64
+}
+
+// computeTSNE embeds n items given their pairwise distances. Inputs up to
+// tsneExactLimit use every pair; larger inputs keep only the 3·perplexity
+// nearest neighbours of each item and approximate the repulsive forces with
+// a Barnes-Hut tree.
+func computeTSNE(dist func(i, j int) float64, n int, opts tsneOptions) *mat.Dense {
+	perplexity := math.Min(opts.perplexity, float64(n-1)/3)
+	perplexity = math.Max(perplexity, 1)
+	exact := n <= tsneExactLimit
+	k := n - 1
+	if !exact {
+		k = min(n-1, tsneNeighbours(perplexity))
+	}
+
+	log.Printf("computing %d nearest neighbours for perplexity %.1f...", k, perplexity)
+	var g *knnGraph
+	if !exact {
+		g = computeKNN(dist, n, k, opts.seed, opts.candidates)
+	}
+	P := tsneAffinities(dist, n, k, perplexity, g)
+
+	rnd := rand.New(rand.NewSource(opts.seed))
+	dims := opts.dims
+	y := make([]float64, n*dims)
+	for i := range y {
+		y[i] = rnd.NormFloat64() * 1e-4
+	}
+	update := make([]float64, n*dims)
+	gains := make([]float64, n*dims)
+	for i := range gains {
+		gains[i] = 1
+	}
+	grad := make([]float64, n*dims)
+	var q []float64
+	if exact {
+		q = make([]float64, n*n)
+	}
+	rate := math.Max(float64(n)/exaggeration/4, 50)
+
+	for iter := 0; iter < opts.iterations; iter++ {
+		exag := 1.0
+		momentum := finalMomentum
+		if iter < exaggerationIters {
+			exag = exaggeration
+			momentum = initialMomentum
+		}
+		if exact {
+			tsneExactGradient(P, y, n, dims, exag, grad, q)
+		} else {
+			tsneBarnesHutGradient(P, y, n, dims, exag, grad)
+		}
+		for i := range y {
+			if (grad[i] > 0) != (update[i] > 0) {
+				gains[i] += 0.2
+			} else {
+				gains[i] *= 0.8
+			}
+			gains[i] = math.Max(gains[i], minGain)
+			update[i] = momentum*update[i] - rate*gains[i]*grad[i]
+			y[i] += update[i]
+		}
+		centre(y, n, dims)
+		if (iter+1)%max(opts.iterations/10, 1) == 0 {
+			log.Printf("%d of %d t-sne iterations...", iter+1, opts.iterations)
+		}
+	}
+	return mat.NewDense(n, dims, y)
+}
+
+// tsneAffinities finds the Gaussian bandwidth of each item that matches the
+// perplexity over its k nearest neighbours, taken from g when given and
+// otherwise by comparing every pair, then symmetrises the conditional
+// probabilities into joint ones which sum to one.
+func tsneAffinities(dist func(i, j int) float64, n, k int, perplexity float64, g *knnGraph) neighbourAffinities {
+	cond := neighbourAffinities{
+		rows: make([][]int, n),
+		vals: make([][]float64, n),
+	}
+	target := math.Log(perplexity)
+	parallel.Range(n, func(lo, hi int) {
+		type neighbour struct {
+			j int
+			d float64
+		}
+		all := make([]neighbour, 0, n-1)
+		for i := lo; i < hi; i++ {
+			all = all[:0]
+			if g != nil {
+				for _, v := range g.neighbors[i] {
+					all = append(all, neighbour{v.j, v.d})
+				}
+			} else {
+				for j := 0; j < n; j++ {
+					if j != i {
+						all = append(all, neighbour{j, dist(i, j)})
+					}
+				}
+			}
+			if k < len(all) {
+				sort.Slice(all, func(a, b int) bool {
+					return all[a].d < all[b].d
+				})
+			}
+			nb := all[:min(k, len(all))]
+			d2 := make([]float64, len(nb))
+			cond.rows[i] = make([]int, len(nb))
+			for m, v := range nb {
+				cond.rows[i][m] = v.j
+				d2[m] = v.d * v.d
+			}
+			cond.vals[i] = gaussianRow(d2, target)
+		}
+	})
+
+	// P_ij = (P_j|i + P_i|j) / 2n over the union of both neighbourhoods.
+	joint := make([]map[int]float64, n)
+	for i := range joint {
+		joint[i] = map[int]float64{}
+	}
+	for i := 0; i < n; i++ {
+		for m, j := range cond.rows[i] {
+			v := cond.vals[i][m] / float64(2*n)
+			joint[i][j] += v
+			joint[j][i] += v
+		}
+	}
+	P := neighbourAffinities{
+		rows: make([][]int, n),
+		vals: make([][]float64, n),
+	}
+	for i, row := range joint {
+		P.rows[i] = make([]int, 0, len(row))
+		for j := range row {
+			P.rows[i] = append(P.rows[i], j)
+		}
+		sort.Ints(P.rows[i])
+		P.vals[i] = make([]float64, len(P.rows[i]))
+		for m, j := range P.rows[i] {
+			P.vals[i][m] = row[j]
+		}
+	}
+	return P
+}
+
+// gaussianRow binary searches the precision whose conditional distribution
+// over the squared distances has the target entropy.
+func gaussianRow(d2 []float64, target float64) []float64 {
+	p := make([]float64, len(d2))
+	if len(d2) == 0 {
+		return p
+	}
+	minD2 := math.Inf(1)
+	for _, v := range d2 {
+		minD2 = math.Min(minD2, v)
+	}
+	beta, lo, hi := 1.0, 0.0, math.Inf(1)
+	for attempt := 0; attempt < perplexitySearchLimit; attempt++ {
+		var sum, weighted float64
+		for m, v := range d2 {
+			p[m] = math.Exp(-(v - minD2) * beta)
+			sum += p[m]
+			weighted += (v - minD2) * p[m]
+		}
+		entropy := math.Log(sum) + beta*weighted/sum
+		for m := range p {
+			p[m] /= sum
+		}
+		diff := entropy - target
+		if math.Abs(diff) < perplexityTolerance {
+			break
+		}
+		if diff > 0 {
+			lo = beta
+			if math.IsInf(hi, 1) {
+				beta *= 2
+			} else {
+				beta = (beta + hi) / 2
+			}
+		} else {
+			hi = beta
+			beta = (beta + lo) / 2
+		}
+	}
+	return p
+}
+
+// tsneExactGradient computes the gradient over every pair, using q, of
+// n×n, to hold the low dimensional affinities.
+func tsneExactGradient(P neighbourAffinities, y []float64, n, dims int, exag float64, grad, q []float64) {
+	var z float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			var d2 float64
+			for a := 0; a < dims; a++ {
+				diff := y[i*dims+a] - y[j*dims+a]
+				d2 += diff * diff
+			}
+			v := 1 / (1 + d2)
+			q[i*n+j] = v
+			q[j*n+i] = v
+			z += 2 * v
+		}
+	}
+	clear(grad)
+	for i := 0; i < n; i++ {
+		for m, j := range P.rows[i] {
+			mult := exag * P.vals[i][m] * q[i*n+j]
+			for a := 0; a < dims; a++ {
+				grad[i*dims+a] += 4 * mult * (y[i*dims+a] - y[j*dims+a])
+			}
+		}
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			v := q[i*n+j]
+			mult := v * v / z
+			for a := 0; a < dims; a++ {
+				grad[i*dims+a] -= 4 * mult * (y[i*dims+a] - y[j*dims+a])
+			}
+		}
+	}
+}
+
+func tsneBarnesHutGradient(P neighbourAffinities, y []float64, n, dims int, exag float64, grad []float64) {
+	tree := newSPTree(y, n, dims)
+	repulsive := make([]float64, n*dims)
+	zs := make([]float64, n)
+	parallel.Range(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			zs[i] = tree.repulsion(y, i, tsneTheta, repulsive[i*dims:(i+1)*dims])
+		}
+	})
+	var z float64
+	for _, v := range zs {
+		z += v
+	}
+	parallel.Range(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			for a := 0; a < dims; a++ {
+				grad[i*dims+a] = -4 * repulsive[i*dims+a] / z
+			}
+			for m, j := range P.rows[i] {
+				var d2 float64
+				for a := 0; a < dims; a++ {
+					diff := y[i*dims+a] - y[j*dims+a]
+					d2 += diff * diff
+				}
+				mult := exag * P.vals[i][m] / (1 + d2)
+				for a := 0; a < dims; a++ {
+					grad[i*dims+a] += 4 * mult * (y[i*dims+a] - y[j*dims+a])
+				}
+			}
+		}
+	})
+}
+
+func centre(y []float64, n, dims int) {
+	for a := 0; a < dims; a++ {
+		var mean float64
+		for i := 0; i < n; i++ {
+			mean += y[i*dims+a]
+		}
+		mean /= float64(n)
+		for i := 0; i < n; i++ {
+			y[i*dims+a] -= mean
+		}
+	}
+}
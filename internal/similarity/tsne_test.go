@@ -0,0 +1,150 @@
+package similarity
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// blobs scatters n points around k well separated centres in five
+// dimensions, and returns the distance between two of them along with the
+// centre each belongs to.
+func blobs(n, k int, seed int64) (func(i, j int) float64, []int) {
+	rnd := rand.New(rand.NewSource(seed))
+	centres := make([][5]float64, k)
+	for c := range centres {
+		for a := range centres[c] {
+			centres[c][a] = rnd.Float64() * 100
+		}
+	}
+	points := make([][5]float64, n)
+	labels := make([]int, n)
+	for i := range points {
+		labels[i] = i % k
+		for a := range points[i] {
+			points[i][a] = centres[labels[i]][a] + rnd.NormFloat64()
+		}
+	}
+	return func(i, j int) float64 {
+		var d2 float64
+		for a := range points[i] {
+			d2 += (points[i][a] - points[j][a]) * (points[i][a] - points[j][a])
+		}
+		return math.Sqrt(d2)
+	}, labels
+}
+
+// nearestAgreement is the share of points whose nearest neighbour in the
+// layout belongs to the same blob.
+func nearestAgreement(at func(i, a int) float64, n, dims int, labels []int) float64 {
+	agree := 0
+	for i := 0; i < n; i++ {
+		nearest, best := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			var d2 float64
+			for a := 0; a < dims; a++ {
+				d2 += (at(i, a) - at(j, a)) * (at(i, a) - at(j, a))
+			}
+			if d2 < best {
+				nearest, best = j, d2
+			}
+		}
+		if labels[nearest] == labels[i] {
+			agree++
+		}
+	}
+	return float64(agree) / float64(n)
+}
+
+func TestTSNE(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int
+		dims       int
+		iterations int
+	}{
+		{"exact", 150, 2, 500},
+		{"exact 3d", 150, 3, 500},
+		{"barnes-hut", tsneExactLimit + 200, 2, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dist, labels := blobs(tt.n, 5, 3)
+			opts := tsneOptions{dims: tt.dims, perplexity: 20, iterations: tt.iterations, seed: 1}
+			coords := computeTSNE(dist, tt.n, opts)
+			if rows, cols := coords.Dims(); rows != tt.n || cols != tt.dims {
+				t.Fatalf("got %d×%d coordinates, want %d×%d", rows, cols, tt.n, tt.dims)
+			}
+			for i := 0; i < tt.n; i++ {
+				for a := 0; a < tt.dims; a++ {
+					if v := coords.At(i, a); math.IsNaN(v) || math.IsInf(v, 0) {
+						t.Fatalf("point %d: got coordinate %g", i, v)
+					}
+				}
+			}
+			if got := nearestAgreement(coords.At, tt.n, tt.dims, labels); got < 0.99 {
+				t.Errorf("got %.3f of nearest neighbours in the same blob, want at least 0.99", got)
+			}
+			again := computeTSNE(dist, tt.n, opts)
+			for i := 0; i < tt.n; i++ {
+				for a := 0; a < tt.dims; a++ {
+					if coords.At(i, a) != again.At(i, a) {
+						t.Fatalf("point %d: got %v then %v with the same seed", i, coords.RawRowView(i), again.RawRowView(i))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTSNEAffinities(t *testing.T) {
+	dist, _ := blobs(60, 3, 5)
+	P := tsneAffinities(dist, 60, 59, 10, nil)
+	var sum float64
+	for i := range P.rows {
+		for m, j := range P.rows[i] {
+			sum += P.vals[i][m]
+			if j == i {
+				t.Errorf("item %d has an affinity with itself", i)
+			}
+			// Joint affinities are symmetric.
+			k := 0
+			for k < len(P.rows[j]) && P.rows[j][k] != i {
+				k++
+			}
+			if k == len(P.rows[j]) || math.Abs(P.vals[j][k]-P.vals[i][m]) > 1e-15 {
+				t.Errorf("affinity %d-%d is not symmetric", i, j)
+			}
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("got affinities summing to %g, want 1", sum)
+	}
+}
+
+func TestGaussianRowPerplexity(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	d2 := make([]float64, 100)
+	for i := range d2 {
+		d2[i] = rnd.Float64() * 50
+	}
+	for _, perplexity := range []float64{2, 10, 30} {
+		p := gaussianRow(d2, math.Log(perplexity))
+		var sum, entropy float64
+		for _, v := range p {
+			sum += v
+			if v > 0 {
+				entropy -= v * math.Log(v)
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("perplexity %g: got probabilities summing to %g", perplexity, sum)
+		}
+		if got := math.Exp(entropy); math.Abs(got-perplexity) > 1e-3*perplexity {
+			t.Errorf("got perplexity %g, want %g", got, perplexity)
+		}
+	}
+}
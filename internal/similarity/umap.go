@@ -0,0 +1,260 @@
+package similarity
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"github.com/atoscerebro/bms-analysis/internal/parallel"
+)
+
+const (
+	DefaultNeighbours = 15
+	DefaultMinDist    = 0.1
+
+	umapNegativeSamples = 5
+	umapGradientClip    = 4.0
+	umapSigmaTolerance  = 1e-5
+	umapSigmaSearches   = 64
+)
+
+type umapOptions struct {
+	dims       int
+	neighbours int
+	minDist    float64
+	epochs     int
+	seed       int64
+	candidates [][]int
+}
+
+type umapEdge struct {
+	i, j int
+	w    float64
+}
+
+// computeUMAP embeds n items from their approximate k-nearest-neighbour
+// graph (McInnes, Healy & Melville, 2018), so it never needs more than n·k
+// distances at once.
+func computeUMAP(dist func(i, j int) float64, n int, opts umapOptions) []float64 {
+	log.Printf("building %d nearest neighbour graph...", opts.neighbours)
+	g := computeKNN(dist, n, opts.neighbours, opts.seed, opts.candidates)
+
+	log.Printf("computing fuzzy simplicial set...")
+	edges := fuzzySimplicialSet(g)
+
+	a, b := fitCurve(opts.minDist, 1)
+	log.Printf("optimising layout over %d epochs with a=%.3f b=%.3f...", opts.epochs, a, b)
+	return optimiseLayout(edges, n, opts.dims, opts.epochs, a, b, opts.seed)
+}
+
+// umapEpochs follows the reference implementation in spending fewer
+// epochs on larger inputs unless told otherwise.
+func umapEpochs(n, epochs int) int {
+	if epochs > 0 {
+		return epochs
+	}
+	if n > 10000 {
+		return 200
+	}
+	return 500
+}
+
+// fuzzySimplicialSet turns each neighbourhood into membership strengths
+// normalised by the local connectivity of the item, then unions the
+// directed memberships with a probabilistic t-conorm.
+func fuzzySimplicialSet(g *knnGraph) []umapEdge {
+	n := len(g.neighbors)
+	target := math.Log2(float64(max(g.k, 2)))
+	directed := make([]map[int]float64, n)
+	parallel.Range(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			nb := g.neighbors[i]
+			directed[i] = make(map[int]float64, len(nb))
+			if len(nb) == 0 {
+				continue
+			}
+			rho := 0.0
+			for _, v := range nb {
+				if v.d > 0 {
+					rho = v.d
+					break
+				}
+			}
+			sigma, lo, hi := 1.0, 0.0, math.Inf(1)
+			for s := 0; s < umapSigmaSearches; s++ {
+				var sum float64
+				for _, v := range nb {
+					sum += math.Exp(-math.Max(0, v.d-rho) / sigma)
+				}
+				if math.Abs(sum-target) < umapSigmaTolerance {
+					break
+				}
+				if sum > target {
+					hi = sigma
+					sigma = (lo + hi) / 2
+				} else {
+					lo = sigma
+					if math.IsInf(hi, 1) {
+						sigma *= 2
+					} else {
+						sigma = (lo + hi) / 2
+					}
+				}
+			}
+			for _, v := range nb {
+				directed[i][v.j] = math.Exp(-math.Max(0, v.d-rho) / sigma)
+			}
+		}
+	})
+
+	edges := []umapEdge{}
+	for i := 0; i < n; i++ {
+		for _, v := range g.neighbors[i] {
+			j := v.j
+			a := directed[i][j]
+			b, reverse := directed[j][i]
+			if reverse && j < i {
+				// Already added from j's side.
+				continue
+			}
+			edges = append(edges, umapEdge{i, j, a + b - a*b})
+		}
+	}
+	return edges
+}
+
+// fitCurve finds the a and b for which 1/(1+a·d^2b) best matches the target
+// membership: 1 within minDist and exponential decay with the spread beyond.
+func fitCurve(minDist, spread float64) (float64, float64) {
+	xs := make([]float64, 300)
+	ys := make([]float64, 300)
+	for i := range xs {
+		xs[i] = 3 * spread * float64(i) / 299
+		if xs[i] < minDist {
+			ys[i] = 1
+		} else {
+			ys[i] = math.Exp(-(xs[i] - minDist) / spread)
+		}
+	}
+	loss := func(a, b float64) float64 {
+		var l float64
+		for i, x := range xs {
+			diff := 1/(1+a*math.Pow(x, 2*b)) - ys[i]
+			l += diff * diff
+		}
+		return l
+	}
+	bestA, bestB := 1.0, 1.0
+	best := loss(bestA, bestB)
+	step := 0.5
+	for step > 1e-5 {
+		improved := false
+		for _, d := range [][2]float64{{step, 0}, {-step, 0}, {0, step}, {0, -step}} {
+			a, b := bestA+d[0], bestB+d[1]
+			if a <= 0 || b <= 0 {
+				continue
+			}
+			if l := loss(a, b); l < best {
+				best, bestA, bestB = l, a, b
+				improved = true
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+	return bestA, bestB
+}
+
+// optimiseLayout runs the UMAP stochastic gradient descent, sampling every
+// edge in proportion to its weight and pushing each sampled item away from
+// a few random others. It is sequential so a seed always gives the same
+// layout.
+func optimiseLayout(edges []umapEdge, n, dims, epochs int, a, b float64, seed int64) []float64 {
+	rnd := rand.New(rand.NewSource(seed))
+	y := make([]float64, n*dims)
+	for i := range y {
+		y[i] = rnd.Float64()*20 - 10
+	}
+	if len(edges) == 0 {
+		return y
+	}
+
+	var maxW float64
+	for _, e := range edges {
+		maxW = math.Max(maxW, e.w)
+	}
+	perSample := make([]float64, len(edges))
+	next := make([]float64, len(edges))
+	perNegative := make([]float64, len(edges))
+	nextNegative := make([]float64, len(edges))
+	for k, e := range edges {
+		perSample[k] = -1
+		if e.w > 0 {
+			perSample[k] = maxW / e.w
+		}
+		next[k] = perSample[k]
+		perNegative[k] = perSample[k] / umapNegativeSamples
+		nextNegative[k] = perNegative[k]
+	}
+
+	clip := func(v float64) float64 {
+		return math.Max(-umapGradientClip, math.Min(umapGradientClip, v))
+	}
+	for epoch := 1; epoch <= epochs; epoch++ {
+		alpha := 1 - float64(epoch-1)/float64(epochs)
+		fe := float64(epoch)
+		for k, e := range edges {
+			if perSample[k] <= 0 || next[k] > fe {
+				continue
+			}
+			yi := y[e.i*dims : (e.i+1)*dims]
+			yj := y[e.j*dims : (e.j+1)*dims]
+			d2 := sqDist(yi, yj)
+			if d2 > 0 {
+				coeff := -2 * a * b * math.Pow(d2, b-1) / (a*math.Pow(d2, b) + 1)
+				for c := 0; c < dims; c++ {
+					g := clip(coeff * (yi[c] - yj[c]))
+					yi[c] += g * alpha
+					yj[c] -= g * alpha
+				}
+			}
+			next[k] += perSample[k]
+
+			negatives := int((fe - nextNegative[k]) / perNegative[k])
+			for s := 0; s < negatives; s++ {
+				m := rnd.Intn(n)
+				if m == e.i {
+					continue
+				}
+				ym := y[m*dims : (m+1)*dims]
+				d2 := sqDist(yi, ym)
+				var coeff float64
+				if d2 > 0 {
+					coeff = 2 * b / ((0.001 + d2) * (a*math.Pow(d2, b) + 1))
+				}
+				for c := 0; c < dims; c++ {
+					g := umapGradientClip
+					if coeff > 0 {
+						g = clip(coeff * (yi[c] - ym[c]))
+					}
+					yi[c] += g * alpha
+				}
+			}
+			nextNegative[k] += float64(negatives) * perNegative[k]
+		}
+		if epoch%max(epochs/10, 1) == 0 {
+			log.Printf("%d of %d umap epochs...", epoch, epochs)
+		}
+	}
+	return y
+}
+
+func sqDist(a, b []float64) float64 {
+	var d float64
+	for i := range a {
+		diff := a[i] - b[i]
+		d += diff * diff
+	}
+	return d
+}
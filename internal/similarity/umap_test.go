@@ -0,0 +1,113 @@
+package similarity
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestUMAP(t *testing.T) {
+	for _, dims := range []int{2, 3} {
+		n := 300
+		dist, labels := blobs(n, 5, 4)
+		opts := umapOptions{dims: dims, neighbours: 15, minDist: DefaultMinDist, epochs: 200, seed: 1}
+		y := computeUMAP(dist, n, opts)
+		if len(y) != n*dims {
+			t.Fatalf("%dd: got %d coordinates, want %d", dims, len(y), n*dims)
+		}
+		for _, v := range y {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Fatalf("%dd: got coordinate %g", dims, v)
+			}
+		}
+		at := func(i, a int) float64 { return y[i*dims+a] }
+		if got := nearestAgreement(at, n, dims, labels); got < 0.99 {
+			t.Errorf("%dd: got %.3f of nearest neighbours in the same blob, want at least 0.99", dims, got)
+		}
+		again := computeUMAP(dist, n, opts)
+		for i := range y {
+			if y[i] != again[i] {
+				t.Fatalf("%dd: got different layouts with the same seed", dims)
+			}
+		}
+	}
+}
+
+func TestFitCurve(t *testing.T) {
+	// The reference implementation finds a≈1.577 and b≈0.895 for the
+	// default minimum distance and a spread of one.
+	a, b := fitCurve(DefaultMinDist, 1)
+	if math.Abs(a-1.577) > 0.05 || math.Abs(b-0.895) > 0.02 {
+		t.Errorf("got a=%.3f b=%.3f, want a≈1.577 b≈0.895", a, b)
+	}
+}
+
+func TestFuzzySimplicialSet(t *testing.T) {
+	dist, _ := blobs(100, 4, 6)
+	g := computeKNN(dist, 100, 10, 1, nil)
+	edges := fuzzySimplicialSet(g)
+	seen := map[[2]int]float64{}
+	for _, e := range edges {
+		if e.w <= 0 || e.w > 1+1e-12 {
+			t.Errorf("edge %d-%d: got weight %g, want within (0, 1]", e.i, e.j, e.w)
+		}
+		pair := [2]int{min(e.i, e.j), max(e.i, e.j)}
+		if _, ok := seen[pair]; ok {
+			t.Errorf("edge %d-%d appears twice", e.i, e.j)
+		}
+		seen[pair] = e.w
+	}
+	// Each item's nearest neighbour is at full membership.
+	for i, nb := range g.neighbors {
+		pair := [2]int{min(i, nb[0].j), max(i, nb[0].j)}
+		if w := seen[pair]; math.Abs(w-1) > 1e-12 {
+			t.Errorf("item %d: got weight %g to its nearest neighbour, want 1", i, w)
+		}
+	}
+}
+
+func TestKNN(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		recall float64
+	}{
+		{"exact", 200, 1},
+		{"nn-descent", exactKNNLimit + 500, 0.9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := 10
+			dist, _ := blobs(tt.n, 8, 7)
+			g := computeKNN(dist, tt.n, k, 1, nil)
+			found := 0
+			d := make([]float64, tt.n)
+			for i := 0; i < tt.n; i++ {
+				nb := g.neighbors[i]
+				if len(nb) != k {
+					t.Fatalf("item %d: got %d neighbours, want %d", i, len(nb), k)
+				}
+				if !sort.SliceIsSorted(nb, func(a, b int) bool { return nb[a].d < nb[b].d }) {
+					t.Fatalf("item %d: neighbours are not in ascending order of distance", i)
+				}
+				for j := range d {
+					d[j] = dist(i, j)
+				}
+				d[i] = math.Inf(1)
+				sorted := append([]float64(nil), d...)
+				sort.Float64s(sorted)
+				for _, v := range nb {
+					if v.j == i {
+						t.Fatalf("item %d is its own neighbour", i)
+					}
+					if v.d <= sorted[k-1] {
+						found++
+					}
+				}
+			}
+			if got := float64(found) / float64(tt.n*k); got < tt.recall {
+				t.Errorf("got recall %.3f, want at least %.3f", got, tt.recall)
+			}
+		})
+	}
+}
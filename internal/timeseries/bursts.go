@@ -0,0 +1,37 @@
+package timeseries
+
+import (
+	"time"
+)
+
+// Bursts splits times, which must be sorted, wherever two consecutive
+// times are more than gap apart and returns the index range [start, end)
+// of every burst with at least minSize times.
+func Bursts(times []time.Time, gap time.Duration, minSize int) [][2]int {
+	bursts := [][2]int{}
+	start := 0
+	for i := 1; i <= len(times); i++ {
+		if i < len(times) && times[i].Sub(times[i-1]) <= gap {
+			continue
+		}
+		if i-start >= max(minSize, 1) {
+			bursts = append(bursts, [2]int{start, i})
+		}
+		start = i
+	}
+	return bursts
+}
+
+// PeakRate is the most times, which must be sorted, falling within any
+// window of the given length.
+func PeakRate(times []time.Time, window time.Duration) int {
+	peak := 0
+	lo := 0
+	for hi := range times {
+		for times[hi].Sub(times[lo]) >= window {
+			lo++
+		}
+		peak = max(peak, hi-lo+1)
+	}
+	return peak
+}
@@ -0,0 +1,67 @@
+package timeseries
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns the times the given number of seconds after the epoch.
+func at(seconds ...int) []time.Time {
+	times := make([]time.Time, len(seconds))
+	for i, s := range seconds {
+		times[i] = epoch.Add(time.Duration(s) * time.Second)
+	}
+	return times
+}
+
+func TestBursts(t *testing.T) {
+	tests := []struct {
+		name    string
+		times   []time.Time
+		gap     time.Duration
+		minSize int
+		want    [][2]int
+	}{
+		{"empty", at(), time.Minute, 1, [][2]int{}},
+		{"single", at(0), time.Minute, 1, [][2]int{{0, 1}}},
+		{"single below min size", at(0), time.Minute, 2, [][2]int{}},
+		{"zero min size", at(0), time.Minute, 0, [][2]int{{0, 1}}},
+		{"gap exactly", at(0, 60, 120), time.Minute, 1, [][2]int{{0, 3}}},
+		{"gap exceeded", at(0, 61, 122), time.Minute, 1, [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+		{"min size drops small bursts", at(0, 10, 20, 200, 400, 410), time.Minute, 2, [][2]int{{0, 3}, {4, 6}}},
+		{"same time", at(5, 5, 5), 0, 3, [][2]int{{0, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Bursts(tt.times, tt.gap, tt.minSize); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeakRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		times  []time.Time
+		window time.Duration
+		want   int
+	}{
+		{"empty", at(), time.Minute, 0},
+		{"single", at(0), time.Minute, 1},
+		{"window exactly excludes", at(0, 60), time.Minute, 1},
+		{"just inside window", at(0, 59), time.Minute, 2},
+		{"same time", at(5, 5, 5), time.Minute, 3},
+		{"densest stretch", at(0, 100, 110, 120, 130, 300), time.Minute, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PeakRate(tt.times, tt.window); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package timeseries
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Nearest finds, for every time in a, the closest time in b no more than
+// window away, both sorted, and returns the signed lag from each such time
+// in a to its match in b.
+func Nearest(a, b []time.Time, window time.Duration) []time.Duration {
+	lags := []time.Duration{}
+	for _, t := range a {
+		i := sort.Search(len(b), func(i int) bool { return !b[i].Before(t) })
+		best, found := time.Duration(0), false
+		for _, j := range []int{i - 1, i} {
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			lag := b[j].Sub(t)
+			if lag.Abs() <= window && (!found || lag.Abs() < best.Abs()) {
+				best, found = lag, true
+			}
+		}
+		if found {
+			lags = append(lags, best)
+		}
+	}
+	return lags
+}
+
+// Chance is the probability that at least one of events, scattered at
+// random over span, falls within window either side of a given time.
+func Chance(events int, span, window time.Duration) float64 {
+	if span <= 0 {
+		return 1
+	}
+	rate := float64(events) / span.Seconds()
+	return 1 - math.Exp(-rate*2*window.Seconds())
+}
+
+// MedianLag is the median of lags, which it sorts.
+func MedianLag(lags []time.Duration) time.Duration {
+	if len(lags) == 0 {
+		return 0
+	}
+	slices.Sort(lags)
+	n := len(lags)
+	if n%2 == 1 {
+		return lags[n/2]
+	}
+	return (lags[n/2-1] + lags[n/2]) / 2
+}
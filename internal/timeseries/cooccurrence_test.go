@@ -0,0 +1,64 @@
+package timeseries
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNearest(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []time.Time
+		window time.Duration
+		want   []time.Duration
+	}{
+		{"follows", at(0, 100), at(5, 103), 10 * time.Second, []time.Duration{5 * time.Second, 3 * time.Second}},
+		{"precedes", at(10), at(4), 10 * time.Second, []time.Duration{-6 * time.Second}},
+		{"nearest either side", at(10), at(4, 12), 10 * time.Second, []time.Duration{2 * time.Second}},
+		{"outside window", at(0, 100), at(50), 10 * time.Second, []time.Duration{}},
+		{"at the window", at(0), at(10), 10 * time.Second, []time.Duration{10 * time.Second}},
+		{"no b", at(0), nil, time.Minute, []time.Duration{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Nearest(tt.a, tt.b, tt.window); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChance(t *testing.T) {
+	tests := []struct {
+		events       int
+		span, window time.Duration
+		want         float64
+	}{
+		{0, time.Hour, time.Minute, 0},
+		{60, time.Hour, 30 * time.Second, 1 - math.Exp(-1)},
+		{10, 0, time.Minute, 1},
+	}
+	for _, tt := range tests {
+		if got := Chance(tt.events, tt.span, tt.window); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%d events over %s within %s: got %g, want %g", tt.events, tt.span, tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestMedianLag(t *testing.T) {
+	tests := []struct {
+		lags []time.Duration
+		want time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{3, -1, 7}, 3},
+		{[]time.Duration{4, 1, -2, 10}, 2},
+	}
+	for _, tt := range tests {
+		if got := MedianLag(tt.lags); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.lags, got, tt.want)
+		}
+	}
+}
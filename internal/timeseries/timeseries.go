@@ -0,0 +1,120 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Baseline string
+
+const (
+	// BaselineRolling compares each bucket with the buckets just before it.
+	BaselineRolling Baseline = "rolling"
+	// BaselineSeasonal compares each bucket with the same bucket in the
+	// seasons before it, such as the same hour on previous days.
+	BaselineSeasonal Baseline = "seasonal"
+)
+
+var Baselines = []Baseline{BaselineRolling, BaselineSeasonal}
+
+// madScale makes the median absolute deviation a consistent estimate of
+// the standard deviation of normally distributed counts.
+const madScale = 1.4826
+
+type Options struct {
+	Baseline Baseline
+	// Window is how many earlier buckets, or earlier seasons for a
+	// seasonal baseline, each bucket is compared with.
+	Window int
+	// Season is the number of buckets in one season.
+	Season int
+	// Threshold is the robust z-score at or above which a bucket spikes,
+	// and MinCount the fewest logs a spike needs.
+	Threshold float64
+	MinCount  float64
+}
+
+// Buckets returns the start of every interval from the one containing
+// start up to the one containing end, aligned to the interval.
+func Buckets(start, end time.Time, interval time.Duration) []time.Time {
+	buckets := []time.Time{}
+	for t := start.Truncate(interval); !t.After(end); t = t.Add(interval) {
+		buckets = append(buckets, t)
+	}
+	return buckets
+}
+
+// Index is the bucket of t in buckets starting at the first bucket.
+func Index(t, first time.Time, interval time.Duration) int {
+	return int(t.Sub(first) / interval)
+}
+
+// Detect scores each count against a baseline of earlier counts as
+// (count - median) / (1.4826·MAD), the median absolute deviation being
+// floored at one so that a quiet series does not turn every blip into a
+// spike. It returns the baseline median and score of each bucket and the
+// buckets which spike. Buckets without enough history have NaN for both.
+func Detect(counts []float64, opts Options) ([]float64, []float64, []int, error) {
+	step := 1
+	switch opts.Baseline {
+	case BaselineRolling, "":
+	case BaselineSeasonal:
+		if opts.Season <= 0 {
+			return nil, nil, nil, fmt.Errorf("a seasonal baseline needs a season of at least one bucket")
+		}
+		step = opts.Season
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown baseline '%s', expected one of %s", opts.Baseline, joinBaselines())
+	}
+	window := max(opts.Window, 1)
+	baselines := make([]float64, len(counts))
+	scores := make([]float64, len(counts))
+	spikes := []int{}
+	for i := range counts {
+		baselines[i], scores[i] = math.NaN(), math.NaN()
+	}
+	history := make([]float64, 0, window)
+	deviations := make([]float64, 0, window)
+	for i, count := range counts {
+		history = history[:0]
+		for k := 1; k <= window && i-k*step >= 0; k++ {
+			history = append(history, counts[i-k*step])
+		}
+		if len(history) < min(window, 3) {
+			continue
+		}
+		median := medianOf(history)
+		deviations = deviations[:0]
+		for _, h := range history {
+			deviations = append(deviations, math.Abs(h-median))
+		}
+		scale := math.Max(madScale*medianOf(deviations), 1)
+		baselines[i] = median
+		scores[i] = (count - median) / scale
+		if scores[i] >= opts.Threshold && count >= opts.MinCount {
+			spikes = append(spikes, i)
+		}
+	}
+	return baselines, scores, spikes, nil
+}
+
+// medianOf sorts values in place and returns their median.
+func medianOf(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+func joinBaselines() string {
+	names := make([]string, len(Baselines))
+	for i, b := range Baselines {
+		names[i] = string(b)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,81 @@
+package timeseries
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	flat := func(n int, spikes map[int]float64) []float64 {
+		counts := make([]float64, n)
+		for i := range counts {
+			counts[i] = 10
+		}
+		for i, v := range spikes {
+			counts[i] = v
+		}
+		return counts
+	}
+	tests := []struct {
+		name   string
+		counts []float64
+		opts   Options
+		spikes []int
+	}{
+		{"flat", flat(48, nil), Options{Window: 24, Threshold: 3.5, MinCount: 5}, []int{}},
+		{"rolling spike", flat(48, map[int]float64{30: 50}), Options{Window: 24, Threshold: 3.5, MinCount: 5}, []int{30}},
+		{"below min count", flat(48, map[int]float64{30: 50}), Options{Window: 24, Threshold: 3.5, MinCount: 60}, []int{}},
+		{"below threshold", flat(48, map[int]float64{30: 12}), Options{Window: 24, Threshold: 3.5, MinCount: 5}, []int{}},
+		{"too early", flat(48, map[int]float64{1: 50}), Options{Window: 24, Threshold: 3.5, MinCount: 5}, []int{}},
+		{"seasonal spike", flat(96, map[int]float64{80: 50}), Options{Baseline: BaselineSeasonal, Window: 3, Season: 24, Threshold: 3.5, MinCount: 5}, []int{80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baselines, scores, spikes, err := Detect(tt.counts, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(baselines) != len(tt.counts) || len(scores) != len(tt.counts) {
+				t.Fatalf("got %d baselines and %d scores for %d counts", len(baselines), len(scores), len(tt.counts))
+			}
+			step := 1
+			if tt.opts.Baseline == BaselineSeasonal {
+				step = tt.opts.Season
+			}
+			for i := range tt.counts {
+				// A bucket is scored once it has three earlier buckets, or
+				// the whole window when that is shorter.
+				scored := min(i/step, tt.opts.Window) >= min(tt.opts.Window, 3)
+				if scored == math.IsNaN(scores[i]) || scored == math.IsNaN(baselines[i]) {
+					t.Errorf("bucket %d: got baseline %g and score %g, want them scored %t", i, baselines[i], scores[i], scored)
+				}
+			}
+			if !slices.Equal(spikes, tt.spikes) {
+				t.Errorf("got spikes %v, want %v", spikes, tt.spikes)
+			}
+			for _, i := range tt.spikes {
+				if baselines[i] != 10 || scores[i] != 40 {
+					t.Errorf("spike %d: got baseline %g and score %g, want 10 and 40", i, baselines[i], scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetectErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"unknown baseline", Options{Baseline: "weekly"}},
+		{"seasonal without season", Options{Baseline: BaselineSeasonal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := Detect([]float64{1, 2, 3}, tt.opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}